@@ -27,12 +27,25 @@ const (
 	HelmReleaseProxyCreationFailedReason = "HelmReleaseProxyCreationFailed"
 	// HelmReleaseProxyDeletionFailedReason...
 	HelmReleaseProxyDeletionFailedReason = "HelmReleaseProxyDeletionFailed"
+	// HelmReleaseProxyGetFailedReason indicates that the existing HelmReleaseProxy for a Cluster could not be retrieved.
+	HelmReleaseProxyGetFailedReason = "HelmReleaseProxyGetFailed"
 	// HelmReleaseProxyReinstallingReason...
 	HelmReleaseProxyReinstallingReason = "HelmReleaseProxyReinstalling"
 	// ValueParsingFailedReason is ...
 	ValueParsingFailedReason = "ValueParsingFailed"
+	// PostRendererParsingFailedReason indicates that the Go templating in the post-renderer patches failed to render for a Cluster.
+	PostRendererParsingFailedReason = "PostRendererParsingFailed"
+	// RegistryMirrorsFailedReason indicates that the registry mirrors configured on the manager could not be read.
+	RegistryMirrorsFailedReason = "RegistryMirrorsFailed"
 	// ClusterSelectionFailedReason is ...
 	ClusterSelectionFailedReason = "ClusterSelectionFailed"
+	// ChartLoadFailedReason indicates that the chart could not be fetched to validate the values against its schema.
+	ChartLoadFailedReason = "ChartLoadFailed"
+	// ValuesSchemaValidationFailedReason indicates that the rendered values for one or more Clusters do not match the
+	// chart's values.schema.json.
+	ValuesSchemaValidationFailedReason = "ValuesSchemaValidationFailed"
+	// ValueOverridesFailedReason indicates that the value overrides of one or more Clusters could not be applied.
+	ValueOverridesFailedReason = "ValueOverridesFailed"
 
 	// HelmReleaseProxiesReadyCondition...
 	HelmReleaseProxiesReadyCondition clusterv1.ConditionType = "HelmReleaseProxiesReady"
@@ -52,6 +65,12 @@ const (
 	HelmReleaseDeletedReason = "HelmReleaseDeleted"
 	// HelmReleaseGetFailedReason is ...
 	HelmReleaseGetFailedReason = "HelmReleaseGetFailed"
+	// HelmStorageConfigFailedReason indicates that the Helm storage driver of the release could not be configured.
+	HelmStorageConfigFailedReason = "HelmStorageConfigFailed"
+	// ChartSourceNotAllowedReason indicates that a ChartSourcePolicy doesn't allow the chart version resolved at install time.
+	ChartSourceNotAllowedReason = "ChartSourceNotAllowed"
+	// ChartSourcePolicyCheckFailedReason indicates that the ChartSourcePolicies could not be evaluated for the chart.
+	ChartSourcePolicyCheckFailedReason = "ChartSourcePolicyCheckFailed"
 
 	// ClusterAvailableCondition...
 	ClusterAvailableCondition clusterv1.ConditionType = "ClusterAvailable"
@@ -59,4 +78,21 @@ const (
 	GetClusterFailedReason = "GetClusterFailed"
 	// GetKubeconfigFailedReason is ...
 	GetKubeconfigFailedReason = "GetKubeconfigFailed"
+	// WaitingForClusterReadinessReason indicates that the Helm release is waiting for the Cluster readiness conditions
+	// to be true before it is installed.
+	WaitingForClusterReadinessReason = "WaitingForClusterReadiness"
+
+	// ClusterTLSVerifiedCondition reports whether Helm verifies the API server certificate of the Cluster.
+	ClusterTLSVerifiedCondition clusterv1.ConditionType = "ClusterTLSVerified"
+	// InsecureSkipTLSVerifyReason indicates that TLS verification is disabled by the insecure-skip-tls-verify annotation on the Cluster.
+	InsecureSkipTLSVerifyReason = "InsecureSkipTLSVerify"
+
+	// ReleaseTestsPassedCondition reports whether the test hooks of the current revision of the Helm release passed.
+	ReleaseTestsPassedCondition clusterv1.ConditionType = "ReleaseTestsPassed"
+	// ReleaseTestsFailedReason indicates that one or more test hooks of the Helm release failed or timed out.
+	ReleaseTestsFailedReason = "ReleaseTestsFailed"
+	// ReleaseTestsRunFailedReason indicates that the test hooks of the Helm release could not be run.
+	ReleaseTestsRunFailedReason = "ReleaseTestsRunFailed"
+	// ReleaseRolledBackReason indicates that the upgrade of the Helm release was rolled back because its test hooks failed.
+	ReleaseRolledBackReason = "ReleaseRolledBack"
 )
@@ -0,0 +1,518 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	utilconversion "sigs.k8s.io/cluster-api/util/conversion"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+	"sigs.k8s.io/yaml"
+
+	"cluster-api-addon-provider-helm/api/v1alpha2"
+)
+
+// ConvertTo converts this HelmChartProxy to the Hub version (v1alpha2).
+func (src *HelmChartProxy) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha2.HelmChartProxy)
+	dst.ObjectMeta = src.ObjectMeta
+	convertHelmChartProxySpecToHub(&src.Spec, &dst.Spec)
+	convertHelmChartProxyStatusToHub(&src.Status, &dst.Status)
+
+	// Restore the fields that v1alpha1 doesn't have.
+	restored := &v1alpha2.HelmChartProxy{}
+	if ok, err := utilconversion.UnmarshalData(src, restored); err != nil || !ok {
+		return err
+	}
+	dst.Spec.Values = restored.Spec.Values
+	dst.Spec.ReinstallStrategy = restored.Spec.ReinstallStrategy
+	dst.Status.ReconcileRequestStatus = restored.Status.ReconcileRequestStatus
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha2) to this version.
+func (dst *HelmChartProxy) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha2.HelmChartProxy)
+	dst.ObjectMeta = src.ObjectMeta
+	convertHelmChartProxySpecFromHub(&src.Spec, &dst.Spec)
+	convertHelmChartProxyStatusFromHub(&src.Status, &dst.Status)
+
+	// Preserve the fields that v1alpha1 doesn't have in an annotation so that they survive a round trip through v1alpha1.
+	if src.Spec.Values != nil || src.Spec.ReinstallStrategy != "" || src.Status.ReconcileRequestStatus != (v1alpha2.ReconcileRequestStatus{}) {
+		return utilconversion.MarshalData(src, dst)
+	}
+
+	return nil
+}
+
+// ConvertTo converts this HelmChartProxyList to the Hub version (v1alpha2).
+func (src *HelmChartProxyList) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha2.HelmChartProxyList)
+	dst.ListMeta = src.ListMeta
+	dst.Items = make([]v1alpha2.HelmChartProxy, len(src.Items))
+	for i := range src.Items {
+		if err := src.Items[i].ConvertTo(&dst.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha2) to this version.
+func (dst *HelmChartProxyList) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha2.HelmChartProxyList)
+	dst.ListMeta = src.ListMeta
+	dst.Items = make([]HelmChartProxy, len(src.Items))
+	for i := range src.Items {
+		if err := dst.Items[i].ConvertFrom(&src.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ConvertTo converts this HelmReleaseProxy to the Hub version (v1alpha2).
+func (src *HelmReleaseProxy) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha2.HelmReleaseProxy)
+	dst.ObjectMeta = src.ObjectMeta
+	if err := convertHelmReleaseProxySpecToHub(&src.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	convertHelmReleaseProxyStatusToHub(&src.Status, &dst.Status)
+
+	// Restore the fields that v1alpha1 doesn't have.
+	restored := &v1alpha2.HelmReleaseProxy{}
+	if ok, err := utilconversion.UnmarshalData(src, restored); err != nil || !ok {
+		return err
+	}
+	dst.Status.ObservedGeneration = restored.Status.ObservedGeneration
+	dst.Status.PostRendererHash = restored.Status.PostRendererHash
+	dst.Status.ReconcileRequestStatus = restored.Status.ReconcileRequestStatus
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha2) to this version.
+func (dst *HelmReleaseProxy) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha2.HelmReleaseProxy)
+	dst.ObjectMeta = src.ObjectMeta
+	if err := convertHelmReleaseProxySpecFromHub(&src.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	convertHelmReleaseProxyStatusFromHub(&src.Status, &dst.Status)
+
+	// Preserve the fields that v1alpha1 doesn't have in an annotation so that they survive a round trip through v1alpha1.
+	if src.Status.ObservedGeneration != 0 || src.Status.PostRendererHash != "" || src.Status.ReconcileRequestStatus != (v1alpha2.ReconcileRequestStatus{}) {
+		return utilconversion.MarshalData(src, dst)
+	}
+
+	return nil
+}
+
+// ConvertTo converts this HelmReleaseProxyList to the Hub version (v1alpha2).
+func (src *HelmReleaseProxyList) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha2.HelmReleaseProxyList)
+	dst.ListMeta = src.ListMeta
+	dst.Items = make([]v1alpha2.HelmReleaseProxy, len(src.Items))
+	for i := range src.Items {
+		if err := src.Items[i].ConvertTo(&dst.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha2) to this version.
+func (dst *HelmReleaseProxyList) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha2.HelmReleaseProxyList)
+	dst.ListMeta = src.ListMeta
+	dst.Items = make([]HelmReleaseProxy, len(src.Items))
+	for i := range src.Items {
+		if err := dst.Items[i].ConvertFrom(&src.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ConvertTo converts this ChartSourcePolicy to the Hub version (v1alpha2).
+func (src *ChartSourcePolicy) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha2.ChartSourcePolicy)
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec.Rules = convertChartSourceRulesToHub(src.Spec.Rules)
+	dst.Spec.NamespaceOverrides = nil
+	for _, override := range src.Spec.NamespaceOverrides {
+		dst.Spec.NamespaceOverrides = append(dst.Spec.NamespaceOverrides, v1alpha2.ChartSourceNamespaceOverride{
+			Namespaces: override.Namespaces,
+			Rules:      convertChartSourceRulesToHub(override.Rules),
+		})
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha2) to this version.
+func (dst *ChartSourcePolicy) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha2.ChartSourcePolicy)
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec.Rules = convertChartSourceRulesFromHub(src.Spec.Rules)
+	dst.Spec.NamespaceOverrides = nil
+	for _, override := range src.Spec.NamespaceOverrides {
+		dst.Spec.NamespaceOverrides = append(dst.Spec.NamespaceOverrides, ChartSourceNamespaceOverride{
+			Namespaces: override.Namespaces,
+			Rules:      convertChartSourceRulesFromHub(override.Rules),
+		})
+	}
+
+	return nil
+}
+
+// ConvertTo converts this ChartSourcePolicyList to the Hub version (v1alpha2).
+func (src *ChartSourcePolicyList) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha2.ChartSourcePolicyList)
+	dst.ListMeta = src.ListMeta
+	dst.Items = make([]v1alpha2.ChartSourcePolicy, len(src.Items))
+	for i := range src.Items {
+		if err := src.Items[i].ConvertTo(&dst.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha2) to this version.
+func (dst *ChartSourcePolicyList) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha2.ChartSourcePolicyList)
+	dst.ListMeta = src.ListMeta
+	dst.Items = make([]ChartSourcePolicy, len(src.Items))
+	for i := range src.Items {
+		if err := dst.Items[i].ConvertFrom(&src.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func convertHelmChartProxySpecToHub(src *HelmChartProxySpec, dst *v1alpha2.HelmChartProxySpec) {
+	dst.ClusterSelector = src.ClusterSelector
+	dst.ChartName = src.ChartName
+	dst.RepoURL = src.RepoURL
+	dst.ReleaseName = src.ReleaseName
+	dst.ReleaseNamespace = src.ReleaseNamespace
+	dst.Version = src.Version
+	dst.ValuesTemplate = src.ValuesTemplate
+	dst.ClusterReadinessConditions = src.ClusterReadinessConditions
+	dst.PostRenderers = convertPostRenderersToHub(src.PostRenderers)
+	dst.RegistryMirrors = src.RegistryMirrors
+	dst.ServiceAccountName = src.ServiceAccountName
+	dst.Impersonate = (*v1alpha2.ImpersonationConfig)(src.Impersonate)
+	dst.Storage = convertHelmStorageToHub(src.Storage)
+	dst.Tests = (*v1alpha2.ReleaseTests)(src.Tests)
+	dst.CRDs = convertCRDsToHub(src.CRDs)
+}
+
+func convertHelmChartProxySpecFromHub(src *v1alpha2.HelmChartProxySpec, dst *HelmChartProxySpec) {
+	dst.ClusterSelector = src.ClusterSelector
+	dst.ChartName = src.ChartName
+	dst.RepoURL = src.RepoURL
+	dst.ReleaseName = src.ReleaseName
+	dst.ReleaseNamespace = src.ReleaseNamespace
+	dst.Version = src.Version
+	dst.ValuesTemplate = src.ValuesTemplate
+	dst.ClusterReadinessConditions = src.ClusterReadinessConditions
+	dst.PostRenderers = convertPostRenderersFromHub(src.PostRenderers)
+	dst.RegistryMirrors = src.RegistryMirrors
+	dst.ServiceAccountName = src.ServiceAccountName
+	dst.Impersonate = (*ImpersonationConfig)(src.Impersonate)
+	dst.Storage = convertHelmStorageFromHub(src.Storage)
+	dst.Tests = (*ReleaseTests)(src.Tests)
+	dst.CRDs = convertCRDsFromHub(src.CRDs)
+}
+
+func convertHelmChartProxyStatusToHub(src *HelmChartProxyStatus, dst *v1alpha2.HelmChartProxyStatus) {
+	dst.Conditions = src.Conditions
+	dst.MatchingClusters = src.MatchingClusters
+	dst.MatchingClustersCount = src.MatchingClustersCount
+	dst.InstalledClustersCount = src.InstalledClustersCount
+	dst.ReadyClustersCount = src.ReadyClustersCount
+	dst.FailedClustersCount = src.FailedClustersCount
+	dst.UpgradingClustersCount = src.UpgradingClustersCount
+	dst.ReadySummary = src.ReadySummary
+	dst.ClusterStatuses = nil
+	for _, clusterStatus := range src.ClusterStatuses {
+		dst.ClusterStatuses = append(dst.ClusterStatuses, v1alpha2.HelmChartProxyClusterStatus(clusterStatus))
+	}
+}
+
+func convertHelmChartProxyStatusFromHub(src *v1alpha2.HelmChartProxyStatus, dst *HelmChartProxyStatus) {
+	dst.Conditions = src.Conditions
+	dst.MatchingClusters = src.MatchingClusters
+	dst.MatchingClustersCount = src.MatchingClustersCount
+	dst.InstalledClustersCount = src.InstalledClustersCount
+	dst.ReadyClustersCount = src.ReadyClustersCount
+	dst.FailedClustersCount = src.FailedClustersCount
+	dst.UpgradingClustersCount = src.UpgradingClustersCount
+	dst.ReadySummary = src.ReadySummary
+	dst.ClusterStatuses = nil
+	for _, clusterStatus := range src.ClusterStatuses {
+		dst.ClusterStatuses = append(dst.ClusterStatuses, HelmChartProxyClusterStatus(clusterStatus))
+	}
+}
+
+func convertHelmReleaseProxySpecToHub(src *HelmReleaseProxySpec, dst *v1alpha2.HelmReleaseProxySpec) error {
+	values, err := convertValuesToHub(src.Values)
+	if err != nil {
+		return err
+	}
+
+	dst.ClusterRef = src.ClusterRef
+	dst.ChartName = src.ChartName
+	dst.RepoURL = src.RepoURL
+	dst.ReleaseName = src.ReleaseName
+	dst.ReleaseNamespace = src.ReleaseNamespace
+	dst.Version = src.Version
+	dst.Values = values
+	dst.ClusterReadinessConditions = src.ClusterReadinessConditions
+	dst.PostRenderers = convertPostRenderersToHub(src.PostRenderers)
+	dst.RegistryMirrors = src.RegistryMirrors
+	dst.ServiceAccountName = src.ServiceAccountName
+	dst.Impersonate = (*v1alpha2.ImpersonationConfig)(src.Impersonate)
+	dst.Storage = convertHelmStorageToHub(src.Storage)
+	dst.AppliedValueOverrides = src.AppliedValueOverrides
+	dst.Tests = (*v1alpha2.ReleaseTests)(src.Tests)
+	dst.CRDs = convertCRDsToHub(src.CRDs)
+
+	return nil
+}
+
+func convertHelmReleaseProxySpecFromHub(src *v1alpha2.HelmReleaseProxySpec, dst *HelmReleaseProxySpec) error {
+	values, err := convertValuesFromHub(src.Values)
+	if err != nil {
+		return err
+	}
+
+	dst.ClusterRef = src.ClusterRef
+	dst.ChartName = src.ChartName
+	dst.RepoURL = src.RepoURL
+	dst.ReleaseName = src.ReleaseName
+	dst.ReleaseNamespace = src.ReleaseNamespace
+	dst.Version = src.Version
+	dst.Values = values
+	dst.ClusterReadinessConditions = src.ClusterReadinessConditions
+	dst.PostRenderers = convertPostRenderersFromHub(src.PostRenderers)
+	dst.RegistryMirrors = src.RegistryMirrors
+	dst.ServiceAccountName = src.ServiceAccountName
+	dst.Impersonate = (*ImpersonationConfig)(src.Impersonate)
+	dst.Storage = convertHelmStorageFromHub(src.Storage)
+	dst.AppliedValueOverrides = src.AppliedValueOverrides
+	dst.Tests = (*ReleaseTests)(src.Tests)
+	dst.CRDs = convertCRDsFromHub(src.CRDs)
+
+	return nil
+}
+
+func convertHelmReleaseProxyStatusToHub(src *HelmReleaseProxyStatus, dst *v1alpha2.HelmReleaseProxyStatus) {
+	dst.Conditions = src.Conditions
+	dst.Status = src.Status
+	dst.Revision = src.Revision
+	dst.Version = src.Version
+	dst.StorageDriver = v1alpha2.HelmStorageDriver(src.StorageDriver)
+	dst.RewrittenImages = nil
+	for _, image := range src.RewrittenImages {
+		dst.RewrittenImages = append(dst.RewrittenImages, v1alpha2.RewrittenImage(image))
+	}
+	dst.Tests = nil
+	if src.Tests != nil {
+		dst.Tests = &v1alpha2.ReleaseTestsStatus{
+			Revision:             src.Tests.Revision,
+			RolledBackGeneration: src.Tests.RolledBackGeneration,
+		}
+		for _, result := range src.Tests.Results {
+			dst.Tests.Results = append(dst.Tests.Results, v1alpha2.ReleaseTestResult(result))
+		}
+	}
+}
+
+func convertHelmReleaseProxyStatusFromHub(src *v1alpha2.HelmReleaseProxyStatus, dst *HelmReleaseProxyStatus) {
+	dst.Conditions = src.Conditions
+	dst.Status = src.Status
+	dst.Revision = src.Revision
+	dst.Version = src.Version
+	dst.StorageDriver = HelmStorageDriver(src.StorageDriver)
+	dst.RewrittenImages = nil
+	for _, image := range src.RewrittenImages {
+		dst.RewrittenImages = append(dst.RewrittenImages, RewrittenImage(image))
+	}
+	dst.Tests = nil
+	if src.Tests != nil {
+		dst.Tests = &ReleaseTestsStatus{
+			Revision:             src.Tests.Revision,
+			RolledBackGeneration: src.Tests.RolledBackGeneration,
+		}
+		for _, result := range src.Tests.Results {
+			dst.Tests.Results = append(dst.Tests.Results, ReleaseTestResult(result))
+		}
+	}
+}
+
+// convertValuesToHub converts the YAML values of a v1alpha1 HelmReleaseProxy to structured values.
+func convertValuesToHub(values string) (*apiextensionsv1.JSON, error) {
+	if strings.TrimSpace(values) == "" {
+		return nil, nil
+	}
+
+	raw, err := yaml.YAMLToJSON([]byte(values))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert values to JSON")
+	}
+	if string(raw) == "null" {
+		return nil, nil
+	}
+
+	return &apiextensionsv1.JSON{Raw: raw}, nil
+}
+
+// convertValuesFromHub converts structured values to the YAML values of a v1alpha1 HelmReleaseProxy.
+func convertValuesFromHub(values *apiextensionsv1.JSON) (string, error) {
+	if values == nil || len(values.Raw) == 0 {
+		return "", nil
+	}
+
+	raw, err := yaml.JSONToYAML(values.Raw)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to convert values to YAML")
+	}
+
+	return string(raw), nil
+}
+
+func convertPostRenderersToHub(src *PostRenderers) *v1alpha2.PostRenderers {
+	if src == nil {
+		return nil
+	}
+
+	dst := &v1alpha2.PostRenderers{
+		PatchesStrategicMerge: src.PatchesStrategicMerge,
+		CommonLabels:          src.CommonLabels,
+		CommonAnnotations:     src.CommonAnnotations,
+	}
+	for _, patch := range src.PatchesJSON6902 {
+		dst.PatchesJSON6902 = append(dst.PatchesJSON6902, v1alpha2.JSON6902Patch{
+			Target: v1alpha2.PatchTarget(patch.Target),
+			Patch:  patch.Patch,
+		})
+	}
+	for _, image := range src.Images {
+		dst.Images = append(dst.Images, v1alpha2.ImageOverride(image))
+	}
+
+	return dst
+}
+
+func convertPostRenderersFromHub(src *v1alpha2.PostRenderers) *PostRenderers {
+	if src == nil {
+		return nil
+	}
+
+	dst := &PostRenderers{
+		PatchesStrategicMerge: src.PatchesStrategicMerge,
+		CommonLabels:          src.CommonLabels,
+		CommonAnnotations:     src.CommonAnnotations,
+	}
+	for _, patch := range src.PatchesJSON6902 {
+		dst.PatchesJSON6902 = append(dst.PatchesJSON6902, JSON6902Patch{
+			Target: PatchTarget(patch.Target),
+			Patch:  patch.Patch,
+		})
+	}
+	for _, image := range src.Images {
+		dst.Images = append(dst.Images, ImageOverride(image))
+	}
+
+	return dst
+}
+
+func convertHelmStorageToHub(src *HelmStorage) *v1alpha2.HelmStorage {
+	if src == nil {
+		return nil
+	}
+
+	return &v1alpha2.HelmStorage{
+		Driver:                 v1alpha2.HelmStorageDriver(src.Driver),
+		SQLConnectionSecretRef: (*v1alpha2.SecretKeyReference)(src.SQLConnectionSecretRef),
+	}
+}
+
+func convertHelmStorageFromHub(src *v1alpha2.HelmStorage) *HelmStorage {
+	if src == nil {
+		return nil
+	}
+
+	return &HelmStorage{
+		Driver:                 HelmStorageDriver(src.Driver),
+		SQLConnectionSecretRef: (*SecretKeyReference)(src.SQLConnectionSecretRef),
+	}
+}
+
+func convertCRDsToHub(src *CRDs) *v1alpha2.CRDs {
+	if src == nil {
+		return nil
+	}
+
+	return &v1alpha2.CRDs{
+		Policy:            v1alpha2.CRDPolicy(src.Policy),
+		DeleteOnUninstall: src.DeleteOnUninstall,
+	}
+}
+
+func convertCRDsFromHub(src *v1alpha2.CRDs) *CRDs {
+	if src == nil {
+		return nil
+	}
+
+	return &CRDs{
+		Policy:            CRDPolicy(src.Policy),
+		DeleteOnUninstall: src.DeleteOnUninstall,
+	}
+}
+
+func convertChartSourceRulesToHub(src []ChartSourceRule) []v1alpha2.ChartSourceRule {
+	var dst []v1alpha2.ChartSourceRule
+	for _, rule := range src {
+		dst = append(dst, v1alpha2.ChartSourceRule(rule))
+	}
+
+	return dst
+}
+
+func convertChartSourceRulesFromHub(src []v1alpha2.ChartSourceRule) []ChartSourceRule {
+	var dst []ChartSourceRule
+	for _, rule := range src {
+		dst = append(dst, ChartSourceRule(rule))
+	}
+
+	return dst
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	. "github.com/onsi/gomega"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/apitesting/fuzzer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	runtimeserializer "k8s.io/apimachinery/pkg/runtime/serializer"
+	utilconversion "sigs.k8s.io/cluster-api/util/conversion"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+	"sigs.k8s.io/yaml"
+
+	"cluster-api-addon-provider-helm/api/v1alpha2"
+)
+
+func TestFuzzyConversion(t *testing.T) {
+	g := NewWithT(t)
+	scheme := runtime.NewScheme()
+	g.Expect(AddToScheme(scheme)).To(Succeed())
+	g.Expect(v1alpha2.AddToScheme(scheme)).To(Succeed())
+
+	t.Run("for HelmChartProxy", utilconversion.FuzzTestFunc(utilconversion.FuzzTestFuncInput{
+		Scheme:           scheme,
+		Hub:              &v1alpha2.HelmChartProxy{},
+		HubAfterMutation: removeEmptyAnnotations,
+		Spoke:            &HelmChartProxy{},
+		FuzzerFuncs:      []fuzzer.FuzzerFuncs{fuzzFuncs},
+	}))
+	t.Run("for HelmReleaseProxy", utilconversion.FuzzTestFunc(utilconversion.FuzzTestFuncInput{
+		Scheme:           scheme,
+		Hub:              &v1alpha2.HelmReleaseProxy{},
+		HubAfterMutation: removeEmptyAnnotations,
+		Spoke:            &HelmReleaseProxy{},
+		FuzzerFuncs:      []fuzzer.FuzzerFuncs{fuzzFuncs},
+	}))
+	t.Run("for ChartSourcePolicy", utilconversion.FuzzTestFunc(utilconversion.FuzzTestFuncInput{
+		Scheme: scheme,
+		Hub:    &v1alpha2.ChartSourcePolicy{},
+		Spoke:  &ChartSourcePolicy{},
+	}))
+}
+
+// removeEmptyAnnotations removes the empty annotations that are left after the conversion data annotation is removed.
+func removeEmptyAnnotations(hub conversion.Hub) {
+	object := hub.(metav1.Object)
+	if len(object.GetAnnotations()) == 0 {
+		object.SetAnnotations(nil)
+	}
+}
+
+// fuzzFuncs generates values that survive the conversion between the YAML values of v1alpha1 and the structured values
+// of v1alpha2, which normalizes them.
+func fuzzFuncs(_ runtimeserializer.CodecFactory) []interface{} {
+	return []interface{}{
+		func(in *apiextensionsv1.JSON, c fuzz.Continue) {
+			in.Raw = fuzzValues(c)
+			if in.Raw == nil {
+				in.Raw = []byte("{}")
+			}
+		},
+		func(in *HelmReleaseProxySpec, c fuzz.Continue) {
+			c.FuzzNoCustom(in)
+
+			in.Values = ""
+			if raw := fuzzValues(c); raw != nil {
+				values, err := yaml.JSONToYAML(raw)
+				if err != nil {
+					panic(err)
+				}
+				in.Values = string(values)
+			}
+		},
+	}
+}
+
+func fuzzValues(c fuzz.Continue) []byte {
+	values := map[string]string{}
+	c.Fuzz(&values)
+	if len(values) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(values)
+	if err != nil {
+		panic(err)
+	}
+
+	return raw
+}
+
+func TestHelmReleaseProxyConversionPreservesStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	hub := &v1alpha2.HelmReleaseProxy{
+		Spec: v1alpha2.HelmReleaseProxySpec{
+			ChartName: "nginx",
+			Values:    &apiextensionsv1.JSON{Raw: []byte(`{"replicaCount":2}`)},
+		},
+		Status: v1alpha2.HelmReleaseProxyStatus{
+			Revision:           3,
+			ObservedGeneration: 4,
+			PostRendererHash:   "hash",
+			ReconcileRequestStatus: v1alpha2.ReconcileRequestStatus{
+				LastHandledReconcileAt:      "1",
+				LastHandledForceUpgradeAt:   "2",
+				LastHandledForceReinstallAt: "3",
+			},
+		},
+	}
+	expected := hub.DeepCopy()
+
+	spoke := &HelmReleaseProxy{}
+	g.Expect(spoke.ConvertFrom(hub)).To(Succeed())
+	g.Expect(spoke.Spec.Values).To(Equal("replicaCount: 2\n"))
+	g.Expect(spoke.Annotations).To(HaveKey(utilconversion.DataAnnotation))
+
+	restored := &v1alpha2.HelmReleaseProxy{}
+	g.Expect(spoke.ConvertTo(restored)).To(Succeed())
+	g.Expect(restored.Annotations).NotTo(HaveKey(utilconversion.DataAnnotation))
+	g.Expect(restored.Spec).To(Equal(expected.Spec))
+	g.Expect(restored.Status).To(Equal(expected.Status))
+}
+
+func TestHelmChartProxyConversionWithoutHubOnlyFields(t *testing.T) {
+	g := NewWithT(t)
+
+	hub := &v1alpha2.HelmChartProxy{
+		Spec: v1alpha2.HelmChartProxySpec{
+			ChartName:      "nginx",
+			ValuesTemplate: "replicaCount: 2",
+		},
+	}
+
+	spoke := &HelmChartProxy{}
+	g.Expect(spoke.ConvertFrom(hub)).To(Succeed())
+	g.Expect(spoke.Annotations).NotTo(HaveKey(utilconversion.DataAnnotation))
+
+	restored := &v1alpha2.HelmChartProxy{}
+	g.Expect(spoke.ConvertTo(restored)).To(Succeed())
+	g.Expect(restored.Spec).To(Equal(hub.Spec))
+}
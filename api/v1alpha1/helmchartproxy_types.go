@@ -26,6 +26,11 @@ const (
 	// HelmChartProxyFinalizer is the finalizer used by the HelmChartProxy controller to cleanup add-on resources when
 	// a HelmChartProxy is being deleted.
 	HelmChartProxyFinalizer = "helmchartproxy.addons.cluster.x-k8s.io"
+
+	// ValueOverridesAnnotationPrefix is the prefix of the Cluster annotation holding YAML values that override the values
+	// rendered from the ValuesTemplate of a HelmChartProxy for that Cluster. The annotation key is the prefix followed by the
+	// name of the HelmChartProxy, e.g. "values.addons.cluster.x-k8s.io/nginx-ingress".
+	ValueOverridesAnnotationPrefix = "values.addons.cluster.x-k8s.io/"
 )
 
 // HelmChartProxySpec defines the desired state of HelmChartProxy.
@@ -55,9 +60,51 @@ type HelmChartProxySpec struct {
 	Version string `json:"version,omitempty"`
 
 	// ValuesTemplate is an inline YAML representing the values for the Helm chart. This YAML supports Go templating to reference
-	// fields from each selected workload Cluster and programatically create and set values.
+	// fields from each selected workload Cluster and programatically create and set values. Values from the
+	// ValueOverridesAnnotationPrefix annotation of a Cluster are deep-merged over the rendered values for that Cluster.
 	// +optional
 	ValuesTemplate string `json:"valuesTemplate,omitempty"`
+
+	// ClusterReadinessConditions is a list of Cluster condition types, e.g. ControlPlaneInitialized or InfrastructureReady,
+	// that must be true on a selected Cluster before the Helm chart is installed on it. If it is not specified, the chart
+	// is installed as soon as the Cluster is selected.
+	// +optional
+	ClusterReadinessConditions []clusterv1.ConditionType `json:"clusterReadinessConditions,omitempty"`
+
+	// PostRenderers modifies the manifests rendered by Helm before they are applied to each selected Cluster, e.g. to
+	// patch resources that the chart values do not expose.
+	// +optional
+	PostRenderers *PostRenderers `json:"postRenderers,omitempty"`
+
+	// RegistryMirrors maps image registries, optionally followed by a repository path, to the mirror that container images
+	// from the registry are pulled from instead, e.g. docker.io: registry.internal/dockerhub. The images in the rendered
+	// manifests are rewritten before they are applied. These mirrors take precedence over the mirrors configured on the manager.
+	// +optional
+	RegistryMirrors map[string]string `json:"registryMirrors,omitempty"`
+
+	// ServiceAccountName is the name of a ServiceAccount in the ReleaseNamespace on each selected Cluster that Helm
+	// impersonates to manage the release, instead of using the credentials from the Cluster kubeconfig. The ServiceAccount
+	// must be allowed to manage the resources of the chart and the Helm release storage. It cannot be set together with Impersonate.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Impersonate is a user and groups on each selected Cluster that Helm impersonates to manage the release, instead of using
+	// the credentials from the Cluster kubeconfig. It cannot be set together with ServiceAccountName.
+	// +optional
+	Impersonate *ImpersonationConfig `json:"impersonate,omitempty"`
+
+	// Storage configures where Helm stores the release on each selected Cluster. If it is not specified, the manager default
+	// is used. Changing it reinstalls the release on every selected Cluster.
+	// +optional
+	Storage *HelmStorage `json:"storage,omitempty"`
+
+	// Tests configures running the test hooks of the chart after the release is installed or upgraded on each selected Cluster.
+	// +optional
+	Tests *ReleaseTests `json:"tests,omitempty"`
+
+	// CRDs configures how the CRDs in the crds/ directory of the chart are managed on each selected Cluster.
+	// +optional
+	CRDs *CRDs `json:"crds,omitempty"`
 }
 
 // HelmChartProxyStatus defines the observed state of HelmChartProxy.
@@ -69,11 +116,68 @@ type HelmChartProxyStatus struct {
 	// MatchingClusters is the list of references to Clusters selected by the ClusterSelector.
 	// +optional
 	MatchingClusters []corev1.ObjectReference `json:"matchingClusters"`
+
+	// MatchingClustersCount is the number of Clusters selected by the ClusterSelector.
+	// +optional
+	MatchingClustersCount int32 `json:"matchingClustersCount"`
+
+	// InstalledClustersCount is the number of selected Clusters where the Helm release has been installed.
+	// +optional
+	InstalledClustersCount int32 `json:"installedClustersCount"`
+
+	// ReadyClustersCount is the number of selected Clusters whose HelmReleaseProxy is ready.
+	// +optional
+	ReadyClustersCount int32 `json:"readyClustersCount"`
+
+	// FailedClustersCount is the number of selected Clusters where the Helm release failed to be installed or upgraded.
+	// +optional
+	FailedClustersCount int32 `json:"failedClustersCount"`
+
+	// UpgradingClustersCount is the number of selected Clusters where a Helm operation is in progress.
+	// +optional
+	UpgradingClustersCount int32 `json:"upgradingClustersCount"`
+
+	// ReadySummary summarizes the number of ready Clusters out of the selected Clusters, e.g. "2/3".
+	// +optional
+	ReadySummary string `json:"readySummary,omitempty"`
+
+	// ClusterStatuses is the status of the Helm release on each selected Cluster.
+	// +optional
+	ClusterStatuses []HelmChartProxyClusterStatus `json:"clusterStatuses,omitempty"`
+}
+
+// HelmChartProxyClusterStatus summarizes the state of the Helm release on a single selected Cluster.
+type HelmChartProxyClusterStatus struct {
+	// ClusterName is the name of the selected Cluster.
+	ClusterName string `json:"clusterName"`
+
+	// HelmReleaseProxyName is the name of the HelmReleaseProxy managing the Helm release on the Cluster.
+	// +optional
+	HelmReleaseProxyName string `json:"helmReleaseProxyName,omitempty"`
+
+	// Version is the chart version of the current Helm release on the Cluster.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Revision is the current revision of the Helm release on the Cluster.
+	// +optional
+	Revision int `json:"revision,omitempty"`
+
+	// Ready is the status of the Ready condition of the HelmReleaseProxy.
+	// +optional
+	Ready corev1.ConditionStatus `json:"ready,omitempty"`
+
+	// LastError is the most recent error reported for the Cluster, if any.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+// +kubebuilder:printcolumn:name="Clusters",type="string",JSONPath=".status.readySummary",description="Ready Clusters out of the selected Clusters"
+// +kubebuilder:printcolumn:name="Failed",type="integer",JSONPath=".status.failedClustersCount",description="Number of selected Clusters where the Helm release failed"
+// +kubebuilder:printcolumn:name="Upgrading",type="integer",priority=1,JSONPath=".status.upgradingClustersCount",description="Number of selected Clusters with a Helm operation in progress"
 // +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].reason"
 // +kubebuilder:printcolumn:name="Message",type="string",priority=1,JSONPath=".status.conditions[?(@.type=='Ready')].message"
 // +kubebuilder:resource:shortName=hcp
@@ -106,20 +210,6 @@ func (c *HelmChartProxy) SetConditions(conditions clusterv1.Conditions) {
 	c.Status.Conditions = conditions
 }
 
-func (c *HelmChartProxy) SetMatchingClusters(clusterList []clusterv1.Cluster) {
-	matchingClusters := make([]corev1.ObjectReference, 0, len(clusterList))
-	for _, cluster := range clusterList {
-		matchingClusters = append(matchingClusters, corev1.ObjectReference{
-			Kind:       cluster.Kind,
-			APIVersion: cluster.APIVersion,
-			Name:       cluster.Name,
-			Namespace:  cluster.Namespace,
-		})
-	}
-
-	c.Status.MatchingClusters = matchingClusters
-}
-
 func init() {
 	SchemeBuilder.Register(&HelmChartProxy{}, &HelmChartProxyList{})
 }
@@ -17,61 +17,13 @@ limitations under the License.
 package v1alpha1
 
 import (
-	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
-	logf "sigs.k8s.io/controller-runtime/pkg/log"
-	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
-// log is for logging in this package.
-var helmchartproxylog = logf.Log.WithName("helmchartproxy-resource")
-
+// SetupWebhookWithManager registers the conversion webhook for HelmChartProxy. Defaulting and validation are served by the
+// v1alpha2 webhooks, which the API server converts v1alpha1 requests for.
 func (r *HelmChartProxy) SetupWebhookWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
 		Complete()
 }
-
-// TODO(user): EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-
-//+kubebuilder:webhook:path=/mutate-addons-cluster-x-k8s-io-v1alpha1-helmchartproxy,mutating=true,failurePolicy=fail,sideEffects=None,groups=addons.cluster.x-k8s.io,resources=helmchartproxies,verbs=create;update,versions=v1alpha1,name=mhelmchartproxy.kb.io,admissionReviewVersions=v1
-
-var _ webhook.Defaulter = &HelmChartProxy{}
-
-// Default implements webhook.Defaulter so a webhook will be registered for the type
-func (p *HelmChartProxy) Default() {
-	helmchartproxylog.Info("default", "name", p.Name)
-
-	if p.Spec.ReleaseNamespace == "" {
-		p.Spec.ReleaseNamespace = "default"
-	}
-}
-
-// TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
-//+kubebuilder:webhook:path=/validate-addons-cluster-x-k8s-io-v1alpha1-helmchartproxy,mutating=false,failurePolicy=fail,sideEffects=None,groups=addons.cluster.x-k8s.io,resources=helmchartproxies,verbs=create;update,versions=v1alpha1,name=vhelmchartproxy.kb.io,admissionReviewVersions=v1
-
-var _ webhook.Validator = &HelmChartProxy{}
-
-// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
-func (r *HelmChartProxy) ValidateCreate() error {
-	helmchartproxylog.Info("validate create", "name", r.Name)
-
-	// TODO(user): fill in your validation logic upon object creation.
-	return nil
-}
-
-// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
-func (r *HelmChartProxy) ValidateUpdate(old runtime.Object) error {
-	helmchartproxylog.Info("validate update", "name", r.Name)
-
-	// TODO(user): fill in your validation logic upon object update.
-	return nil
-}
-
-// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
-func (r *HelmChartProxy) ValidateDelete() error {
-	helmchartproxylog.Info("validate delete", "name", r.Name)
-
-	// TODO(user): fill in your validation logic upon object deletion.
-	return nil
-}
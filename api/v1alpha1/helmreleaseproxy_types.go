@@ -32,6 +32,10 @@ const (
 
 	// IsReleaseNameGeneratedAnnotation is the annotation signifying the Helm release name is auto-generated.
 	IsReleaseNameGeneratedAnnotation = "helmreleaseproxy.addons.cluster.x-k8s.io/is-release-name-generated"
+
+	// InsecureSkipTLSVerifyAnnotation is the Cluster annotation that, when set to "true", disables verification of the API
+	// server certificate of the Cluster for Helm operations.
+	InsecureSkipTLSVerifyAnnotation = "addons.cluster.x-k8s.io/insecure-skip-tls-verify"
 )
 
 // HelmReleaseProxySpec defines the desired state of HelmReleaseProxy.
@@ -63,6 +67,135 @@ type HelmReleaseProxySpec struct {
 	// Go templating with the values from the referenced workload Cluster.
 	// +optional
 	Values string `json:"values,omitempty"`
+
+	// ClusterReadinessConditions is a list of Cluster condition types that must be true on the referenced Cluster
+	// before the Helm chart is installed on it.
+	// +optional
+	ClusterReadinessConditions []clusterv1.ConditionType `json:"clusterReadinessConditions,omitempty"`
+
+	// PostRenderers modifies the manifests rendered by Helm before they are applied to the referenced Cluster. The patches
+	// are the result of the rendered Go templating with the values from the referenced workload Cluster.
+	// +optional
+	PostRenderers *PostRenderers `json:"postRenderers,omitempty"`
+
+	// RegistryMirrors maps image registries, optionally followed by a repository path, to the mirror that container images
+	// from the registry are pulled from instead. It includes the mirrors configured on the manager.
+	// +optional
+	RegistryMirrors map[string]string `json:"registryMirrors,omitempty"`
+
+	// ServiceAccountName is the name of a ServiceAccount in the ReleaseNamespace on the referenced Cluster that Helm
+	// impersonates to manage the release. It cannot be set together with Impersonate.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Impersonate is a user and groups on the referenced Cluster that Helm impersonates to manage the release. It cannot be
+	// set together with ServiceAccountName.
+	// +optional
+	Impersonate *ImpersonationConfig `json:"impersonate,omitempty"`
+
+	// Storage configures where Helm stores the release on the referenced Cluster. If it is not specified, the driver the
+	// release was installed with is kept, and new releases use the manager default. It is immutable.
+	// +optional
+	Storage *HelmStorage `json:"storage,omitempty"`
+
+	// AppliedValueOverrides lists the sources of the per-Cluster value overrides, such as Cluster annotation keys, that were
+	// deep-merged into Values.
+	// +optional
+	AppliedValueOverrides []string `json:"appliedValueOverrides,omitempty"`
+
+	// Tests configures running the test hooks of the chart after the release is installed or upgraded.
+	// +optional
+	Tests *ReleaseTests `json:"tests,omitempty"`
+
+	// CRDs configures how the CRDs in the crds/ directory of the chart are managed on the referenced Cluster.
+	// +optional
+	CRDs *CRDs `json:"crds,omitempty"`
+}
+
+// CRDPolicy is how the CRDs in the crds/ directory of a chart are applied.
+// +kubebuilder:validation:Enum=Skip;Create;CreateReplace
+type CRDPolicy string
+
+const (
+	// CRDPolicySkip doesn't install the CRDs of the chart.
+	CRDPolicySkip CRDPolicy = "Skip"
+	// CRDPolicyCreate installs the CRDs of the chart that don't exist yet when the release is installed, and never upgrades
+	// them. This is the Helm behavior.
+	CRDPolicyCreate CRDPolicy = "Create"
+	// CRDPolicyCreateReplace server-side applies the CRDs of the chart before each install and upgrade of the release, so
+	// that they are upgraded together with the chart.
+	CRDPolicyCreateReplace CRDPolicy = "CreateReplace"
+)
+
+// CRDs configures how the CRDs in the crds/ directory of a chart are managed.
+type CRDs struct {
+	// Policy is how the CRDs of the chart are applied. Defaults to Create.
+	// +kubebuilder:default=Create
+	// +optional
+	Policy CRDPolicy `json:"policy,omitempty"`
+
+	// DeleteOnUninstall deletes the CRDs of the chart, and with them all of their custom resources on the Cluster, before
+	// the release is uninstalled. It only takes effect if CRD deletion is allowed on the manager.
+	// +optional
+	DeleteOnUninstall bool `json:"deleteOnUninstall,omitempty"`
+}
+
+// ReleaseTests configures running the test hooks of a chart, as `helm test` does, after the release is installed or upgraded.
+type ReleaseTests struct {
+	// Enabled runs the test hooks after each successful install or upgrade.
+	Enabled bool `json:"enabled"`
+
+	// Timeout is the time to wait for the test hooks to complete. Defaults to 5m.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// RollbackOnFailure rolls the release back to its previous revision when a test hook fails after an upgrade. The release
+	// is not upgraded again until the spec changes.
+	// +optional
+	RollbackOnFailure bool `json:"rollbackOnFailure,omitempty"`
+}
+
+// HelmStorageDriver is a Helm release storage driver.
+// +kubebuilder:validation:Enum=secret;configmap;sql
+type HelmStorageDriver string
+
+const (
+	// HelmStorageDriverSecret stores releases in Secrets in the release namespace.
+	HelmStorageDriverSecret HelmStorageDriver = "secret"
+	// HelmStorageDriverConfigMap stores releases in ConfigMaps in the release namespace.
+	HelmStorageDriverConfigMap HelmStorageDriver = "configmap"
+	// HelmStorageDriverSQL stores releases in a PostgreSQL database, which avoids the size limit of Secrets and ConfigMaps.
+	HelmStorageDriverSQL HelmStorageDriver = "sql"
+)
+
+// HelmStorage configures where Helm stores releases.
+type HelmStorage struct {
+	// Driver is the Helm storage driver.
+	Driver HelmStorageDriver `json:"driver"`
+
+	// SQLConnectionSecretRef is a reference to a key of a Secret in the same namespace that contains the PostgreSQL
+	// connection string. It is required for the sql driver.
+	// +optional
+	SQLConnectionSecretRef *SecretKeyReference `json:"sqlConnectionSecretRef,omitempty"`
+}
+
+// SecretKeyReference is a reference to a key of a Secret.
+type SecretKeyReference struct {
+	// Name is the name of the Secret.
+	Name string `json:"name"`
+
+	// Key is the key in the Secret data.
+	Key string `json:"key"`
+}
+
+// ImpersonationConfig is an identity to impersonate on a workload Cluster.
+type ImpersonationConfig struct {
+	// User is the username to impersonate.
+	User string `json:"user"`
+
+	// Groups is the list of groups to impersonate.
+	// +optional
+	Groups []string `json:"groups,omitempty"`
 }
 
 // HelmReleaseProxyStatus defines the observed state of HelmReleaseProxy.
@@ -78,6 +211,63 @@ type HelmReleaseProxyStatus struct {
 	// Revision is the current revision of the Helm release.
 	// +optional
 	Revision int `json:"revision,omitempty"`
+
+	// Version is the version of the chart used by the current revision of the Helm release.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// StorageDriver is the Helm storage driver the release is stored with.
+	// +optional
+	StorageDriver HelmStorageDriver `json:"storageDriver,omitempty"`
+
+	// RewrittenImages is the list of images in the rendered manifests that were rewritten to pull from a registry mirror.
+	// +optional
+	RewrittenImages []RewrittenImage `json:"rewrittenImages,omitempty"`
+
+	// Tests is the result of the last run of the test hooks of the release.
+	// +optional
+	Tests *ReleaseTestsStatus `json:"tests,omitempty"`
+}
+
+// ReleaseTestsStatus is the result of a run of the test hooks of a release.
+type ReleaseTestsStatus struct {
+	// Revision is the revision of the Helm release the test hooks ran against.
+	Revision int `json:"revision"`
+
+	// Results is the result of each test hook.
+	// +optional
+	Results []ReleaseTestResult `json:"results,omitempty"`
+
+	// RolledBackGeneration is the generation of the HelmReleaseProxy whose upgrade was rolled back because a test hook
+	// failed. The release is not upgraded again while the generation is unchanged.
+	// +optional
+	RolledBackGeneration int64 `json:"rolledBackGeneration,omitempty"`
+}
+
+// ReleaseTestResult is the result of a single test hook.
+type ReleaseTestResult struct {
+	// Name is the name of the test hook resource.
+	Name string `json:"name"`
+
+	// Phase is the phase of the test hook, e.g. Succeeded or Failed.
+	Phase string `json:"phase"`
+
+	// StartedAt is the time the test hook started.
+	// +optional
+	StartedAt *metav1.Time `json:"startedAt,omitempty"`
+
+	// CompletedAt is the time the test hook completed.
+	// +optional
+	CompletedAt *metav1.Time `json:"completedAt,omitempty"`
+}
+
+// RewrittenImage is an image in the rendered manifests that was rewritten to pull from a registry mirror.
+type RewrittenImage struct {
+	// Original is the image referenced by the chart.
+	Original string `json:"original"`
+
+	// Rewritten is the image pulled from the registry mirror.
+	Rewritten string `json:"rewritten"`
 }
 
 // +kubebuilder:object:root=true
@@ -88,6 +278,7 @@ type HelmReleaseProxyStatus struct {
 // +kubebuilder:printcolumn:name="Message",type="string",priority=1,JSONPath=".status.conditions[?(@.type=='Ready')].message"
 // +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.status"
 // +kubebuilder:printcolumn:name="Revision",type="string",JSONPath=".status.revision"
+// +kubebuilder:printcolumn:name="Storage",type="string",priority=1,JSONPath=".status.storageDriver"
 // +kubebuilder:resource:shortName=hrp
 
 // HelmReleaseProxy is the Schema for the helmreleaseproxies API
@@ -118,21 +309,6 @@ func (r *HelmReleaseProxy) SetConditions(conditions clusterv1.Conditions) {
 	r.Status.Conditions = conditions
 }
 
-func (r *HelmReleaseProxy) SetReleaseStatus(status string) {
-	r.Status.Status = status // See pkg/release/status.go in Helm for possible values
-	// r.Status.Status = release.Info.Status.String() // See pkg/release/status.go in Helm for possible values
-}
-
-func (r *HelmReleaseProxy) SetReleaseRevision(version int) {
-	r.Status.Revision = version
-}
-
-func (r *HelmReleaseProxy) SetReleaseName(name string) {
-	if r.Spec.ReleaseName == "" {
-		r.Spec.ReleaseName = name
-	}
-}
-
 func init() {
 	SchemeBuilder.Register(&HelmReleaseProxy{}, &HelmReleaseProxyList{})
 }
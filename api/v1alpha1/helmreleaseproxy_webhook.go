@@ -17,95 +17,13 @@ limitations under the License.
 package v1alpha1
 
 import (
-	"reflect"
-
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
-	logf "sigs.k8s.io/controller-runtime/pkg/log"
-	"sigs.k8s.io/controller-runtime/pkg/webhook"
-
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 )
 
-// log is for logging in this package.
-var helmreleaseproxylog = logf.Log.WithName("helmreleaseproxy-resource")
-
+// SetupWebhookWithManager registers the conversion webhook for HelmReleaseProxy. Defaulting and validation are served by the
+// v1alpha2 webhooks, which the API server converts v1alpha1 requests for.
 func (r *HelmReleaseProxy) SetupWebhookWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
 		Complete()
 }
-
-// TODO(user): EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-
-//+kubebuilder:webhook:path=/mutate-addons-cluster-x-k8s-io-v1alpha1-helmreleaseproxy,mutating=true,failurePolicy=fail,sideEffects=None,groups=addons.cluster.x-k8s.io,resources=helmreleaseproxies,verbs=create;update,versions=v1alpha1,name=mhelmreleaseproxy.kb.io,admissionReviewVersions=v1
-
-var _ webhook.Defaulter = &HelmReleaseProxy{}
-
-// Default implements webhook.Defaulter so a webhook will be registered for the type
-func (p *HelmReleaseProxy) Default() {
-	helmreleaseproxylog.Info("default", "name", p.Name)
-
-	if p.Spec.ReleaseNamespace == "" {
-		p.Spec.ReleaseNamespace = "default"
-	}
-}
-
-// TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
-//+kubebuilder:webhook:path=/validate-addons-cluster-x-k8s-io-v1alpha1-helmreleaseproxy,mutating=false,failurePolicy=fail,sideEffects=None,groups=addons.cluster.x-k8s.io,resources=helmreleaseproxies,verbs=create;update,versions=v1alpha1,name=vhelmreleaseproxy.kb.io,admissionReviewVersions=v1
-
-var _ webhook.Validator = &HelmReleaseProxy{}
-
-// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
-func (r *HelmReleaseProxy) ValidateCreate() error {
-	helmreleaseproxylog.Info("validate create", "name", r.Name)
-
-	// TODO(user): fill in your validation logic upon object creation.
-	return nil
-}
-
-// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
-func (r *HelmReleaseProxy) ValidateUpdate(oldRaw runtime.Object) error {
-	helmreleaseproxylog.Info("validate update", "name", r.Name)
-
-	var allErrs field.ErrorList
-	old := oldRaw.(*HelmReleaseProxy)
-
-	if !reflect.DeepEqual(r.Spec.RepoURL, old.Spec.RepoURL) {
-		allErrs = append(allErrs,
-			field.Invalid(field.NewPath("spec", "RepoURL"),
-				r.Spec.RepoURL, "field is immutable"),
-		)
-	}
-
-	if !reflect.DeepEqual(r.Spec.ChartName, old.Spec.ChartName) {
-		allErrs = append(allErrs,
-			field.Invalid(field.NewPath("spec", "ChartName"),
-				r.Spec.ChartName, "field is immutable"),
-		)
-	}
-
-	if !reflect.DeepEqual(r.Spec.ReleaseNamespace, old.Spec.ReleaseNamespace) {
-		allErrs = append(allErrs,
-			field.Invalid(field.NewPath("spec", "ReleaseNamespace"),
-				r.Spec.ReleaseNamespace, "field is immutable"),
-		)
-	}
-
-	// TODO: add webhook for ReleaseName. Currently it's being set if the release name is generated.
-
-	if len(allErrs) > 0 {
-		return apierrors.NewInvalid(GroupVersion.WithKind("HelmReleaseProxy").GroupKind(), r.Name, allErrs)
-	}
-
-	return nil
-}
-
-// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
-func (r *HelmReleaseProxy) ValidateDelete() error {
-	helmreleaseproxylog.Info("validate delete", "name", r.Name)
-
-	// TODO(user): fill in your validation logic upon object deletion.
-	return nil
-}
@@ -0,0 +1,245 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ChartSource identifies a chart to evaluate against ChartSourcePolicies.
+type ChartSource struct {
+	// Namespace is the namespace of the HelmChartProxy or HelmReleaseProxy installing the chart.
+	Namespace string
+	// RepoURL is the URL of the chart repository.
+	RepoURL string
+	// ChartName is the name of the chart.
+	ChartName string
+	// Version is the chart version. If it is empty or not a semantic version, version constraints are not evaluated.
+	Version string
+}
+
+// ChartSourceNotAllowedError is returned when a chart source is not allowed by a ChartSourcePolicy.
+type ChartSourceNotAllowedError struct {
+	PolicyName string
+	Source     ChartSource
+}
+
+func (e *ChartSourceNotAllowedError) Error() string {
+	version := e.Source.Version
+	if version == "" {
+		version = "latest"
+	}
+
+	return fmt.Sprintf("chart %s version %s from %s is not allowed in namespace %s by ChartSourcePolicy %s", e.Source.ChartName, version, e.Source.RepoURL, e.Source.Namespace, e.PolicyName)
+}
+
+// IsChartSourceNotAllowed returns true if the cause of err is a ChartSourceNotAllowedError.
+func IsChartSourceNotAllowed(err error) bool {
+	_, ok := errors.Cause(err).(*ChartSourceNotAllowedError)
+
+	return ok
+}
+
+// ValidateChartSource returns a ChartSourceNotAllowedError if any ChartSourcePolicy doesn't allow the chart source. All
+// chart sources are allowed if there are no ChartSourcePolicies.
+func ValidateChartSource(ctx context.Context, c client.Reader, source ChartSource) error {
+	policyList := &ChartSourcePolicyList{}
+	if err := c.List(ctx, policyList); err != nil {
+		return errors.Wrapf(err, "failed to list ChartSourcePolicies")
+	}
+
+	return EvaluateChartSourcePolicies(policyList.Items, source)
+}
+
+// EvaluateChartSourcePolicies returns a ChartSourceNotAllowedError if any of the policies doesn't allow the chart source.
+func EvaluateChartSourcePolicies(policies []ChartSourcePolicy, source ChartSource) error {
+	for _, policy := range policies {
+		allowed, err := policy.Allows(source)
+		if err != nil {
+			return errors.Wrapf(err, "failed to evaluate ChartSourcePolicy %s", policy.Name)
+		}
+		if !allowed {
+			return &ChartSourceNotAllowedError{PolicyName: policy.Name, Source: source}
+		}
+	}
+
+	return nil
+}
+
+// HasVersionConstraints returns true if any ChartSourcePolicy constrains the chart version.
+func HasVersionConstraints(policies []ChartSourcePolicy) bool {
+	for _, policy := range policies {
+		for _, rule := range policy.Spec.Rules {
+			if rule.VersionConstraint != "" {
+				return true
+			}
+		}
+		for _, override := range policy.Spec.NamespaceOverrides {
+			for _, rule := range override.Rules {
+				if rule.VersionConstraint != "" {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// Allows returns true if any rule of the policy that applies to the namespace of the chart source matches it.
+func (p *ChartSourcePolicy) Allows(source ChartSource) (bool, error) {
+	for _, rule := range p.rulesForNamespace(source.Namespace) {
+		matches, err := rule.Matches(source)
+		if err != nil {
+			return false, err
+		}
+		if matches {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (p *ChartSourcePolicy) rulesForNamespace(namespace string) []ChartSourceRule {
+	for _, override := range p.Spec.NamespaceOverrides {
+		for _, overrideNamespace := range override.Namespaces {
+			if overrideNamespace == namespace {
+				return override.Rules
+			}
+		}
+	}
+
+	return p.Spec.Rules
+}
+
+// Matches returns true if the chart source matches the repository URL, chart name and version constraint of the rule.
+func (r *ChartSourceRule) Matches(source ChartSource) (bool, error) {
+	if len(r.RepoURLs) > 0 && !matchesAnyRepoURL(r.RepoURLs, source.RepoURL) {
+		return false, nil
+	}
+	if len(r.ChartNames) > 0 && !matchesAnyGlob(r.ChartNames, source.ChartName) {
+		return false, nil
+	}
+	if r.VersionConstraint == "" {
+		return true, nil
+	}
+
+	constraint, err := semver.NewConstraint(r.VersionConstraint)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid version constraint %q", r.VersionConstraint)
+	}
+	version, err := semver.NewVersion(source.Version)
+	if err != nil {
+		// The version is unset or a range that is only resolved at install time, where it is evaluated again.
+		return true, nil
+	}
+
+	return constraint.Check(version), nil
+}
+
+// matchesAnyRepoURL returns true if the repository URL matches any of the patterns.
+func matchesAnyRepoURL(patterns []string, repoURL string) bool {
+	for _, pattern := range patterns {
+		if matchesRepoURL(pattern, repoURL) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesRepoURL matches a repository URL against a pattern of the form scheme://host/path, where the scheme, the host
+// and the path are matched separately. In the scheme and the host, a * matches any sequence of characters except . and
+// /, so that *.example.com only matches subdomains of example.com. In the path, a * also matches /. The pattern * matches
+// any URL.
+func matchesRepoURL(pattern string, repoURL string) bool {
+	if pattern == "*" {
+		return true
+	}
+	patternScheme, patternHost, patternPath, ok := splitRepoURLPattern(pattern)
+	if !ok {
+		return false
+	}
+
+	// Parse the URL the same way Helm does to connect to the repository, so that the host that is matched is the host
+	// that is connected to, e.g. with user info or a path that climbs out of an allowed directory.
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	repoPath := strings.TrimSuffix(u.Path, "/")
+	if repoPath != "" {
+		repoPath = path.Clean(repoPath)
+	}
+
+	return globToRegexp(strings.ToLower(patternScheme), false).MatchString(strings.ToLower(u.Scheme)) &&
+		globToRegexp(strings.ToLower(patternHost), false).MatchString(strings.ToLower(u.Host)) &&
+		globToRegexp(patternPath, true).MatchString(repoPath)
+}
+
+// splitRepoURLPattern splits a repository URL pattern into its scheme, host and path. The path has no trailing /.
+func splitRepoURLPattern(pattern string) (string, string, string, bool) {
+	parts := strings.SplitN(pattern, "://", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", "", false
+	}
+	hostAndPath := strings.SplitN(parts[1], "/", 2)
+	if hostAndPath[0] == "" {
+		return "", "", "", false
+	}
+	patternPath := ""
+	if len(hostAndPath) == 2 {
+		patternPath = strings.TrimSuffix("/"+hostAndPath[1], "/")
+	}
+
+	return parts[0], hostAndPath[0], patternPath, true
+}
+
+func matchesAnyGlob(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if globToRegexp(pattern, true).MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// globToRegexp converts a glob pattern where * matches any sequence of characters and ? matches any single character to
+// a regular expression. If crossSeparators is false, * and ? don't match . or /.
+func globToRegexp(pattern string, crossSeparators bool) *regexp.Regexp {
+	wildcard := "."
+	if !crossSeparators {
+		wildcard = `[^./]`
+	}
+
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, wildcard+"*")
+	quoted = strings.ReplaceAll(quoted, `\?`, wildcard)
+
+	return regexp.MustCompile("^" + quoted + "$")
+}
@@ -0,0 +1,315 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestMatchesRepoURL(t *testing.T) {
+	testCases := []struct {
+		name    string
+		pattern string
+		repoURL string
+		matches bool
+	}{
+		{
+			name:    "any repository",
+			pattern: "*",
+			repoURL: "https://attacker.net/charts",
+			matches: true,
+		},
+		{
+			name:    "exact URL",
+			pattern: "https://charts.example.com/stable",
+			repoURL: "https://charts.example.com/stable",
+			matches: true,
+		},
+		{
+			name:    "trailing slash",
+			pattern: "https://charts.example.com/stable",
+			repoURL: "https://charts.example.com/stable/",
+			matches: true,
+		},
+		{
+			name:    "scheme and host are case insensitive",
+			pattern: "https://Charts.Example.com/stable",
+			repoURL: "HTTPS://charts.example.COM/stable",
+			matches: true,
+		},
+		{
+			name:    "different scheme",
+			pattern: "https://charts.example.com/stable",
+			repoURL: "http://charts.example.com/stable",
+			matches: false,
+		},
+		{
+			name:    "oci repository",
+			pattern: "oci://registry.example.com/charts/*",
+			repoURL: "oci://registry.example.com/charts/team-a",
+			matches: true,
+		},
+		{
+			name:    "subdomain",
+			pattern: "https://*.example.com",
+			repoURL: "https://charts.example.com",
+			matches: true,
+		},
+		{
+			name:    "subdomain with path",
+			pattern: "https://*.example.com/*",
+			repoURL: "https://charts.example.com/stable/nginx",
+			matches: true,
+		},
+		{
+			name:    "host wildcard doesn't match into the path",
+			pattern: "https://*.example.com",
+			repoURL: "https://attacker.net/x.example.com",
+			matches: false,
+		},
+		{
+			name:    "host wildcard with path doesn't match into the path",
+			pattern: "https://*.example.com/*",
+			repoURL: "https://attacker.net/x.example.com/charts",
+			matches: false,
+		},
+		{
+			name:    "host wildcard doesn't match several labels",
+			pattern: "https://*.example.com",
+			repoURL: "https://a.b.example.com",
+			matches: false,
+		},
+		{
+			name:    "host wildcard doesn't match a suffix",
+			pattern: "https://charts.example.*",
+			repoURL: "https://charts.example.com.attacker.net",
+			matches: false,
+		},
+		{
+			name:    "different domain with allowed domain as subdomain",
+			pattern: "https://*.example.com",
+			repoURL: "https://example.com.attacker.net",
+			matches: false,
+		},
+		{
+			name:    "user info",
+			pattern: "https://charts.example.com/*",
+			repoURL: "https://charts.example.com@attacker.net/charts",
+			matches: false,
+		},
+		{
+			name:    "host wildcard doesn't match the port",
+			pattern: "https://*.example.com",
+			repoURL: "https://charts.example.com:8443",
+			matches: false,
+		},
+		{
+			name:    "explicit port",
+			pattern: "https://charts.example.com:8443",
+			repoURL: "https://charts.example.com:8443",
+			matches: true,
+		},
+		{
+			name:    "path traversal",
+			pattern: "https://charts.example.com/team-a/*",
+			repoURL: "https://charts.example.com/team-a/../team-b",
+			matches: false,
+		},
+		{
+			name:    "encoded path traversal",
+			pattern: "https://charts.example.com/team-a/*",
+			repoURL: "https://charts.example.com/team-a/%2E%2E/team-b",
+			matches: false,
+		},
+		{
+			name:    "path wildcard matches slashes",
+			pattern: "https://charts.example.com/*",
+			repoURL: "https://charts.example.com/team-a/stable",
+			matches: true,
+		},
+		{
+			name:    "path prefix",
+			pattern: "https://charts.example.com/team-a",
+			repoURL: "https://charts.example.com/team-ab",
+			matches: false,
+		},
+		{
+			name:    "URL without host",
+			pattern: "https://*.example.com",
+			repoURL: "charts.example.com",
+			matches: false,
+		},
+		{
+			name:    "pattern without scheme",
+			pattern: "charts.example.com/*",
+			repoURL: "https://charts.example.com/stable",
+			matches: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(matchesRepoURL(tc.pattern, tc.repoURL)).To(Equal(tc.matches))
+		})
+	}
+}
+
+func TestEvaluateChartSourcePolicies(t *testing.T) {
+	policies := []ChartSourcePolicy{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "default"},
+			Spec: ChartSourcePolicySpec{
+				Rules: []ChartSourceRule{
+					{
+						RepoURLs: []string{"https://*.example.com/*"},
+					},
+					{
+						RepoURLs:          []string{"https://charts.vendor.io"},
+						ChartNames:        []string{"vendor-*"},
+						VersionConstraint: ">= 1.2.0",
+					},
+				},
+				NamespaceOverrides: []ChartSourceNamespaceOverride{
+					{
+						Namespaces: []string{"sandbox"},
+						Rules: []ChartSourceRule{
+							{
+								RepoURLs: []string{"*"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		policies []ChartSourcePolicy
+		source   ChartSource
+		allowed  bool
+	}{
+		{
+			name:     "no policies",
+			policies: nil,
+			source:   ChartSource{Namespace: "default", RepoURL: "https://attacker.net", ChartName: "nginx"},
+			allowed:  true,
+		},
+		{
+			name:     "allowed repository",
+			policies: policies,
+			source:   ChartSource{Namespace: "default", RepoURL: "https://charts.example.com/stable", ChartName: "nginx"},
+			allowed:  true,
+		},
+		{
+			name:     "repository with allowed domain in the path",
+			policies: policies,
+			source:   ChartSource{Namespace: "default", RepoURL: "https://attacker.net/x.example.com/stable", ChartName: "nginx"},
+			allowed:  false,
+		},
+		{
+			name:     "allowed chart and version",
+			policies: policies,
+			source:   ChartSource{Namespace: "default", RepoURL: "https://charts.vendor.io", ChartName: "vendor-agent", Version: "1.3.0"},
+			allowed:  true,
+		},
+		{
+			name:     "version not allowed",
+			policies: policies,
+			source:   ChartSource{Namespace: "default", RepoURL: "https://charts.vendor.io", ChartName: "vendor-agent", Version: "1.1.0"},
+			allowed:  false,
+		},
+		{
+			name:     "unresolved version",
+			policies: policies,
+			source:   ChartSource{Namespace: "default", RepoURL: "https://charts.vendor.io", ChartName: "vendor-agent"},
+			allowed:  true,
+		},
+		{
+			name:     "chart name not allowed",
+			policies: policies,
+			source:   ChartSource{Namespace: "default", RepoURL: "https://charts.vendor.io", ChartName: "agent", Version: "1.3.0"},
+			allowed:  false,
+		},
+		{
+			name:     "namespace override",
+			policies: policies,
+			source:   ChartSource{Namespace: "sandbox", RepoURL: "https://attacker.net", ChartName: "nginx"},
+			allowed:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := EvaluateChartSourcePolicies(tc.policies, tc.source)
+			if tc.allowed {
+				g.Expect(err).NotTo(HaveOccurred())
+			} else {
+				g.Expect(IsChartSourceNotAllowed(err)).To(BeTrue())
+			}
+		})
+	}
+}
+
+func TestValidateChartSourceRules(t *testing.T) {
+	testCases := []struct {
+		name      string
+		rules     []ChartSourceRule
+		expectErr bool
+	}{
+		{
+			name:  "valid rules",
+			rules: []ChartSourceRule{{RepoURLs: []string{"*", "https://*.example.com/*", "oci://registry.example.com"}, VersionConstraint: ">= 1.0.0"}},
+		},
+		{
+			name:      "repository URL pattern without scheme",
+			rules:     []ChartSourceRule{{RepoURLs: []string{"*.example.com"}}},
+			expectErr: true,
+		},
+		{
+			name:      "repository URL pattern without host",
+			rules:     []ChartSourceRule{{RepoURLs: []string{"https:///charts"}}},
+			expectErr: true,
+		},
+		{
+			name:      "invalid version constraint",
+			rules:     []ChartSourceRule{{VersionConstraint: "not a constraint"}},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			errs := validateChartSourceRules(field.NewPath("spec", "rules"), tc.rules)
+			if tc.expectErr {
+				g.Expect(errs).NotTo(BeEmpty())
+			} else {
+				g.Expect(errs).To(BeEmpty())
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ChartSourcePolicySpec defines the chart sources that HelmChartProxies and HelmReleaseProxies are allowed to install.
+type ChartSourcePolicySpec struct {
+	// Rules is the list of allowed chart sources in namespaces without a matching NamespaceOverride. A chart is allowed if
+	// it matches any of the rules. If it is empty, no charts are allowed.
+	// +optional
+	Rules []ChartSourceRule `json:"rules,omitempty"`
+
+	// NamespaceOverrides replaces the Rules for specific namespaces. The first override that lists a namespace is used.
+	// +optional
+	NamespaceOverrides []ChartSourceNamespaceOverride `json:"namespaceOverrides,omitempty"`
+}
+
+// ChartSourceRule allows charts matching all of its fields.
+type ChartSourceRule struct {
+	// RepoURLs is a list of patterns matched against the repository URL of the chart, e.g. https://*.example.com/charts/*.
+	// Each pattern is a URL whose scheme, host and path are matched separately. In the scheme and the host, including
+	// its port, a * matches any sequence of characters except . and /, so *.example.com only matches subdomains of
+	// example.com. In the path, a * matches any sequence of characters, including /. The pattern * allows any repository.
+	// If it is empty, any repository is allowed.
+	// +optional
+	RepoURLs []string `json:"repoURLs,omitempty"`
+
+	// ChartNames is a list of glob patterns matched against the chart name. If it is empty, any chart is allowed.
+	// +optional
+	ChartNames []string `json:"chartNames,omitempty"`
+
+	// VersionConstraint is a semantic version constraint the chart version must satisfy, e.g. ">= 1.2.0, < 2.0.0". If it
+	// is empty, any version is allowed.
+	// +optional
+	VersionConstraint string `json:"versionConstraint,omitempty"`
+}
+
+// ChartSourceNamespaceOverride replaces the Rules of a ChartSourcePolicy for a list of namespaces.
+type ChartSourceNamespaceOverride struct {
+	// Namespaces is the list of namespaces this override applies to.
+	Namespaces []string `json:"namespaces"`
+
+	// Rules is the list of allowed chart sources in the namespaces. If it is empty, no charts are allowed.
+	// +optional
+	Rules []ChartSourceRule `json:"rules,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=csp
+// +kubebuilder:storageversion
+
+// ChartSourcePolicy is the Schema for the chartsourcepolicies API. When one or more ChartSourcePolicies exist, a chart
+// can only be installed by a HelmChartProxy or HelmReleaseProxy if every policy allows it.
+type ChartSourcePolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ChartSourcePolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ChartSourcePolicyList contains a list of ChartSourcePolicy
+type ChartSourcePolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ChartSourcePolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ChartSourcePolicy{}, &ChartSourcePolicyList{})
+}
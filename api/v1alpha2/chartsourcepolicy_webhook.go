@@ -0,0 +1,123 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"context"
+
+	"github.com/Masterminds/semver/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var chartsourcepolicylog = logf.Log.WithName("chartsourcepolicy-resource")
+
+// chartSourcePolicyReader is used by the HelmChartProxy and HelmReleaseProxy webhooks to read ChartSourcePolicies. It is
+// set when their webhooks are registered with the manager.
+var chartSourcePolicyReader client.Reader
+
+func (r *ChartSourcePolicy) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-addons-cluster-x-k8s-io-v1alpha2-chartsourcepolicy,mutating=false,failurePolicy=fail,sideEffects=None,groups=addons.cluster.x-k8s.io,resources=chartsourcepolicies,verbs=create;update,versions=v1alpha2,name=vchartsourcepolicy.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &ChartSourcePolicy{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ChartSourcePolicy) ValidateCreate() error {
+	chartsourcepolicylog.Info("validate create", "name", r.Name)
+
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ChartSourcePolicy) ValidateUpdate(old runtime.Object) error {
+	chartsourcepolicylog.Info("validate update", "name", r.Name)
+
+	return r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *ChartSourcePolicy) ValidateDelete() error {
+	chartsourcepolicylog.Info("validate delete", "name", r.Name)
+
+	return nil
+}
+
+func (r *ChartSourcePolicy) validate() error {
+	var allErrs field.ErrorList
+
+	allErrs = append(allErrs, validateChartSourceRules(field.NewPath("spec", "rules"), r.Spec.Rules)...)
+	for i, override := range r.Spec.NamespaceOverrides {
+		overridePath := field.NewPath("spec", "namespaceOverrides").Index(i)
+		if len(override.Namespaces) == 0 {
+			allErrs = append(allErrs, field.Required(overridePath.Child("namespaces"), "at least one namespace is required"))
+		}
+		allErrs = append(allErrs, validateChartSourceRules(overridePath.Child("rules"), override.Rules)...)
+	}
+
+	if len(allErrs) > 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("ChartSourcePolicy").GroupKind(), r.Name, allErrs)
+	}
+
+	return nil
+}
+
+func validateChartSourceRules(path *field.Path, rules []ChartSourceRule) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, rule := range rules {
+		for j, pattern := range rule.RepoURLs {
+			if _, _, _, ok := splitRepoURLPattern(pattern); !ok && pattern != "*" {
+				allErrs = append(allErrs, field.Invalid(path.Index(i).Child("repoURLs").Index(j), pattern, "must be * or a URL with a scheme and a host, e.g. https://*.example.com/charts/*"))
+			}
+		}
+		if rule.VersionConstraint == "" {
+			continue
+		}
+		if _, err := semver.NewConstraint(rule.VersionConstraint); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Index(i).Child("versionConstraint"), rule.VersionConstraint, err.Error()))
+		}
+	}
+
+	return allErrs
+}
+
+// validateChartSourceAllowed returns a field error if a ChartSourcePolicy doesn't allow the chart source.
+func validateChartSourceAllowed(source ChartSource) field.ErrorList {
+	if chartSourcePolicyReader == nil {
+		return nil
+	}
+
+	err := ValidateChartSource(context.TODO(), chartSourcePolicyReader, source)
+	switch {
+	case err == nil:
+		return nil
+	case IsChartSourceNotAllowed(err):
+		return field.ErrorList{field.Forbidden(field.NewPath("spec", "chartName"), err.Error())}
+	default:
+		return field.ErrorList{field.InternalError(field.NewPath("spec"), err)}
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+// HelmChartProxy Conditions and Reasons.
+const (
+	// HelmReleaseProxySpecsUpToDateCondition...
+	HelmReleaseProxySpecsUpToDateCondition clusterv1.ConditionType = "HelmReleaseProxySpecsUpToDate"
+
+	// HelmReleaseProxyCreationFailedReason...
+	HelmReleaseProxyCreationFailedReason = "HelmReleaseProxyCreationFailed"
+	// HelmReleaseProxyDeletionFailedReason...
+	HelmReleaseProxyDeletionFailedReason = "HelmReleaseProxyDeletionFailed"
+	// HelmReleaseProxyGetFailedReason indicates that the existing HelmReleaseProxy for a Cluster could not be retrieved.
+	HelmReleaseProxyGetFailedReason = "HelmReleaseProxyGetFailed"
+	// HelmReleaseProxyReinstallingReason...
+	HelmReleaseProxyReinstallingReason = "HelmReleaseProxyReinstalling"
+	// ReinstallBlockedReason indicates that the Helm release on a Cluster must be reinstalled because an immutable field
+	// changed, but the reinstall strategy doesn't allow it.
+	ReinstallBlockedReason = "ReinstallBlocked"
+	// ValueParsingFailedReason is ...
+	ValueParsingFailedReason = "ValueParsingFailed"
+	// PostRendererParsingFailedReason indicates that the Go templating in the post-renderer patches failed to render for a Cluster.
+	PostRendererParsingFailedReason = "PostRendererParsingFailed"
+	// RegistryMirrorsFailedReason indicates that the registry mirrors configured on the manager could not be read.
+	RegistryMirrorsFailedReason = "RegistryMirrorsFailed"
+	// ClusterSelectionFailedReason is ...
+	ClusterSelectionFailedReason = "ClusterSelectionFailed"
+	// ChartLoadFailedReason indicates that the chart could not be fetched to validate the values against its schema.
+	ChartLoadFailedReason = "ChartLoadFailed"
+	// ValuesSchemaValidationFailedReason indicates that the rendered values for one or more Clusters do not match the
+	// chart's values.schema.json.
+	ValuesSchemaValidationFailedReason = "ValuesSchemaValidationFailed"
+	// ValueOverridesFailedReason indicates that the value overrides of one or more Clusters could not be applied.
+	ValueOverridesFailedReason = "ValueOverridesFailed"
+
+	// HelmReleaseProxiesReadyCondition...
+	HelmReleaseProxiesReadyCondition clusterv1.ConditionType = "HelmReleaseProxiesReady"
+)
+
+// HelmReleaseProxy Conditions and Reasons.
+const (
+	// HelmReleaseReadyCondition reports on current status of the HelmRelease managed by the HelmChartProxy.
+	HelmReleaseReadyCondition clusterv1.ConditionType = "HelmReleaseReady"
+	// PreparingToHelmInstallReason is ...
+	PreparingToHelmInstallReason = "PreparingToHelmInstall"
+	// HelmInstallOrUpgradeFailedReason indicates that the Helm release could not be installed or upgraded for a reason
+	// that doesn't match a more specific one.
+	HelmInstallOrUpgradeFailedReason = "HelmInstallOrUpgradeFailed"
+	// ChartNotFoundReason indicates that the chart or chart version doesn't exist in the repository.
+	ChartNotFoundReason = "ChartNotFound"
+	// RepositoryAuthFailedReason indicates that the chart repository rejected the credentials or requires credentials.
+	RepositoryAuthFailedReason = "RepositoryAuthFailed"
+	// ChartFetchFailedReason indicates that the chart could not be fetched from its repository, e.g. because the
+	// repository could not be reached.
+	ChartFetchFailedReason = "ChartFetchFailed"
+	// ValuesInvalidReason indicates that the values could not be parsed, don't match the chart's values.schema.json or
+	// were rejected by the chart templates.
+	ValuesInvalidReason = "ValuesInvalid"
+	// KubernetesVersionIncompatibleReason indicates that the chart doesn't support the Kubernetes version of the Cluster.
+	KubernetesVersionIncompatibleReason = "KubernetesVersionIncompatible"
+	// ResourceKindNotFoundReason indicates that the chart uses a resource kind the Cluster doesn't serve, e.g. because
+	// its CRD is installed by another release that isn't ready yet.
+	ResourceKindNotFoundReason = "ResourceKindNotFound"
+	// ClusterUnreachableReason indicates that the API server of the Cluster could not be reached.
+	ClusterUnreachableReason = "ClusterUnreachable"
+	// ReleasePendingReason indicates that another install, upgrade or rollback of the Helm release is in progress, or
+	// left the release in a pending state.
+	ReleasePendingReason = "ReleasePending"
+	// HookFailedReason indicates that a hook of the chart failed during the install or upgrade.
+	HookFailedReason = "HookFailed"
+	// HelmReleaseDeletionFailedReason is ...
+	HelmReleaseDeletionFailedReason = "HelmReleaseDeletionFailed"
+	// HelmReleaseDeletedReason is ...
+	HelmReleaseDeletedReason = "HelmReleaseDeleted"
+	// DeletingCRDsReason indicates that the release is uninstalled once the CRDs of its chart and their custom resources
+	// are removed.
+	DeletingCRDsReason = "DeletingCRDs"
+	// HelmReleaseGetFailedReason is ...
+	HelmReleaseGetFailedReason = "HelmReleaseGetFailed"
+	// HelmStorageConfigFailedReason indicates that the Helm storage driver of the release could not be configured.
+	HelmStorageConfigFailedReason = "HelmStorageConfigFailed"
+	// ChartSourceNotAllowedReason indicates that a ChartSourcePolicy doesn't allow the chart version resolved at install time.
+	ChartSourceNotAllowedReason = "ChartSourceNotAllowed"
+	// ChartSourcePolicyCheckFailedReason indicates that the ChartSourcePolicies could not be evaluated for the chart.
+	ChartSourcePolicyCheckFailedReason = "ChartSourcePolicyCheckFailed"
+	// ImpersonationNotAllowedReason indicates that the manager doesn't allow Helm to manage the release with the identity of
+	// the HelmReleaseProxy.
+	ImpersonationNotAllowedReason = "ImpersonationNotAllowed"
+
+	// ClusterAvailableCondition...
+	ClusterAvailableCondition clusterv1.ConditionType = "ClusterAvailable"
+	// GetClusterFailedReason is ...
+	GetClusterFailedReason = "GetClusterFailed"
+	// GetKubeconfigFailedReason is ...
+	GetKubeconfigFailedReason = "GetKubeconfigFailed"
+	// WaitingForClusterReadinessReason indicates that the Helm release is waiting for the Cluster readiness conditions
+	// to be true before it is installed.
+	WaitingForClusterReadinessReason = "WaitingForClusterReadiness"
+
+	// ClusterTLSVerifiedCondition reports whether Helm verifies the API server certificate of the Cluster.
+	ClusterTLSVerifiedCondition clusterv1.ConditionType = "ClusterTLSVerified"
+	// InsecureSkipTLSVerifyReason indicates that TLS verification is disabled by the insecure-skip-tls-verify annotation on the Cluster.
+	InsecureSkipTLSVerifyReason = "InsecureSkipTLSVerify"
+
+	// ReleaseTestsPassedCondition reports whether the test hooks of the current revision of the Helm release passed.
+	ReleaseTestsPassedCondition clusterv1.ConditionType = "ReleaseTestsPassed"
+	// ReleaseTestsFailedReason indicates that one or more test hooks of the Helm release failed or timed out.
+	ReleaseTestsFailedReason = "ReleaseTestsFailed"
+	// ReleaseTestsRunFailedReason indicates that the test hooks of the Helm release could not be run.
+	ReleaseTestsRunFailedReason = "ReleaseTestsRunFailed"
+	// ReleaseRolledBackReason indicates that the upgrade of the Helm release was rolled back because its test hooks failed.
+	ReleaseRolledBackReason = "ReleaseRolledBack"
+
+	// PausedCondition is true while the reconciliation of a HelmReleaseProxy is paused, including the uninstall of its Helm
+	// release when it is deleted.
+	PausedCondition clusterv1.ConditionType = "Paused"
+	// ClusterPausedReason indicates that the Cluster of the HelmReleaseProxy is paused.
+	ClusterPausedReason = "ClusterPaused"
+	// PausedAnnotationReason indicates that the HelmReleaseProxy has the paused annotation.
+	PausedAnnotationReason = "PausedAnnotation"
+)
@@ -0,0 +1,324 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+const (
+	// HelmChartProxyFinalizer is the finalizer used by the HelmChartProxy controller to cleanup add-on resources when
+	// a HelmChartProxy is being deleted.
+	HelmChartProxyFinalizer = "helmchartproxy.addons.cluster.x-k8s.io"
+
+	// ValueOverridesAnnotationPrefix is the prefix of the Cluster annotation holding YAML values that override the values
+	// rendered from the ValuesTemplate of a HelmChartProxy for that Cluster. The annotation key is the prefix followed by the
+	// name of the HelmChartProxy, e.g. "values.addons.cluster.x-k8s.io/nginx-ingress".
+	ValueOverridesAnnotationPrefix = "values.addons.cluster.x-k8s.io/"
+
+	// ReconcileRequestedAtAnnotation requests an immediate reconcile of a HelmChartProxy or HelmReleaseProxy when its value,
+	// e.g. a timestamp, changes. The value set on a HelmChartProxy is copied to its HelmReleaseProxies.
+	ReconcileRequestedAtAnnotation = "reconcile.addons.cluster.x-k8s.io/requested-at"
+
+	// ForceUpgradeAtAnnotation requests an upgrade of the Helm release of a HelmReleaseProxy when its value changes, even
+	// if the chart and values are unchanged. The value set on a HelmChartProxy is copied to its HelmReleaseProxies.
+	ForceUpgradeAtAnnotation = "reconcile.addons.cluster.x-k8s.io/force-upgrade-at"
+
+	// ForceReinstallAtAnnotation requests an uninstall and install of the Helm release of a HelmReleaseProxy when its value
+	// changes. The value set on a HelmChartProxy is copied to its HelmReleaseProxies.
+	ForceReinstallAtAnnotation = "reconcile.addons.cluster.x-k8s.io/force-reinstall-at"
+)
+
+// ReconcileRequestAnnotations are the annotations that request an action when their value changes.
+var ReconcileRequestAnnotations = []string{ReconcileRequestedAtAnnotation, ForceUpgradeAtAnnotation, ForceReinstallAtAnnotation}
+
+// HelmChartProxySpec defines the desired state of HelmChartProxy.
+type HelmChartProxySpec struct {
+	// ClusterSelector selects Clusters in the same namespace with a label that matches the specified label selector. The Helm
+	// chart will be installed on all selected Clusters. If a Cluster is no longer selected, the Helm release will be uninstalled.
+	ClusterSelector metav1.LabelSelector `json:"clusterSelector"`
+
+	// ChartName is the name of the Helm chart in the repository.
+	ChartName string `json:"chartName"`
+
+	// RepoURL is the URL of the Helm chart repository.
+	RepoURL string `json:"repoURL"`
+
+	// ReleaseName is the release name of the installed Helm chart. If it is not specified, a name will be generated.
+	// +optional
+	ReleaseName string `json:"releaseName,omitempty"`
+
+	// ReleaseNamespace is the namespace the Helm release will be installed on each selected
+	// Cluster. If it is not specified, it will be set to the default namespace.
+	// +optional
+	ReleaseNamespace string `json:"namespace,omitempty"`
+
+	// Version is the version of the Helm chart. If it is not specified, the chart will use
+	// and be kept up to date with the latest version.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Values are the structured values for the Helm chart that are the same for every selected Cluster. Unlike the
+	// ValuesTemplate, they can be patched and validated as regular fields.
+	// +optional
+	Values *apiextensionsv1.JSON `json:"values,omitempty"`
+
+	// ValuesTemplate is an inline YAML representing the values for the Helm chart. This YAML supports Go templating to reference
+	// fields from each selected workload Cluster and programatically create and set values. The rendered values are deep-merged
+	// over Values, and values from the ValueOverridesAnnotationPrefix annotation of a Cluster are deep-merged over the result
+	// for that Cluster.
+	// +optional
+	ValuesTemplate string `json:"valuesTemplate,omitempty"`
+
+	// ClusterReadinessConditions is a list of Cluster condition types, e.g. ControlPlaneInitialized or InfrastructureReady,
+	// that must be true on a selected Cluster before the Helm chart is installed on it. If it is not specified, the chart
+	// is installed as soon as the Cluster is selected.
+	// +optional
+	ClusterReadinessConditions []clusterv1.ConditionType `json:"clusterReadinessConditions,omitempty"`
+
+	// PostRenderers modifies the manifests rendered by Helm before they are applied to each selected Cluster, e.g. to
+	// patch resources that the chart values do not expose. Hooks of the chart, such as pre-install Jobs, are modified too.
+	// The release is upgraded when the post-renderers change.
+	// +optional
+	PostRenderers *PostRenderers `json:"postRenderers,omitempty"`
+
+	// RegistryMirrors maps image registries, optionally followed by a repository path, to the mirror that container images
+	// from the registry are pulled from instead, e.g. docker.io: registry.internal/dockerhub. The images in the rendered
+	// manifests and hooks are rewritten before they are applied. These mirrors take precedence over the mirrors configured
+	// on the manager.
+	// +optional
+	RegistryMirrors map[string]string `json:"registryMirrors,omitempty"`
+
+	// ServiceAccountName is the name of a ServiceAccount in the ReleaseNamespace on each selected Cluster that Helm
+	// impersonates to manage the release, instead of using the credentials from the Cluster kubeconfig. The ServiceAccount
+	// must be allowed to manage the resources of the chart and the Helm release storage. It cannot be set together with Impersonate
+	// and must be on the impersonation allowlist of the manager for the namespace of the HelmChartProxy. If neither is set,
+	// the manager can enforce a default ServiceAccount.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Impersonate is a user and groups on each selected Cluster that Helm impersonates to manage the release, instead of using
+	// the credentials from the Cluster kubeconfig. It cannot be set together with ServiceAccountName, and the user and groups
+	// must be on the impersonation allowlist of the manager for the namespace of the HelmChartProxy.
+	// +optional
+	Impersonate *ImpersonationConfig `json:"impersonate,omitempty"`
+
+	// Storage configures where Helm stores the release on each selected Cluster. If it is not specified, the manager default
+	// is used. Changing it reinstalls the release on every selected Cluster.
+	// +optional
+	Storage *HelmStorage `json:"storage,omitempty"`
+
+	// Tests configures running the test hooks of the chart after the release is installed or upgraded on each selected Cluster.
+	// +optional
+	Tests *ReleaseTests `json:"tests,omitempty"`
+
+	// CRDs configures how the CRDs in the crds/ directory of the chart are managed on each selected Cluster.
+	// +optional
+	CRDs *CRDs `json:"crds,omitempty"`
+
+	// ReinstallStrategy is how the Helm release on a selected Cluster is replaced when the ChartName, RepoURL, ReleaseName,
+	// ReleaseNamespace or Storage changes, since they can't be changed on an existing release. Defaults to Recreate.
+	// +kubebuilder:default=Recreate
+	// +optional
+	ReinstallStrategy ReinstallStrategy `json:"reinstallStrategy,omitempty"`
+}
+
+// ReinstallStrategy is how a Helm release is replaced when one of its immutable fields changes.
+// +kubebuilder:validation:Enum=Recreate;Block;CreateBeforeDelete
+type ReinstallStrategy string
+
+const (
+	// ReinstallStrategyRecreate uninstalls the old release and installs the new one once the uninstall completes.
+	ReinstallStrategyRecreate ReinstallStrategy = "Recreate"
+	// ReinstallStrategyBlock keeps the old release and reports the change in the HelmReleaseProxySpecsUpToDate condition
+	// until the immutable fields are reverted or the strategy is changed.
+	ReinstallStrategyBlock ReinstallStrategy = "Block"
+	// ReinstallStrategyCreateBeforeDelete installs the new release first and uninstalls the old one once the new one is
+	// ready. The new release must have a different release name or namespace than the old one.
+	ReinstallStrategyCreateBeforeDelete ReinstallStrategy = "CreateBeforeDelete"
+)
+
+// HelmChartProxyStatus defines the observed state of HelmChartProxy.
+type HelmChartProxyStatus struct {
+	// Conditions defines current state of the HelmChartProxy.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+
+	// MatchingClusters is the list of references to Clusters selected by the ClusterSelector.
+	// +optional
+	MatchingClusters []corev1.ObjectReference `json:"matchingClusters"`
+
+	// MatchingClustersCount is the number of Clusters selected by the ClusterSelector.
+	// +optional
+	MatchingClustersCount int32 `json:"matchingClustersCount"`
+
+	// InstalledClustersCount is the number of selected Clusters where the Helm release has been installed.
+	// +optional
+	InstalledClustersCount int32 `json:"installedClustersCount"`
+
+	// ReadyClustersCount is the number of selected Clusters whose HelmReleaseProxy is ready.
+	// +optional
+	ReadyClustersCount int32 `json:"readyClustersCount"`
+
+	// FailedClustersCount is the number of selected Clusters where the Helm release failed to be installed or upgraded.
+	// +optional
+	FailedClustersCount int32 `json:"failedClustersCount"`
+
+	// UpgradingClustersCount is the number of selected Clusters whose Helm release is being installed or upgraded to the
+	// latest spec of their HelmReleaseProxy.
+	// +optional
+	UpgradingClustersCount int32 `json:"upgradingClustersCount"`
+
+	// ReadySummary summarizes the number of ready Clusters out of the selected Clusters, e.g. "2/3".
+	// +optional
+	ReadySummary string `json:"readySummary,omitempty"`
+
+	// ClusterStatuses is the status of the Helm release on each selected Cluster.
+	// +optional
+	ClusterStatuses []HelmChartProxyClusterStatus `json:"clusterStatuses,omitempty"`
+
+	ReconcileRequestStatus `json:",inline"`
+}
+
+// ReconcileRequestStatus records the values of the reconcile request annotations that were last handled, so that each
+// requested action runs once.
+type ReconcileRequestStatus struct {
+	// LastHandledReconcileAt is the last handled value of the ReconcileRequestedAtAnnotation.
+	// +optional
+	LastHandledReconcileAt string `json:"lastHandledReconcileAt,omitempty"`
+
+	// LastHandledForceUpgradeAt is the last handled value of the ForceUpgradeAtAnnotation.
+	// +optional
+	LastHandledForceUpgradeAt string `json:"lastHandledForceUpgradeAt,omitempty"`
+
+	// LastHandledForceReinstallAt is the last handled value of the ForceReinstallAtAnnotation.
+	// +optional
+	LastHandledForceReinstallAt string `json:"lastHandledForceReinstallAt,omitempty"`
+}
+
+// GetLastHandled returns the last handled value of a reconcile request annotation.
+func (s *ReconcileRequestStatus) GetLastHandled(annotation string) string {
+	switch annotation {
+	case ReconcileRequestedAtAnnotation:
+		return s.LastHandledReconcileAt
+	case ForceUpgradeAtAnnotation:
+		return s.LastHandledForceUpgradeAt
+	case ForceReinstallAtAnnotation:
+		return s.LastHandledForceReinstallAt
+	default:
+		return ""
+	}
+}
+
+// SetLastHandled records the last handled value of a reconcile request annotation.
+func (s *ReconcileRequestStatus) SetLastHandled(annotation string, value string) {
+	switch annotation {
+	case ReconcileRequestedAtAnnotation:
+		s.LastHandledReconcileAt = value
+	case ForceUpgradeAtAnnotation:
+		s.LastHandledForceUpgradeAt = value
+	case ForceReinstallAtAnnotation:
+		s.LastHandledForceReinstallAt = value
+	}
+}
+
+// HelmChartProxyClusterStatus summarizes the state of the Helm release on a single selected Cluster.
+type HelmChartProxyClusterStatus struct {
+	// ClusterName is the name of the selected Cluster.
+	ClusterName string `json:"clusterName"`
+
+	// HelmReleaseProxyName is the name of the HelmReleaseProxy managing the Helm release on the Cluster.
+	// +optional
+	HelmReleaseProxyName string `json:"helmReleaseProxyName,omitempty"`
+
+	// Version is the chart version of the current Helm release on the Cluster.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Revision is the current revision of the Helm release on the Cluster.
+	// +optional
+	Revision int `json:"revision,omitempty"`
+
+	// Ready is the status of the Ready condition of the HelmReleaseProxy.
+	// +optional
+	Ready corev1.ConditionStatus `json:"ready,omitempty"`
+
+	// LastError is the most recent error reported for the Cluster, if any.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+// +kubebuilder:printcolumn:name="Clusters",type="string",JSONPath=".status.readySummary",description="Ready Clusters out of the selected Clusters"
+// +kubebuilder:printcolumn:name="Failed",type="integer",JSONPath=".status.failedClustersCount",description="Number of selected Clusters where the Helm release failed"
+// +kubebuilder:printcolumn:name="Upgrading",type="integer",priority=1,JSONPath=".status.upgradingClustersCount",description="Number of selected Clusters with a Helm operation in progress"
+// +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].reason"
+// +kubebuilder:printcolumn:name="Message",type="string",priority=1,JSONPath=".status.conditions[?(@.type=='Ready')].message"
+// +kubebuilder:resource:shortName=hcp
+// +kubebuilder:storageversion
+
+// HelmChartProxy is the Schema for the helmchartproxies API
+type HelmChartProxy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   HelmChartProxySpec   `json:"spec,omitempty"`
+	Status HelmChartProxyStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// HelmChartProxyList contains a list of HelmChartProxy
+type HelmChartProxyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []HelmChartProxy `json:"items"`
+}
+
+// GetConditions returns the list of conditions for an HelmChartProxy API object.
+func (c *HelmChartProxy) GetConditions() clusterv1.Conditions {
+	return c.Status.Conditions
+}
+
+// SetConditions will set the given conditions on an HelmChartProxy object.
+func (c *HelmChartProxy) SetConditions(conditions clusterv1.Conditions) {
+	c.Status.Conditions = conditions
+}
+
+func (c *HelmChartProxy) SetMatchingClusters(clusterList []clusterv1.Cluster) {
+	matchingClusters := make([]corev1.ObjectReference, 0, len(clusterList))
+	for _, cluster := range clusterList {
+		matchingClusters = append(matchingClusters, corev1.ObjectReference{
+			Kind:       cluster.Kind,
+			APIVersion: cluster.APIVersion,
+			Name:       cluster.Name,
+			Namespace:  cluster.Namespace,
+		})
+	}
+
+	c.Status.MatchingClusters = matchingClusters
+	c.Status.MatchingClustersCount = int32(len(matchingClusters))
+}
+
+func init() {
+	SchemeBuilder.Register(&HelmChartProxy{}, &HelmChartProxyList{})
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var helmchartproxylog = logf.Log.WithName("helmchartproxy-resource")
+
+func (r *HelmChartProxy) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	chartSourcePolicyReader = mgr.GetClient()
+
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-addons-cluster-x-k8s-io-v1alpha2-helmchartproxy,mutating=true,failurePolicy=fail,sideEffects=None,groups=addons.cluster.x-k8s.io,resources=helmchartproxies,verbs=create;update,versions=v1alpha2,name=mhelmchartproxy.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &HelmChartProxy{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (p *HelmChartProxy) Default() {
+	helmchartproxylog.Info("default", "name", p.Name)
+
+	if p.Spec.ReleaseNamespace == "" {
+		p.Spec.ReleaseNamespace = "default"
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-addons-cluster-x-k8s-io-v1alpha2-helmchartproxy,mutating=false,failurePolicy=fail,sideEffects=None,groups=addons.cluster.x-k8s.io,resources=helmchartproxies,verbs=create;update,versions=v1alpha2,name=vhelmchartproxy.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &HelmChartProxy{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *HelmChartProxy) ValidateCreate() error {
+	helmchartproxylog.Info("validate create", "name", r.Name)
+
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, validateImpersonation(r.Namespace, r.Spec.ReleaseNamespace, r.Spec.ServiceAccountName, r.Spec.Impersonate)...)
+	allErrs = append(allErrs, validateTests(r.Spec.Tests)...)
+	allErrs = append(allErrs, validateValues(r.Spec.Values)...)
+	allErrs = append(allErrs, validateStorage(r.Spec.Storage)...)
+	allErrs = append(allErrs, validateChartSourceAllowed(r.chartSource())...)
+
+	if len(allErrs) > 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("HelmChartProxy").GroupKind(), r.Name, allErrs)
+	}
+
+	return nil
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *HelmChartProxy) ValidateUpdate(oldRaw runtime.Object) error {
+	helmchartproxylog.Info("validate update", "name", r.Name)
+
+	var allErrs field.ErrorList
+	old := oldRaw.(*HelmChartProxy)
+
+	allErrs = append(allErrs, validateImpersonation(r.Namespace, r.Spec.ReleaseNamespace, r.Spec.ServiceAccountName, r.Spec.Impersonate)...)
+	allErrs = append(allErrs, validateTests(r.Spec.Tests)...)
+	allErrs = append(allErrs, validateValues(r.Spec.Values)...)
+	allErrs = append(allErrs, validateStorage(r.Spec.Storage)...)
+
+	// Only check the policies when the chart source changes so that existing HelmChartProxies can still be updated and deleted.
+	if r.chartSource() != old.chartSource() {
+		allErrs = append(allErrs, validateChartSourceAllowed(r.chartSource())...)
+	}
+
+	if len(allErrs) > 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("HelmChartProxy").GroupKind(), r.Name, allErrs)
+	}
+
+	return nil
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *HelmChartProxy) ValidateDelete() error {
+	helmchartproxylog.Info("validate delete", "name", r.Name)
+
+	// Deleting a HelmChartProxy is always allowed, its HelmReleaseProxies are deleted with it.
+	return nil
+}
+
+func (r *HelmChartProxy) chartSource() ChartSource {
+	return ChartSource{
+		Namespace: r.Namespace,
+		RepoURL:   r.Spec.RepoURL,
+		ChartName: r.Spec.ChartName,
+		Version:   r.Spec.Version,
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"encoding/json"
+	"reflect"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var helmreleaseproxylog = logf.Log.WithName("helmreleaseproxy-resource")
+
+func (r *HelmReleaseProxy) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	chartSourcePolicyReader = mgr.GetClient()
+
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-addons-cluster-x-k8s-io-v1alpha2-helmreleaseproxy,mutating=true,failurePolicy=fail,sideEffects=None,groups=addons.cluster.x-k8s.io,resources=helmreleaseproxies,verbs=create;update,versions=v1alpha2,name=mhelmreleaseproxy.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &HelmReleaseProxy{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (p *HelmReleaseProxy) Default() {
+	helmreleaseproxylog.Info("default", "name", p.Name)
+
+	if p.Spec.ReleaseNamespace == "" {
+		p.Spec.ReleaseNamespace = "default"
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-addons-cluster-x-k8s-io-v1alpha2-helmreleaseproxy,mutating=false,failurePolicy=fail,sideEffects=None,groups=addons.cluster.x-k8s.io,resources=helmreleaseproxies,verbs=create;update,versions=v1alpha2,name=vhelmreleaseproxy.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &HelmReleaseProxy{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *HelmReleaseProxy) ValidateCreate() error {
+	helmreleaseproxylog.Info("validate create", "name", r.Name)
+
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, validateImpersonation(r.Namespace, r.Spec.ReleaseNamespace, r.Spec.ServiceAccountName, r.Spec.Impersonate)...)
+	allErrs = append(allErrs, validateTests(r.Spec.Tests)...)
+	allErrs = append(allErrs, validateValues(r.Spec.Values)...)
+	allErrs = append(allErrs, validateStorage(r.Spec.Storage)...)
+	allErrs = append(allErrs, validateChartSourceAllowed(r.chartSource())...)
+
+	if len(allErrs) > 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("HelmReleaseProxy").GroupKind(), r.Name, allErrs)
+	}
+
+	return nil
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *HelmReleaseProxy) ValidateUpdate(oldRaw runtime.Object) error {
+	helmreleaseproxylog.Info("validate update", "name", r.Name)
+
+	var allErrs field.ErrorList
+	old := oldRaw.(*HelmReleaseProxy)
+
+	if !reflect.DeepEqual(r.Spec.RepoURL, old.Spec.RepoURL) {
+		allErrs = append(allErrs,
+			field.Invalid(field.NewPath("spec", "RepoURL"),
+				r.Spec.RepoURL, "field is immutable"),
+		)
+	}
+
+	if !reflect.DeepEqual(r.Spec.ChartName, old.Spec.ChartName) {
+		allErrs = append(allErrs,
+			field.Invalid(field.NewPath("spec", "ChartName"),
+				r.Spec.ChartName, "field is immutable"),
+		)
+	}
+
+	if !reflect.DeepEqual(r.Spec.ReleaseNamespace, old.Spec.ReleaseNamespace) {
+		allErrs = append(allErrs,
+			field.Invalid(field.NewPath("spec", "ReleaseNamespace"),
+				r.Spec.ReleaseNamespace, "field is immutable"),
+		)
+	}
+
+	if !reflect.DeepEqual(r.Spec.Storage, old.Spec.Storage) {
+		allErrs = append(allErrs,
+			field.Invalid(field.NewPath("spec", "Storage"),
+				r.Spec.Storage, "field is immutable"),
+		)
+	}
+
+	// TODO: add webhook for ReleaseName. Currently it's being set if the release name is generated.
+
+	allErrs = append(allErrs, validateImpersonation(r.Namespace, r.Spec.ReleaseNamespace, r.Spec.ServiceAccountName, r.Spec.Impersonate)...)
+	allErrs = append(allErrs, validateTests(r.Spec.Tests)...)
+	allErrs = append(allErrs, validateValues(r.Spec.Values)...)
+
+	// Only check the policies when the chart source changes so that existing HelmReleaseProxies can still be updated and deleted.
+	if r.chartSource() != old.chartSource() {
+		allErrs = append(allErrs, validateChartSourceAllowed(r.chartSource())...)
+	}
+
+	if len(allErrs) > 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("HelmReleaseProxy").GroupKind(), r.Name, allErrs)
+	}
+
+	return nil
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *HelmReleaseProxy) ValidateDelete() error {
+	helmreleaseproxylog.Info("validate delete", "name", r.Name)
+
+	// Delete validation is intentionally a no-op, the controller uninstalls the release when the HelmReleaseProxy is deleted.
+	return nil
+}
+
+func (r *HelmReleaseProxy) chartSource() ChartSource {
+	return ChartSource{
+		Namespace: r.Namespace,
+		RepoURL:   r.Spec.RepoURL,
+		ChartName: r.Spec.ChartName,
+		Version:   r.Spec.Version,
+	}
+}
+
+// validateImpersonation returns a field error if both a ServiceAccount and an identity to impersonate are set, the
+// identity has no username, or the identity is not on the impersonation allowlist of the namespace.
+func validateImpersonation(namespace string, releaseNamespace string, serviceAccountName string, impersonate *ImpersonationConfig) field.ErrorList {
+	var allErrs field.ErrorList
+	if serviceAccountName == "" && impersonate == nil {
+		return allErrs
+	}
+
+	if serviceAccountName != "" && impersonate != nil {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "impersonate"), "cannot be set together with spec.serviceAccountName"))
+	}
+	if serviceAccountName == "" && impersonate.User == "" {
+		allErrs = append(allErrs, field.Required(field.NewPath("spec", "impersonate", "user"), "user is required to impersonate groups"))
+	}
+
+	user, groups := impersonatedUser(releaseNamespace, serviceAccountName, impersonate)
+	if err := impersonationAllowlist.Check(namespace, user, groups); err != nil {
+		path := field.NewPath("spec", "impersonate")
+		if serviceAccountName != "" {
+			path = field.NewPath("spec", "serviceAccountName")
+		}
+		allErrs = append(allErrs, field.Forbidden(path, err.Error()))
+	}
+
+	return allErrs
+}
+
+// validateStorage returns a field error if the SQL connection Secret is missing for the sql driver or set for another driver.
+func validateStorage(storage *HelmStorage) field.ErrorList {
+	var allErrs field.ErrorList
+	if storage == nil {
+		return allErrs
+	}
+
+	secretRefPath := field.NewPath("spec", "storage", "sqlConnectionSecretRef")
+	switch {
+	case storage.Driver == HelmStorageDriverSQL && storage.SQLConnectionSecretRef == nil:
+		allErrs = append(allErrs, field.Required(secretRefPath, "a connection Secret is required for the sql driver"))
+	case storage.Driver != HelmStorageDriverSQL && storage.SQLConnectionSecretRef != nil:
+		allErrs = append(allErrs, field.Forbidden(secretRefPath, "a connection Secret can only be set for the sql driver"))
+	}
+
+	return allErrs
+}
+
+// validateTests returns a field error if the timeout of the release tests is not positive.
+func validateTests(tests *ReleaseTests) field.ErrorList {
+	var allErrs field.ErrorList
+	if tests == nil || tests.Timeout == nil {
+		return allErrs
+	}
+
+	if tests.Timeout.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "tests", "timeout"), tests.Timeout.Duration.String(), "must be positive"))
+	}
+
+	return allErrs
+}
+
+// validateValues returns a field error if the structured values are not an object.
+func validateValues(values *apiextensionsv1.JSON) field.ErrorList {
+	var allErrs field.ErrorList
+	if values == nil {
+		return allErrs
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(values.Raw, &decoded); err != nil {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "values"), string(values.Raw), "must be an object"))
+	}
+
+	return allErrs
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateImpersonation(t *testing.T) {
+	g := NewWithT(t)
+
+	allowlist, err := ParseImpersonationAllowlist("default=helm-operator,default=group:platform-team,default=system:serviceaccount:monitoring:helm,*=system:serviceaccount:tenant:helm")
+	g.Expect(err).NotTo(HaveOccurred())
+	SetImpersonationAllowlist(allowlist)
+	defer SetImpersonationAllowlist(ImpersonationAllowlist{})
+
+	tests := []struct {
+		name               string
+		namespace          string
+		releaseNamespace   string
+		serviceAccountName string
+		impersonate        *ImpersonationConfig
+		wantErr            bool
+	}{
+		{
+			name:             "kubeconfig credentials",
+			releaseNamespace: "default",
+		},
+		{
+			name:               "service account in the release namespace",
+			releaseNamespace:   "monitoring",
+			serviceAccountName: "helm",
+		},
+		{
+			name:             "user and groups",
+			releaseNamespace: "default",
+			impersonate:      &ImpersonationConfig{User: "helm-operator", Groups: []string{"platform-team"}},
+		},
+		{
+			name:             "service account user",
+			releaseNamespace: "default",
+			impersonate:      &ImpersonationConfig{User: "system:serviceaccount:monitoring:helm"},
+		},
+		{
+			name:               "service account and user",
+			releaseNamespace:   "default",
+			serviceAccountName: "helm",
+			impersonate:        &ImpersonationConfig{User: "helm-operator"},
+			wantErr:            true,
+		},
+		{
+			name:             "groups without user",
+			releaseNamespace: "default",
+			impersonate:      &ImpersonationConfig{Groups: []string{"platform-team"}},
+			wantErr:          true,
+		},
+		{
+			name:             "user in another namespace",
+			namespace:        "tenant",
+			releaseNamespace: "default",
+			impersonate:      &ImpersonationConfig{User: "helm-operator", Groups: []string{"platform-team"}},
+			wantErr:          true,
+		},
+		{
+			name:             "user allowed in every namespace",
+			namespace:        "tenant",
+			releaseNamespace: "default",
+			impersonate:      &ImpersonationConfig{User: "system:serviceaccount:tenant:helm"},
+		},
+		{
+			name:             "group that is not allowed",
+			releaseNamespace: "default",
+			impersonate:      &ImpersonationConfig{User: "helm-operator", Groups: []string{"system:masters"}},
+			wantErr:          true,
+		},
+		{
+			name:             "user that is not allowed",
+			releaseNamespace: "default",
+			impersonate:      &ImpersonationConfig{User: "system:admin"},
+			wantErr:          true,
+		},
+		{
+			name:               "service account that is not allowed",
+			releaseNamespace:   "kube-system",
+			serviceAccountName: "clusterrole-aggregation-controller",
+			wantErr:            true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			namespace := tt.namespace
+			if namespace == "" {
+				namespace = "default"
+			}
+			helmReleaseProxy := &HelmReleaseProxy{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-hrp", Namespace: namespace},
+				Spec: HelmReleaseProxySpec{
+					ChartName:          "nginx",
+					RepoURL:            "https://charts.example.com",
+					ReleaseNamespace:   tt.releaseNamespace,
+					ServiceAccountName: tt.serviceAccountName,
+					Impersonate:        tt.impersonate,
+				},
+			}
+			helmChartProxy := &HelmChartProxy{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-hcp", Namespace: namespace},
+				Spec: HelmChartProxySpec{
+					ChartName:          "nginx",
+					RepoURL:            "https://charts.example.com",
+					ReleaseNamespace:   tt.releaseNamespace,
+					ServiceAccountName: tt.serviceAccountName,
+					Impersonate:        tt.impersonate,
+				},
+			}
+
+			if tt.wantErr {
+				g.Expect(helmReleaseProxy.ValidateCreate()).NotTo(Succeed())
+				g.Expect(helmChartProxy.ValidateCreate()).NotTo(Succeed())
+			} else {
+				g.Expect(helmReleaseProxy.ValidateCreate()).To(Succeed())
+				g.Expect(helmChartProxy.ValidateCreate()).To(Succeed())
+			}
+		})
+	}
+}
+
+func TestParseImpersonationAllowlist(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		namespace string
+		user      string
+		groups    []string
+		wantErr   bool
+		wantAllow bool
+	}{
+		{
+			name:      "empty allowlist allows no identity",
+			namespace: "default",
+			user:      "helm-operator",
+		},
+		{
+			name:      "user in the namespace",
+			value:     "default=helm-operator",
+			namespace: "default",
+			user:      "helm-operator",
+			wantAllow: true,
+		},
+		{
+			name:      "user in another namespace",
+			value:     "default=helm-operator",
+			namespace: "tenant",
+			user:      "helm-operator",
+		},
+		{
+			name:      "user and groups in every namespace",
+			value:     " *=helm-operator, *=group:platform-team ",
+			namespace: "tenant",
+			user:      "helm-operator",
+			groups:    []string{"platform-team"},
+			wantAllow: true,
+		},
+		{
+			name:      "group that is not listed",
+			value:     "*=helm-operator,*=group:platform-team",
+			namespace: "default",
+			user:      "helm-operator",
+			groups:    []string{"platform-team", "system:masters"},
+		},
+		{
+			name:      "group is not a user",
+			value:     "default=group:helm-operator",
+			namespace: "default",
+			user:      "helm-operator",
+		},
+		{
+			name:    "entry without an identity",
+			value:   "default=",
+			wantErr: true,
+		},
+		{
+			name:    "entry without a group name",
+			value:   "default=group:",
+			wantErr: true,
+		},
+		{
+			name:    "entry without a namespace",
+			value:   "helm-operator",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			allowlist, err := ParseImpersonationAllowlist(tt.value)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+
+			if tt.wantAllow {
+				g.Expect(allowlist.Check(tt.namespace, tt.user, tt.groups)).To(Succeed())
+			} else {
+				g.Expect(allowlist.Check(tt.namespace, tt.user, tt.groups)).NotTo(Succeed())
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// AllNamespaces is the namespace of impersonation allowlist entries that apply to every namespace.
+	AllNamespaces = "*"
+
+	// impersonationGroupPrefix marks an impersonation allowlist entry as a group instead of a username.
+	impersonationGroupPrefix = "group:"
+)
+
+// impersonationAllowlist is used by the HelmChartProxy and HelmReleaseProxy webhooks to validate the identities they
+// impersonate. It is set by the manager before their webhooks are registered.
+var impersonationAllowlist ImpersonationAllowlist
+
+// SetImpersonationAllowlist sets the identities the HelmChartProxy and HelmReleaseProxy webhooks allow them to impersonate.
+func SetImpersonationAllowlist(allowlist ImpersonationAllowlist) {
+	impersonationAllowlist = allowlist
+}
+
+// ImpersonationAllowlist lists the users and groups on workload Clusters that the HelmChartProxies and HelmReleaseProxies in
+// each namespace of the management cluster may impersonate. The zero value allows no identity.
+// +kubebuilder:object:generate=false
+type ImpersonationAllowlist struct {
+	users  map[string]sets.String
+	groups map[string]sets.String
+}
+
+// ParseImpersonationAllowlist parses a comma-separated list of namespace=identity pairs, where the identity is a username or
+// a group prefixed with group:, and the namespace * allows the identity in every namespace, e.g.
+// "monitoring=system:serviceaccount:monitoring:helm,*=group:helm-operators".
+func ParseImpersonationAllowlist(value string) (ImpersonationAllowlist, error) {
+	allowlist := ImpersonationAllowlist{users: map[string]sets.String{}, groups: map[string]sets.String{}}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" || parts[1] == impersonationGroupPrefix {
+			return ImpersonationAllowlist{}, errors.Errorf("invalid impersonation allowlist entry %q, expected namespace=user or namespace=group:name", pair)
+		}
+
+		namespace, identity := parts[0], parts[1]
+		identities := allowlist.users
+		if strings.HasPrefix(identity, impersonationGroupPrefix) {
+			identities = allowlist.groups
+			identity = strings.TrimPrefix(identity, impersonationGroupPrefix)
+		}
+		if identities[namespace] == nil {
+			identities[namespace] = sets.NewString()
+		}
+		identities[namespace].Insert(identity)
+	}
+
+	return allowlist, nil
+}
+
+// Check returns an error unless the user and every group are allowed to be impersonated by the HelmChartProxies and
+// HelmReleaseProxies in a namespace.
+func (a ImpersonationAllowlist) Check(namespace string, user string, groups []string) error {
+	if !allowed(a.users, namespace, user) {
+		return errors.Errorf("impersonating user %s is not allowed in namespace %s", user, namespace)
+	}
+	for _, group := range groups {
+		if !allowed(a.groups, namespace, group) {
+			return errors.Errorf("impersonating group %s is not allowed in namespace %s", group, namespace)
+		}
+	}
+
+	return nil
+}
+
+func allowed(identities map[string]sets.String, namespace string, identity string) bool {
+	return identities[namespace].Has(identity) || identities[AllNamespaces].Has(identity)
+}
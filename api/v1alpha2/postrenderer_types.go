@@ -0,0 +1,102 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+// PostRenderers modifies the manifests rendered by Helm before they are applied to the Cluster. The modifications are
+// applied with Kustomize in the order: patches, images, labels and annotations.
+type PostRenderers struct {
+	// PatchesStrategicMerge is a list of inline strategic merge patches applied to the rendered manifests. On a
+	// HelmChartProxy, each patch supports the same Go templating as the ValuesTemplate.
+	// +optional
+	PatchesStrategicMerge []string `json:"patchesStrategicMerge,omitempty"`
+
+	// PatchesJSON6902 is a list of JSON6902 patches applied to the resources matching their target. On a HelmChartProxy,
+	// each patch supports the same Go templating as the ValuesTemplate.
+	// +optional
+	PatchesJSON6902 []JSON6902Patch `json:"patchesJson6902,omitempty"`
+
+	// CommonLabels are added to the metadata of every rendered resource. Selectors are left unchanged.
+	// +optional
+	CommonLabels map[string]string `json:"commonLabels,omitempty"`
+
+	// CommonAnnotations are added to the metadata of every rendered resource.
+	// +optional
+	CommonAnnotations map[string]string `json:"commonAnnotations,omitempty"`
+
+	// Images is a list of overrides for the container images used by the rendered resources.
+	// +optional
+	Images []ImageOverride `json:"images,omitempty"`
+}
+
+// JSON6902Patch is a JSON6902 patch applied to the rendered resources matching a target.
+type JSON6902Patch struct {
+	// Target selects the rendered resources to patch.
+	Target PatchTarget `json:"target"`
+
+	// Patch is an inline YAML or JSON list of JSON6902 operations.
+	Patch string `json:"patch"`
+}
+
+// PatchTarget selects rendered resources by group, version, kind, name, namespace, labels and annotations. Empty
+// fields match all resources.
+type PatchTarget struct {
+	// Group is the API group of the resources.
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// Version is the API version of the resources.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Kind is the kind of the resources.
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Name is the name of the resources.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Namespace is the namespace of the resources.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// LabelSelector is a label selector expression matched against the labels of the resources.
+	// +optional
+	LabelSelector string `json:"labelSelector,omitempty"`
+
+	// AnnotationSelector is a label selector expression matched against the annotations of the resources.
+	// +optional
+	AnnotationSelector string `json:"annotationSelector,omitempty"`
+}
+
+// ImageOverride replaces the name, tag or digest of a container image used by the rendered resources.
+type ImageOverride struct {
+	// Name is the image name to replace, without its tag or digest, e.g. quay.io/jetstack/cert-manager-controller.
+	Name string `json:"name"`
+
+	// NewName is the name to replace the image name with.
+	// +optional
+	NewName string `json:"newName,omitempty"`
+
+	// NewTag is the tag to replace the image tag with.
+	// +optional
+	NewTag string `json:"newTag,omitempty"`
+
+	// Digest is the digest to replace the image tag with. It takes precedence over NewTag.
+	// +optional
+	Digest string `json:"digest,omitempty"`
+}
@@ -18,13 +18,18 @@ package helmchartproxy
 
 import (
 	"context"
-	"fmt"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -32,7 +37,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	addonsv1alpha1 "cluster-api-addon-provider-helm/api/v1alpha1"
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
+	"cluster-api-addon-provider-helm/internal"
 
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/conditions"
@@ -42,22 +48,67 @@ import (
 	// "sigs.k8s.io/cluster-api/cmd/clusterctl/client/config"
 )
 
+// Event reasons recorded on HelmChartProxies.
+const (
+	// createdEventReason is recorded when a HelmReleaseProxy is created for a selected Cluster.
+	createdEventReason = "Created"
+	// reinstallingEventReason is recorded when a HelmReleaseProxy is deleted to reinstall the Helm release.
+	reinstallingEventReason = "Reinstalling"
+	// failedEventReason is recorded when a HelmReleaseProxy cannot be created, updated or deleted.
+	failedEventReason = "Failed"
+)
+
+const (
+	// clusterSelectorIndexKey indexes HelmChartProxies by each "key=value" pair in the MatchLabels of their ClusterSelector.
+	clusterSelectorIndexKey = "spec.clusterSelector.matchLabels"
+	// selectsAllClustersIndexValue is the index value of HelmChartProxies whose ClusterSelector has no MatchLabels, which
+	// selects every Cluster in the namespace.
+	selectsAllClustersIndexValue = "*"
+
+	// chartLoadRequeueAfter is the interval at which a HelmChartProxy retries loading its chart to validate the values
+	// rendered for each Cluster, while the chart repository is unavailable.
+	chartLoadRequeueAfter = time.Minute
+)
+
+// loadChart loads the chart of a HelmChartProxy to validate the values rendered for each Cluster. It is replaced in tests so
+// that they don't need a chart repository.
+var loadChart = internal.LoadChart
+
 // HelmChartProxyReconciler reconciles a HelmChartProxy object
 type HelmChartProxyReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 
 	// WatchFilterValue is the label value used to filter events prior to reconciliation.
 	WatchFilterValue string
+
+	// ClusterConcurrency is the maximum number of selected Clusters that are reconciled in parallel within a single
+	// HelmChartProxy reconcile. Values lower than 1 reconcile the Clusters one at a time.
+	ClusterConcurrency int
+
+	// RegistryMirrors are the registry mirrors applied to every HelmChartProxy, keyed by registry.
+	RegistryMirrors map[string]string
+
+	// RegistryMirrorsConfigMap is the ConfigMap with registry mirrors applied to every HelmChartProxy. The mirrors in the
+	// ConfigMap take precedence over RegistryMirrors. It is ignored if the name is empty.
+	RegistryMirrorsConfigMap types.NamespacedName
+
+	// APIReader is used to read the registry mirrors ConfigMap without caching every ConfigMap in the management cluster.
+	APIReader client.Reader
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *HelmChartProxyReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager, options controller.Options) error {
 	log := ctrl.LoggerFrom(ctx)
 
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &addonsv1alpha2.HelmChartProxy{}, clusterSelectorIndexKey, indexHelmChartProxyByClusterSelector); err != nil {
+		return errors.Wrap(err, "error setting index field for HelmChartProxy cluster selector")
+	}
+
 	c, err := ctrl.NewControllerManagedBy(mgr).
 		WithOptions(options).
-		For(&addonsv1alpha1.HelmChartProxy{}).
+		For(&addonsv1alpha2.HelmChartProxy{}).
 		WithEventFilter(predicates.ResourceNotPausedAndHasFilterLabel(log, r.WatchFilterValue)).
 		// WithEventFilter(predicates.ResourceIsNotExternallyManaged(log)).
 		Build(r)
@@ -76,7 +127,7 @@ func (r *HelmChartProxyReconciler) SetupWithManager(ctx context.Context, mgr ctr
 
 	// Add a watch on HelmReleaseProxy object for changes.
 	if err = c.Watch(
-		&source.Kind{Type: &addonsv1alpha1.HelmReleaseProxy{}},
+		&source.Kind{Type: &addonsv1alpha2.HelmReleaseProxy{}},
 		handler.EnqueueRequestsFromMapFunc(HelmReleaseProxyToHelmChartProxyMapper),
 		predicates.ResourceNotPausedAndHasFilterLabel(log, r.WatchFilterValue),
 	); err != nil {
@@ -91,16 +142,15 @@ func (r *HelmChartProxyReconciler) SetupWithManager(ctx context.Context, mgr ctr
 //+kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=helmchartproxies/finalizers,verbs=update
 //+kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=helmreleaseproxies,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters,verbs=list;watch
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusterclasses,verbs=get;list;watch
 //+kubebuilder:rbac:groups=controlplane.cluster.x-k8s.io,resources=kubeadmcontrolplanes,verbs=list;get;watch
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io;bootstrap.cluster.x-k8s.io;controlplane.cluster.x-k8s.io,resources=*,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=namespaces,verbs=list;
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the HelmChartProxy object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
+// Reconcile selects the Clusters that match a HelmChartProxy and creates, updates or deletes a HelmReleaseProxy for each
+// of them, then aggregates their status into the HelmChartProxy.
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.11.0/pkg/reconcile
@@ -110,7 +160,7 @@ func (r *HelmChartProxyReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	log.V(2).Info("Beginning reconcilation for HelmChartProxy", "requestNamespace", req.Namespace, "requestName", req.Name)
 
 	// Fetch the HelmChartProxy instance.
-	helmChartProxy := &addonsv1alpha1.HelmChartProxy{}
+	helmChartProxy := &addonsv1alpha2.HelmChartProxy{}
 	if err := r.Client.Get(ctx, req.NamespacedName, helmChartProxy); err != nil {
 		if apierrors.IsNotFound(err) {
 			log.V(2).Info("HelmChartProxy resource not found, skipping reconciliation", "helmChartProxy", req.NamespacedName)
@@ -143,16 +193,17 @@ func (r *HelmChartProxyReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	// to not have errors. An idea would be to check the deletion timestamp.
 	clusterList, err := r.listClustersWithLabels(ctx, helmChartProxy.Namespace, selector)
 	if err != nil {
-		conditions.MarkFalse(helmChartProxy, addonsv1alpha1.HelmReleaseProxySpecsUpToDateCondition, addonsv1alpha1.ClusterSelectionFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		conditions.MarkFalse(helmChartProxy, addonsv1alpha2.HelmReleaseProxySpecsUpToDateCondition, addonsv1alpha2.ClusterSelectionFailedReason, clusterv1.ConditionSeverityError, err.Error())
 
 		return ctrl.Result{}, err
 	}
-	// conditions.MarkTrue(helmChartProxy, addonsv1alpha1.HelmReleaseProxySpecsReadyCondition)
+	// conditions.MarkTrue(helmChartProxy, addonsv1alpha2.HelmReleaseProxySpecsReadyCondition)
 	helmChartProxy.SetMatchingClusters(clusterList.Items)
+	internal.SetMatchingClustersMetric(helmChartProxy, len(clusterList.Items))
 
 	log.V(2).Info("Finding HelmRelease for HelmChartProxy", "helmChartProxy", helmChartProxy.Name)
 	label := map[string]string{
-		addonsv1alpha1.HelmChartProxyLabelName: helmChartProxy.Name,
+		addonsv1alpha2.HelmChartProxyLabelName: helmChartProxy.Name,
 	}
 	releaseList, err := r.listInstalledReleases(ctx, helmChartProxy.Namespace, label)
 	if err != nil {
@@ -164,8 +215,8 @@ func (r *HelmChartProxyReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		// The object is not being deleted, so if it does not have our finalizer,
 		// then lets add the finalizer and update the object. This is equivalent
 		// registering our finalizer.
-		if !controllerutil.ContainsFinalizer(helmChartProxy, addonsv1alpha1.HelmChartProxyFinalizer) {
-			controllerutil.AddFinalizer(helmChartProxy, addonsv1alpha1.HelmChartProxyFinalizer)
+		if !controllerutil.ContainsFinalizer(helmChartProxy, addonsv1alpha2.HelmChartProxyFinalizer) {
+			controllerutil.AddFinalizer(helmChartProxy, addonsv1alpha2.HelmChartProxyFinalizer)
 			if err := patchHelmChartProxy(ctx, patchHelper, helmChartProxy); err != nil {
 				// TODO: Should we try to set the error here? If we can't add the finalizer we likely can't update the status either.
 				return ctrl.Result{}, err
@@ -173,7 +224,7 @@ func (r *HelmChartProxyReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		}
 	} else {
 		// The object is being deleted
-		if controllerutil.ContainsFinalizer(helmChartProxy, addonsv1alpha1.HelmChartProxyFinalizer) {
+		if controllerutil.ContainsFinalizer(helmChartProxy, addonsv1alpha2.HelmChartProxyFinalizer) {
 			// our finalizer is present, so lets handle any external dependency
 			if err := r.reconcileDelete(ctx, helmChartProxy, releaseList.Items); err != nil {
 				// if fail to delete the external dependency here, return with error
@@ -182,7 +233,8 @@ func (r *HelmChartProxyReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 			}
 
 			// remove our finalizer from the list and update it.
-			controllerutil.RemoveFinalizer(helmChartProxy, addonsv1alpha1.HelmChartProxyFinalizer)
+			controllerutil.RemoveFinalizer(helmChartProxy, addonsv1alpha2.HelmChartProxyFinalizer)
+			internal.DeleteHelmChartProxyMetrics(helmChartProxy)
 			if err := patchHelmChartProxy(ctx, patchHelper, helmChartProxy); err != nil {
 				// TODO: Should we try to set the error here? If we can't remove the finalizer we likely can't update the status either.
 				return ctrl.Result{}, err
@@ -194,49 +246,147 @@ func (r *HelmChartProxyReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	}
 
 	log.V(2).Info("Reconciling HelmChartProxy", "randomName", helmChartProxy.Name)
-	err = r.reconcileNormal(ctx, helmChartProxy, clusterList.Items, releaseList.Items)
-	if err != nil {
-		return ctrl.Result{}, err
-	}
-	conditions.MarkTrue(helmChartProxy, addonsv1alpha1.HelmReleaseProxySpecsUpToDateCondition)
+	result, clusterErrs, reconcileErr := r.reconcileNormal(ctx, helmChartProxy, clusterList.Items, releaseList.Items)
 
-	err = r.aggregateHelmReleaseProxyReadyCondition(ctx, helmChartProxy)
+	// Aggregate even if some Clusters failed so that the status reports every Cluster.
+	err = r.aggregateHelmReleaseProxyReadyCondition(ctx, helmChartProxy, clusterErrs)
 	if err != nil {
 		log.Error(err, "failed to aggregate HelmReleaseProxy ready condition", "helmChartProxy", helmChartProxy.Name)
-		return ctrl.Result{}, err
+		return ctrl.Result{}, kerrors.NewAggregate([]error{reconcileErr, err})
 	}
 
-	return ctrl.Result{}, nil
+	return result, reconcileErr
 }
 
-// reconcileNormal...
-func (r *HelmChartProxyReconciler) reconcileNormal(ctx context.Context, helmChartProxy *addonsv1alpha1.HelmChartProxy, clusters []clusterv1.Cluster, helmReleaseProxies []addonsv1alpha1.HelmReleaseProxy) error {
+// reconcileNormal reconciles the HelmChartProxy on every selected Cluster. A failure on one Cluster does not prevent the remaining
+// Clusters from being reconciled; the failures are returned per Cluster along with an aggregate error. If the chart can't be
+// loaded, the HelmChartProxy is requeued after a fixed interval instead of returning an error.
+func (r *HelmChartProxyReconciler) reconcileNormal(ctx context.Context, helmChartProxy *addonsv1alpha2.HelmChartProxy, clusters []clusterv1.Cluster, helmReleaseProxies []addonsv1alpha2.HelmReleaseProxy) (ctrl.Result, []*clusterReconcileError, error) {
 	log := ctrl.LoggerFrom(ctx)
 
 	log.V(2).Info("Starting reconcileNormal for chart proxy", "name", helmChartProxy.Name)
 
 	err := r.deleteOrphanedHelmReleaseProxies(ctx, helmChartProxy, clusters, helmReleaseProxies)
 	if err != nil {
-		return err
+		return ctrl.Result{}, nil, err
+	}
+
+	if len(clusters) == 0 {
+		setLastHandledReconcileRequests(helmChartProxy)
+		conditions.MarkTrue(helmChartProxy, addonsv1alpha2.HelmReleaseProxySpecsUpToDateCondition)
+		return ctrl.Result{}, nil, nil
+	}
+
+	registryMirrors, err := r.getRegistryMirrors(ctx, helmChartProxy)
+	if err != nil {
+		conditions.MarkFalse(helmChartProxy, addonsv1alpha2.HelmReleaseProxySpecsUpToDateCondition, addonsv1alpha2.RegistryMirrorsFailedReason, clusterv1.ConditionSeverityError, err.Error())
+
+		return ctrl.Result{}, nil, err
 	}
 
-	for _, cluster := range clusters {
+	// Fetch the chart once so the values rendered for each Cluster can be validated against its schema. If the repository
+	// is down, the Clusters are still reconciled without the validation, so that Clusters whose releases are up to date
+	// aren't blocked. Helm validates the values against the schema anyway when the release is installed or upgraded, so the
+	// failure is only reported as a warning and the chart is loaded again after a fixed interval rather than with backoff.
+	chartRequested, err := loadChart(ctx, helmChartProxy.Spec.RepoURL, helmChartProxy.Spec.ChartName, helmChartProxy.Spec.Version)
+	var chartLoadErr error
+	if err != nil {
+		chartLoadErr = errors.Wrapf(err, "failed to load chart %s from %s", helmChartProxy.Spec.ChartName, helmChartProxy.Spec.RepoURL)
+		log.V(2).Info("Reconciling Clusters without validating values against the chart schema", "error", chartLoadErr.Error())
+	}
+
+	// Reconcile the Clusters with a bounded pool of workers. Each worker writes to its own slot in results so that
+	// the failures are aggregated in the same order as the Clusters regardless of which worker finishes first.
+	concurrency := r.ClusterConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]*clusterReconcileError, len(clusters))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range clusters {
 		// Don't reconcile if the Cluster is being deleted
-		if !cluster.ObjectMeta.DeletionTimestamp.IsZero() {
+		if !clusters[i].ObjectMeta.DeletionTimestamp.IsZero() {
+			continue
+		}
+		// Don't create or update the HelmReleaseProxy while the Cluster is paused, e.g. while clusterctl move hasn't moved
+		// the existing HelmReleaseProxy yet.
+		if clusters[i].Spec.Paused {
+			log.V(2).Info("Cluster is paused, skipping", "cluster", clusters[i].Name)
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i] = r.reconcileForCluster(ctx, helmChartProxy, clusters[i], chartRequested, registryMirrors)
+		}(i)
+	}
+	wg.Wait()
+	setLastHandledReconcileRequests(helmChartProxy)
+
+	clusterErrs := []*clusterReconcileError{}
+	errs := []error{}
+	for _, clusterErr := range results {
+		if clusterErr == nil {
 			continue
 		}
 
-		err := r.reconcileForCluster(ctx, helmChartProxy, cluster)
+		log.V(2).Info("Failed to reconcile HelmChartProxy on cluster", "cluster", clusterErr.clusterName, "reason", clusterErr.reason, "error", clusterErr.Error())
+		clusterErrs = append(clusterErrs, clusterErr)
+		// Informational results such as a pending reinstall, and terminal errors such as a blocked reinstall, are reported
+		// but not retried as errors.
+		if clusterErr.severity != clusterv1.ConditionSeverityInfo && !clusterErr.terminal {
+			errs = append(errs, clusterErr)
+		}
+	}
+
+	if len(clusterErrs) > 0 {
+		markClusterReconcileErrors(helmChartProxy, clusterErrs, len(clusters))
+	} else if chartLoadErr != nil {
+		conditions.MarkFalse(helmChartProxy, addonsv1alpha2.HelmReleaseProxySpecsUpToDateCondition, addonsv1alpha2.ChartLoadFailedReason, clusterv1.ConditionSeverityWarning, chartLoadErr.Error())
+	} else {
+		conditions.MarkTrue(helmChartProxy, addonsv1alpha2.HelmReleaseProxySpecsUpToDateCondition)
+	}
+
+	result := ctrl.Result{}
+	if chartLoadErr != nil {
+		result.RequeueAfter = chartLoadRequeueAfter
+	}
+
+	return result, clusterErrs, kerrors.NewAggregate(errs)
+}
+
+// setLastHandledReconcileRequests records the reconcile request annotations of a HelmChartProxy as handled once they were
+// acted on, i.e. once the selected Clusters were reconciled and the requests copied to their HelmReleaseProxies, which
+// handle them on their Clusters. Clusters that failed get the requests when they are reconciled again.
+func setLastHandledReconcileRequests(helmChartProxy *addonsv1alpha2.HelmChartProxy) {
+	for _, annotation := range addonsv1alpha2.ReconcileRequestAnnotations {
+		if value, ok := helmChartProxy.Annotations[annotation]; ok {
+			helmChartProxy.Status.SetLastHandled(annotation, value)
+		}
+	}
+}
+
+// getRegistryMirrors merges the registry mirrors configured on the manager with the registry mirrors of a HelmChartProxy.
+func (r *HelmChartProxyReconciler) getRegistryMirrors(ctx context.Context, helmChartProxy *addonsv1alpha2.HelmChartProxy) (map[string]string, error) {
+	var configMapMirrors map[string]string
+	if r.RegistryMirrorsConfigMap.Name != "" {
+		var err error
+		configMapMirrors, err = internal.GetRegistryMirrorsFromConfigMap(ctx, r.APIReader, r.RegistryMirrorsConfigMap)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	return internal.MergeRegistryMirrors(r.RegistryMirrors, configMapMirrors, helmChartProxy.Spec.RegistryMirrors), nil
 }
 
 // reconcileDelete...
-func (r *HelmChartProxyReconciler) reconcileDelete(ctx context.Context, helmChartProxy *addonsv1alpha1.HelmChartProxy, releases []addonsv1alpha1.HelmReleaseProxy) error {
+func (r *HelmChartProxyReconciler) reconcileDelete(ctx context.Context, helmChartProxy *addonsv1alpha2.HelmChartProxy, releases []addonsv1alpha2.HelmReleaseProxy) error {
 	log := ctrl.LoggerFrom(ctx)
 
 	log.V(2).Info("Deleting all HelmReleaseProxies as part of HelmChartProxy deletion", "helmChartProxy", helmChartProxy.Name)
@@ -262,8 +412,8 @@ func (r *HelmChartProxyReconciler) listClustersWithLabels(ctx context.Context, n
 	return clusterList, nil
 }
 
-func (r *HelmChartProxyReconciler) listInstalledReleases(ctx context.Context, namespace string, labels map[string]string) (*addonsv1alpha1.HelmReleaseProxyList, error) {
-	releaseList := &addonsv1alpha1.HelmReleaseProxyList{}
+func (r *HelmChartProxyReconciler) listInstalledReleases(ctx context.Context, namespace string, labels map[string]string) (*addonsv1alpha2.HelmReleaseProxyList, error) {
+	releaseList := &addonsv1alpha2.HelmReleaseProxyList{}
 	// Empty labels should match nothing, not everything
 	if len(labels) == 0 {
 		return nil, nil
@@ -277,24 +427,26 @@ func (r *HelmChartProxyReconciler) listInstalledReleases(ctx context.Context, na
 	return releaseList, nil
 }
 
-func (r *HelmChartProxyReconciler) aggregateHelmReleaseProxyReadyCondition(ctx context.Context, helmChartProxy *addonsv1alpha1.HelmChartProxy) error {
+func (r *HelmChartProxyReconciler) aggregateHelmReleaseProxyReadyCondition(ctx context.Context, helmChartProxy *addonsv1alpha2.HelmChartProxy, clusterErrs []*clusterReconcileError) error {
 	log := ctrl.LoggerFrom(ctx)
 
 	log.V(2).Info("Aggregating HelmReleaseProxyReadyCondition")
 
 	labels := map[string]string{
-		addonsv1alpha1.HelmChartProxyLabelName: helmChartProxy.Name,
+		addonsv1alpha2.HelmChartProxyLabelName: helmChartProxy.Name,
 	}
 	releaseList, err := r.listInstalledReleases(ctx, helmChartProxy.Namespace, labels)
 	if err != nil {
-		// conditions.MarkFalse(helmChartProxy, addonsv1alpha1.HelmReleaseProxiesReadyCondition, addonsv1alpha1.HelmReleaseProxyListFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		// conditions.MarkFalse(helmChartProxy, addonsv1alpha2.HelmReleaseProxiesReadyCondition, addonsv1alpha2.HelmReleaseProxyListFailedReason, clusterv1.ConditionSeverityError, err.Error())
 		return err
 	}
 
+	setClusterStatuses(helmChartProxy, releaseList.Items, clusterErrs)
+
 	if len(releaseList.Items) == 0 {
 		// Consider it to be vacuously true if there are no releases. This should only be reached if we previously had HelmReleaseProxies but they were all deleted
 		// due to the Clusters being unselected. In that case, we should consider the condition to be true.
-		conditions.MarkTrue(helmChartProxy, addonsv1alpha1.HelmReleaseProxiesReadyCondition)
+		conditions.MarkTrue(helmChartProxy, addonsv1alpha2.HelmReleaseProxiesReadyCondition)
 		return nil
 	}
 
@@ -303,17 +455,17 @@ func (r *HelmChartProxyReconciler) aggregateHelmReleaseProxyReadyCondition(ctx c
 		getters = append(getters, &r)
 	}
 
-	conditions.SetAggregate(helmChartProxy, addonsv1alpha1.HelmReleaseProxiesReadyCondition, getters, conditions.AddSourceRef(), conditions.WithStepCounterIf(false))
+	conditions.SetAggregate(helmChartProxy, addonsv1alpha2.HelmReleaseProxiesReadyCondition, getters, conditions.AddSourceRef(), conditions.WithStepCounterIf(false))
 
 	return nil
 }
 
-func patchHelmChartProxy(ctx context.Context, patchHelper *patch.Helper, helmChartProxy *addonsv1alpha1.HelmChartProxy) error {
+func patchHelmChartProxy(ctx context.Context, patchHelper *patch.Helper, helmChartProxy *addonsv1alpha2.HelmChartProxy) error {
 	// TODO: Update the readyCondition by summarizing the state of other conditions when they are implemented.
 	conditions.SetSummary(helmChartProxy,
 		conditions.WithConditions(
-			addonsv1alpha1.HelmReleaseProxySpecsUpToDateCondition,
-			addonsv1alpha1.HelmReleaseProxiesReadyCondition,
+			addonsv1alpha2.HelmReleaseProxySpecsUpToDateCondition,
+			addonsv1alpha2.HelmReleaseProxiesReadyCondition,
 		),
 	)
 
@@ -323,25 +475,88 @@ func patchHelmChartProxy(ctx context.Context, patchHelper *patch.Helper, helmCha
 		helmChartProxy,
 		patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
 			clusterv1.ReadyCondition,
-			addonsv1alpha1.HelmReleaseProxySpecsUpToDateCondition,
-			addonsv1alpha1.HelmReleaseProxiesReadyCondition,
+			addonsv1alpha2.HelmReleaseProxySpecsUpToDateCondition,
+			addonsv1alpha2.HelmReleaseProxiesReadyCondition,
 		}},
 		patch.WithStatusObservedGeneration{},
 	)
 }
 
-// Note: this finds every HelmReleaseProxy associated with a Cluster and returns a Request for its parent HelmChartProxy.
-// This will not trigger an update if the HelmChartProxy selected a Cluster but ran into an error before creating the HelmReleaseProxy.
-// Though in that case the HelmChartProxy will requeue soon anyway so it's most likely not an issue.
+// ClusterToHelmChartProxiesMapper returns a Request for every HelmChartProxy whose ClusterSelector matches the Cluster, as well as the
+// parent of every HelmReleaseProxy already associated with the Cluster. On updates, the mapper is called with both the old and the
+// new Cluster, so HelmChartProxies are enqueued both when a Cluster starts matching and when it stops matching.
 func (r *HelmChartProxyReconciler) ClusterToHelmChartProxiesMapper(o client.Object) []ctrl.Request {
+	ctx := context.TODO()
+	log := ctrl.LoggerFrom(ctx)
+
 	cluster, ok := o.(*clusterv1.Cluster)
 	if !ok {
-		// Suppress the error for now
-		fmt.Printf("Expected a Cluster but got %T\n", o)
+		log.Error(errors.Errorf("expected a Cluster but got %T", o), "failed to map object to HelmChartProxies")
 		return nil
 	}
 
-	helmReleaseProxies := &addonsv1alpha1.HelmReleaseProxyList{}
+	keys := map[client.ObjectKey]struct{}{}
+	for _, key := range r.helmChartProxiesForClusterReleases(ctx, cluster) {
+		keys[key] = struct{}{}
+	}
+	for _, key := range r.helmChartProxiesSelectingCluster(ctx, cluster) {
+		keys[key] = struct{}{}
+	}
+
+	results := make([]ctrl.Request, 0, len(keys))
+	for key := range keys {
+		results = append(results, ctrl.Request{NamespacedName: key})
+	}
+
+	return results
+}
+
+// helmChartProxiesSelectingCluster uses the cluster selector index to find the HelmChartProxies whose ClusterSelector matches the
+// labels of the Cluster.
+func (r *HelmChartProxyReconciler) helmChartProxiesSelectingCluster(ctx context.Context, cluster *clusterv1.Cluster) []client.ObjectKey {
+	log := ctrl.LoggerFrom(ctx)
+
+	seen := map[string]struct{}{}
+	results := []client.ObjectKey{}
+	for _, indexValue := range clusterSelectorIndexValuesForCluster(cluster) {
+		helmChartProxies := &addonsv1alpha2.HelmChartProxyList{}
+		if err := r.Client.List(ctx, helmChartProxies, client.InNamespace(cluster.Namespace), client.MatchingFields{clusterSelectorIndexKey: indexValue}); err != nil {
+			log.Error(err, "failed to list HelmChartProxies selecting Cluster", "cluster", cluster.Name)
+			return nil
+		}
+
+		for _, helmChartProxy := range helmChartProxies.Items {
+			if _, ok := seen[helmChartProxy.Name]; ok {
+				continue
+			}
+			seen[helmChartProxy.Name] = struct{}{}
+
+			// Use the same semantics as listClustersWithLabels.
+			if labels.SelectorFromSet(helmChartProxy.Spec.ClusterSelector.MatchLabels).Matches(labels.Set(cluster.GetLabels())) {
+				results = append(results, client.ObjectKey{Namespace: helmChartProxy.Namespace, Name: helmChartProxy.Name})
+			}
+		}
+	}
+
+	return results
+}
+
+// clusterSelectorIndexValuesForCluster returns the cluster selector index values to look up the HelmChartProxies that may select a
+// Cluster: one for each of its labels, and one for the HelmChartProxies that select all Clusters.
+func clusterSelectorIndexValuesForCluster(cluster *clusterv1.Cluster) []string {
+	indexValues := []string{selectsAllClustersIndexValue}
+	for key, value := range cluster.GetLabels() {
+		indexValues = append(indexValues, key+"="+value)
+	}
+
+	return indexValues
+}
+
+// helmChartProxiesForClusterReleases finds every HelmReleaseProxy associated with a Cluster and returns its parent HelmChartProxy.
+func (r *HelmChartProxyReconciler) helmChartProxiesForClusterReleases(ctx context.Context, cluster *clusterv1.Cluster) []client.ObjectKey {
+	log := ctrl.LoggerFrom(ctx)
+
+	helmReleaseProxies := &addonsv1alpha2.HelmReleaseProxyList{}
 
 	listOpts := []client.ListOption{
 		client.MatchingLabels{
@@ -351,26 +566,45 @@ func (r *HelmChartProxyReconciler) ClusterToHelmChartProxiesMapper(o client.Obje
 
 	// TODO: Figure out if we want this search to be cross-namespaces.
 
-	if err := r.Client.List(context.TODO(), helmReleaseProxies, listOpts...); err != nil {
+	if err := r.Client.List(ctx, helmReleaseProxies, listOpts...); err != nil {
+		log.Error(err, "failed to list HelmReleaseProxies of Cluster", "cluster", cluster.Name)
 		return nil
 	}
 
-	results := []ctrl.Request{}
+	results := []client.ObjectKey{}
 	for _, helmReleaseProxy := range helmReleaseProxies.Items {
-		results = append(results, ctrl.Request{
-			// The HelmReleaseProxy is always in the same namespace as the HelmChartProxy.
-			NamespacedName: client.ObjectKey{Namespace: helmReleaseProxy.GetNamespace(), Name: helmReleaseProxy.Labels[addonsv1alpha1.HelmChartProxyLabelName]},
-		})
+		// The HelmReleaseProxy is always in the same namespace as the HelmChartProxy.
+		results = append(results, client.ObjectKey{Namespace: helmReleaseProxy.GetNamespace(), Name: helmReleaseProxy.Labels[addonsv1alpha2.HelmChartProxyLabelName]})
 	}
 
 	return results
 }
 
+// indexHelmChartProxyByClusterSelector returns the "key=value" pairs in the MatchLabels of the ClusterSelector of a HelmChartProxy.
+func indexHelmChartProxyByClusterSelector(o client.Object) []string {
+	helmChartProxy, ok := o.(*addonsv1alpha2.HelmChartProxy)
+	if !ok {
+		ctrl.LoggerFrom(context.TODO()).Error(errors.Errorf("expected a HelmChartProxy but got %T", o), "failed to index object by cluster selector")
+		return nil
+	}
+
+	matchLabels := helmChartProxy.Spec.ClusterSelector.MatchLabels
+	if len(matchLabels) == 0 {
+		return []string{selectsAllClustersIndexValue}
+	}
+
+	values := make([]string, 0, len(matchLabels))
+	for key, value := range matchLabels {
+		values = append(values, key+"="+value)
+	}
+
+	return values
+}
+
 func HelmReleaseProxyToHelmChartProxyMapper(o client.Object) []ctrl.Request {
-	helmReleaseProxy, ok := o.(*addonsv1alpha1.HelmReleaseProxy)
+	helmReleaseProxy, ok := o.(*addonsv1alpha2.HelmReleaseProxy)
 	if !ok {
-		// Suppress the error for now
-		fmt.Printf("Expected a HelmReleaseProxy but got %T\n", o)
+		ctrl.LoggerFrom(context.TODO()).Error(errors.Errorf("expected a HelmReleaseProxy but got %T", o), "failed to map object to HelmChartProxy")
 		return nil
 	}
 
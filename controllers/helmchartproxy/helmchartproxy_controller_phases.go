@@ -17,14 +17,16 @@ limitations under the License.
 package helmchartproxy
 
 import (
-	addonsv1alpha1 "cluster-api-addon-provider-helm/api/v1alpha1"
-	"cluster-api-addon-provider-helm/internal"
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
@@ -32,12 +34,15 @@ import (
 	"sigs.k8s.io/cluster-api/util/conditions"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
+	"cluster-api-addon-provider-helm/internal"
 )
 
 // "sigs.k8s.io/cluster-api/cmd/clusterctl/client/cluster"
 // "sigs.k8s.io/cluster-api/cmd/clusterctl/client/config"
 
-func (r *HelmChartProxyReconciler) deleteOrphanedHelmReleaseProxies(ctx context.Context, helmChartProxy *addonsv1alpha1.HelmChartProxy, clusters []clusterv1.Cluster, helmReleaseProxies []addonsv1alpha1.HelmReleaseProxy) error {
+func (r *HelmChartProxyReconciler) deleteOrphanedHelmReleaseProxies(ctx context.Context, helmChartProxy *addonsv1alpha2.HelmChartProxy, clusters []clusterv1.Cluster, helmReleaseProxies []addonsv1alpha2.HelmReleaseProxy) error {
 	log := ctrl.LoggerFrom(ctx)
 
 	releasesToDelete := getOrphanedHelmReleaseProxies(ctx, clusters, helmReleaseProxies)
@@ -45,7 +50,8 @@ func (r *HelmChartProxyReconciler) deleteOrphanedHelmReleaseProxies(ctx context.
 	for _, release := range releasesToDelete {
 		log.V(2).Info("Deleting release", "release", release)
 		if err := r.deleteHelmReleaseProxy(ctx, &release); err != nil {
-			conditions.MarkFalse(helmChartProxy, addonsv1alpha1.HelmReleaseProxySpecsUpToDateCondition, addonsv1alpha1.HelmReleaseProxyDeletionFailedReason, clusterv1.ConditionSeverityError, err.Error())
+			conditions.MarkFalse(helmChartProxy, addonsv1alpha2.HelmReleaseProxySpecsUpToDateCondition, addonsv1alpha2.HelmReleaseProxyDeletionFailedReason, clusterv1.ConditionSeverityError, err.Error())
+			r.Recorder.Eventf(helmChartProxy, corev1.EventTypeWarning, failedEventReason, "Failed to delete orphaned HelmReleaseProxy %s: %v", release.Name, err)
 			return err
 		}
 	}
@@ -53,84 +59,302 @@ func (r *HelmChartProxyReconciler) deleteOrphanedHelmReleaseProxies(ctx context.
 	return nil
 }
 
-func (r *HelmChartProxyReconciler) reconcileForCluster(ctx context.Context, helmChartProxy *addonsv1alpha1.HelmChartProxy, cluster clusterv1.Cluster) error {
+// clusterReconcileError records why a HelmChartProxy could not be reconciled on a single Cluster, along with the condition reason
+// and severity to report for it.
+type clusterReconcileError struct {
+	clusterName string
+	reason      string
+	severity    clusterv1.ConditionSeverity
+	err         error
+	// terminal errors are reported without being retried, since retrying can't succeed until the HelmChartProxy changes.
+	terminal bool
+}
+
+func (e *clusterReconcileError) Error() string {
+	return e.err.Error()
+}
+
+// reconcileForCluster creates or updates the HelmReleaseProxy for a single Cluster. It may be called concurrently for different
+// Clusters, so it must not modify the HelmChartProxy.
+func (r *HelmChartProxyReconciler) reconcileForCluster(ctx context.Context, helmChartProxy *addonsv1alpha2.HelmChartProxy, cluster clusterv1.Cluster, chartRequested *chart.Chart, registryMirrors map[string]string) *clusterReconcileError {
 	log := ctrl.LoggerFrom(ctx)
 
-	existingHelmReleaseProxy, err := r.getExistingHelmReleaseProxy(ctx, helmChartProxy, &cluster)
+	helmReleaseProxies, err := r.getHelmReleaseProxies(ctx, helmChartProxy, &cluster)
 	if err != nil {
-		// TODO: Should we set a condition here?
-		return errors.Wrapf(err, "failed to get HelmReleaseProxy for cluster %s", cluster.Name)
+		return &clusterReconcileError{
+			clusterName: cluster.Name,
+			reason:      addonsv1alpha2.HelmReleaseProxyGetFailedReason,
+			severity:    clusterv1.ConditionSeverityError,
+			err:         errors.Wrapf(err, "failed to get HelmReleaseProxy for cluster %s", cluster.Name),
+		}
 	}
-	// log.V(2).Info("Found existing HelmReleaseProxy", "cluster", cluster.Name, "release", existingHelmReleaseProxy.Name)
 
-	if existingHelmReleaseProxy != nil && shouldReinstallHelmRelease(ctx, existingHelmReleaseProxy, helmChartProxy) {
-		log.V(2).Info("Reinstalling Helm release by deleting and creating HelmReleaseProxy", "helmReleaseProxy", existingHelmReleaseProxy.Name)
-		if err := r.deleteHelmReleaseProxy(ctx, existingHelmReleaseProxy); err != nil {
-			conditions.MarkFalse(helmChartProxy, addonsv1alpha1.HelmReleaseProxySpecsUpToDateCondition, addonsv1alpha1.HelmReleaseProxyDeletionFailedReason, clusterv1.ConditionSeverityError, err.Error())
+	existingHelmReleaseProxy, proceed, reinstallErr := r.reconcileReinstall(ctx, helmChartProxy, &cluster, helmReleaseProxies)
+	if !proceed {
+		return reinstallErr
+	}
 
-			return err
+	valueLookUp, err := internal.InitializeTemplateContext(ctx, r.Client, helmChartProxy.Spec, &cluster)
+	if err != nil {
+		return &clusterReconcileError{
+			clusterName: cluster.Name,
+			reason:      addonsv1alpha2.ValueParsingFailedReason,
+			severity:    clusterv1.ConditionSeverityError,
+			err:         errors.Wrapf(err, "failed to get template context on cluster %s", cluster.Name),
 		}
-
-		// TODO: Add a check on requeue to make sure that the HelmReleaseProxy isn't still deleting
-		log.V(2).Info("Successfully deleted HelmReleaseProxy on cluster, returning to requeue for reconcile", "cluster", cluster.Name)
-		conditions.MarkFalse(helmChartProxy, addonsv1alpha1.HelmReleaseProxySpecsUpToDateCondition, addonsv1alpha1.HelmReleaseProxyReinstallingReason, clusterv1.ConditionSeverityInfo, "HelmReleaseProxy on cluster '%s' successfully deleted, preparing to reinstall", cluster.Name)
-		return nil // Try returning early so it will requeue
-		// TODO: should we continue in the loop or just requeue?
 	}
 
-	values, err := internal.ParseValues(ctx, r.Client, helmChartProxy.Spec, &cluster)
+	values, err := internal.ParseValues(ctx, helmChartProxy.Spec, &cluster, valueLookUp)
 	if err != nil {
-		conditions.MarkFalse(helmChartProxy, addonsv1alpha1.HelmReleaseProxySpecsUpToDateCondition, addonsv1alpha1.ValueParsingFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		return &clusterReconcileError{
+			clusterName: cluster.Name,
+			reason:      addonsv1alpha2.ValueParsingFailedReason,
+			severity:    clusterv1.ConditionSeverityError,
+			err:         errors.Wrapf(err, "failed to parse values on cluster %s", cluster.Name),
+		}
+	}
 
-		return errors.Wrapf(err, "failed to parse values on cluster %s", cluster.Name)
+	values, valueOverrides, err := internal.ApplyValueOverrides(ctx, helmChartProxy.Name, &cluster, values)
+	if err != nil {
+		return &clusterReconcileError{
+			clusterName: cluster.Name,
+			reason:      addonsv1alpha2.ValueOverridesFailedReason,
+			severity:    clusterv1.ConditionSeverityError,
+			err:         errors.Wrapf(err, "failed to apply value overrides on cluster %s", cluster.Name),
+		}
 	}
 
 	log.V(2).Info("Values for cluster", "cluster", cluster.Name, "values", values)
-	if err := r.createOrUpdateHelmReleaseProxy(ctx, existingHelmReleaseProxy, helmChartProxy, &cluster, values); err != nil {
-		conditions.MarkFalse(helmChartProxy, addonsv1alpha1.HelmReleaseProxySpecsUpToDateCondition, addonsv1alpha1.HelmReleaseProxyCreationFailedReason, clusterv1.ConditionSeverityError, err.Error())
+	// The chart is nil if it couldn't be loaded.
+	if chartRequested == nil {
+		log.V(2).Info("Chart not loaded, skipping values schema validation", "cluster", cluster.Name)
+	} else if err := internal.ValidateValuesAgainstSchema(chartRequested, values); err != nil {
+		return &clusterReconcileError{
+			clusterName: cluster.Name,
+			reason:      addonsv1alpha2.ValuesSchemaValidationFailedReason,
+			severity:    clusterv1.ConditionSeverityError,
+			err:         errors.Wrapf(err, "values for cluster %s do not match the chart schema", cluster.Name),
+		}
+	}
+
+	postRenderers, err := internal.ParsePostRenderers(ctx, helmChartProxy.Spec, &cluster, valueLookUp)
+	if err != nil {
+		return &clusterReconcileError{
+			clusterName: cluster.Name,
+			reason:      addonsv1alpha2.PostRendererParsingFailedReason,
+			severity:    clusterv1.ConditionSeverityError,
+			err:         errors.Wrapf(err, "failed to parse post-renderers on cluster %s", cluster.Name),
+		}
+	}
 
-		return errors.Wrapf(err, "failed to create or update HelmReleaseProxy on cluster %s", cluster.Name)
+	valuesJSON, err := internal.ValuesToJSON(values)
+	if err != nil {
+		return &clusterReconcileError{
+			clusterName: cluster.Name,
+			reason:      addonsv1alpha2.ValueParsingFailedReason,
+			severity:    clusterv1.ConditionSeverityError,
+			err:         errors.Wrapf(err, "failed to parse values on cluster %s", cluster.Name),
+		}
 	}
+
+	if err := r.createOrUpdateHelmReleaseProxy(ctx, existingHelmReleaseProxy, helmChartProxy, &cluster, valuesJSON, valueOverrides, postRenderers, registryMirrors); err != nil {
+		r.Recorder.Eventf(helmChartProxy, corev1.EventTypeWarning, failedEventReason, "Failed to create or update HelmReleaseProxy on cluster %s: %v", cluster.Name, err)
+
+		return &clusterReconcileError{
+			clusterName: cluster.Name,
+			reason:      addonsv1alpha2.HelmReleaseProxyCreationFailedReason,
+			severity:    clusterv1.ConditionSeverityError,
+			err:         errors.Wrapf(err, "failed to create or update HelmReleaseProxy on cluster %s", cluster.Name),
+		}
+	}
+
+	// A reinstall may still be in progress, e.g. while the old HelmReleaseProxy waits for the new one to be ready.
+	return reinstallErr
+}
+
+// reconcileReinstall replaces the HelmReleaseProxies of a Cluster whose immutable fields differ from the HelmChartProxy
+// according to its ReinstallStrategy. It returns the up to date HelmReleaseProxy, if any, and whether it should be created
+// or updated, along with an error describing a reinstall that is blocked or still in progress.
+func (r *HelmChartProxyReconciler) reconcileReinstall(ctx context.Context, helmChartProxy *addonsv1alpha2.HelmChartProxy, cluster *clusterv1.Cluster, helmReleaseProxies []addonsv1alpha2.HelmReleaseProxy) (*addonsv1alpha2.HelmReleaseProxy, bool, *clusterReconcileError) {
+	log := ctrl.LoggerFrom(ctx)
+
+	var existing *addonsv1alpha2.HelmReleaseProxy
+	var outdated, deleting []*addonsv1alpha2.HelmReleaseProxy
+	var changes []string
+	for i := range helmReleaseProxies {
+		helmReleaseProxy := &helmReleaseProxies[i]
+		fieldChanges := immutableFieldChanges(helmReleaseProxy, helmChartProxy)
+		switch {
+		case !helmReleaseProxy.DeletionTimestamp.IsZero():
+			deleting = append(deleting, helmReleaseProxy)
+		case len(fieldChanges) > 0:
+			outdated = append(outdated, helmReleaseProxy)
+			changes = fieldChanges
+		case existing != nil:
+			return nil, false, &clusterReconcileError{
+				clusterName: cluster.Name,
+				reason:      addonsv1alpha2.HelmReleaseProxyGetFailedReason,
+				severity:    clusterv1.ConditionSeverityError,
+				err:         errors.Errorf("multiple HelmReleaseProxies found matching the cluster %s and HelmChartProxy", cluster.Name),
+			}
+		default:
+			existing = helmReleaseProxy
+		}
+	}
+
+	if len(outdated) == 0 {
+		if existing == nil && len(deleting) > 0 {
+			// The HelmReleaseProxy watch requeues the HelmChartProxy once the old HelmReleaseProxy is gone.
+			log.V(2).Info("Waiting for HelmReleaseProxy to be deleted before creating a new one", "helmReleaseProxy", deleting[0].Name, "cluster", cluster.Name)
+			return nil, false, &clusterReconcileError{
+				clusterName: cluster.Name,
+				reason:      addonsv1alpha2.HelmReleaseProxyReinstallingReason,
+				severity:    clusterv1.ConditionSeverityInfo,
+				err:         errors.Errorf("waiting for HelmReleaseProxy %s on cluster %s to uninstall the old release before installing the new one", deleting[0].Name, cluster.Name),
+			}
+		}
+
+		return existing, true, nil
+	}
+
+	names := make([]string, 0, len(outdated))
+	for _, helmReleaseProxy := range outdated {
+		names = append(names, helmReleaseProxy.Name)
+	}
+	log.V(2).Info("HelmReleaseProxy needs to be reinstalled because immutable fields changed", "helmReleaseProxies", names, "fields", changes, "strategy", helmChartProxy.Spec.ReinstallStrategy)
+
+	switch helmChartProxy.Spec.ReinstallStrategy {
+	case addonsv1alpha2.ReinstallStrategyBlock:
+		return nil, false, &clusterReconcileError{
+			clusterName: cluster.Name,
+			reason:      addonsv1alpha2.ReinstallBlockedReason,
+			severity:    clusterv1.ConditionSeverityWarning,
+			err:         errors.Errorf("HelmReleaseProxy %s on cluster %s must be reinstalled because %s changed, but the reinstall strategy is %s", strings.Join(names, ", "), cluster.Name, strings.Join(changes, ", "), addonsv1alpha2.ReinstallStrategyBlock),
+			terminal:    true,
+		}
+	case addonsv1alpha2.ReinstallStrategyCreateBeforeDelete:
+		for _, helmReleaseProxy := range outdated {
+			if helmChartProxy.Spec.ReleaseName != "" && helmChartProxy.Spec.ReleaseName == helmReleaseProxy.Spec.ReleaseName && helmChartProxy.Spec.ReleaseNamespace == helmReleaseProxy.Spec.ReleaseNamespace {
+				return nil, false, &clusterReconcileError{
+					clusterName: cluster.Name,
+					reason:      addonsv1alpha2.ReinstallBlockedReason,
+					severity:    clusterv1.ConditionSeverityWarning,
+					err:         errors.Errorf("HelmReleaseProxy %s on cluster %s can't be reinstalled with the %s strategy because the new release has the same name %s and namespace %s", helmReleaseProxy.Name, cluster.Name, addonsv1alpha2.ReinstallStrategyCreateBeforeDelete, helmChartProxy.Spec.ReleaseName, helmChartProxy.Spec.ReleaseNamespace),
+					terminal:    true,
+				}
+			}
+		}
+
+		if existing == nil || !conditions.IsTrue(existing, addonsv1alpha2.HelmReleaseReadyCondition) {
+			return existing, true, &clusterReconcileError{
+				clusterName: cluster.Name,
+				reason:      addonsv1alpha2.HelmReleaseProxyReinstallingReason,
+				severity:    clusterv1.ConditionSeverityInfo,
+				err:         errors.Errorf("waiting for the new Helm release on cluster %s to be ready before deleting HelmReleaseProxy %s", cluster.Name, strings.Join(names, ", ")),
+			}
+		}
+
+		if err := r.deleteOutdatedHelmReleaseProxies(ctx, helmChartProxy, cluster, outdated); err != nil {
+			return nil, false, err
+		}
+
+		return existing, true, nil
+	default:
+		if err := r.deleteOutdatedHelmReleaseProxies(ctx, helmChartProxy, cluster, outdated); err != nil {
+			return nil, false, err
+		}
+		if existing != nil {
+			// The new HelmReleaseProxy was already created, e.g. with the CreateBeforeDelete strategy.
+			return existing, true, nil
+		}
+
+		// The HelmReleaseProxy watch requeues the HelmChartProxy once the old HelmReleaseProxy is gone.
+		return nil, false, &clusterReconcileError{
+			clusterName: cluster.Name,
+			reason:      addonsv1alpha2.HelmReleaseProxyReinstallingReason,
+			severity:    clusterv1.ConditionSeverityInfo,
+			err:         errors.Errorf("HelmReleaseProxy %s on cluster %s is being deleted, preparing to reinstall", strings.Join(names, ", "), cluster.Name),
+		}
+	}
+}
+
+// deleteOutdatedHelmReleaseProxies deletes the HelmReleaseProxies of a Cluster that are replaced by a reinstall.
+func (r *HelmChartProxyReconciler) deleteOutdatedHelmReleaseProxies(ctx context.Context, helmChartProxy *addonsv1alpha2.HelmChartProxy, cluster *clusterv1.Cluster, outdated []*addonsv1alpha2.HelmReleaseProxy) *clusterReconcileError {
+	log := ctrl.LoggerFrom(ctx)
+
+	for _, helmReleaseProxy := range outdated {
+		log.V(2).Info("Reinstalling Helm release by deleting HelmReleaseProxy", "helmReleaseProxy", helmReleaseProxy.Name, "cluster", cluster.Name)
+		if err := r.deleteHelmReleaseProxy(ctx, helmReleaseProxy); err != nil {
+			r.Recorder.Eventf(helmChartProxy, corev1.EventTypeWarning, failedEventReason, "Failed to delete HelmReleaseProxy %s for reinstall on cluster %s: %v", helmReleaseProxy.Name, cluster.Name, err)
+
+			return &clusterReconcileError{
+				clusterName: cluster.Name,
+				reason:      addonsv1alpha2.HelmReleaseProxyDeletionFailedReason,
+				severity:    clusterv1.ConditionSeverityError,
+				err:         err,
+			}
+		}
+		r.Recorder.Eventf(helmChartProxy, corev1.EventTypeNormal, reinstallingEventReason, "Deleted HelmReleaseProxy %s to reinstall the Helm release on cluster %s", helmReleaseProxy.Name, cluster.Name)
+	}
+
 	return nil
 }
 
-// getExistingHelmReleaseProxy...
-func (r *HelmChartProxyReconciler) getExistingHelmReleaseProxy(ctx context.Context, helmChartProxy *addonsv1alpha1.HelmChartProxy, cluster *clusterv1.Cluster) (*addonsv1alpha1.HelmReleaseProxy, error) {
+// markClusterReconcileErrors reports the Clusters that failed to reconcile in the HelmReleaseProxySpecsUpToDate condition. The
+// condition uses the reason of the most severe failure, while the error of each Cluster is reported in its entry in the status.
+func markClusterReconcileErrors(helmChartProxy *addonsv1alpha2.HelmChartProxy, clusterErrs []*clusterReconcileError, clusterCount int) {
+	mostSevere := clusterErrs[0]
+	summaries := make([]string, 0, len(clusterErrs))
+	for _, clusterErr := range clusterErrs {
+		if severityRank(clusterErr.severity) > severityRank(mostSevere.severity) {
+			mostSevere = clusterErr
+		}
+		summaries = append(summaries, fmt.Sprintf("%s (%s)", clusterErr.clusterName, clusterErr.reason))
+	}
+
+	conditions.MarkFalse(helmChartProxy, addonsv1alpha2.HelmReleaseProxySpecsUpToDateCondition, mostSevere.reason, mostSevere.severity, "%d of %d clusters are not up to date: %s", len(clusterErrs), clusterCount, strings.Join(summaries, ", "))
+}
+
+func severityRank(severity clusterv1.ConditionSeverity) int {
+	switch severity {
+	case clusterv1.ConditionSeverityError:
+		return 3
+	case clusterv1.ConditionSeverityWarning:
+		return 2
+	case clusterv1.ConditionSeverityInfo:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// getHelmReleaseProxies returns the HelmReleaseProxies of a HelmChartProxy for a Cluster. There is more than one while a
+// HelmReleaseProxy is being replaced by a reinstall.
+func (r *HelmChartProxyReconciler) getHelmReleaseProxies(ctx context.Context, helmChartProxy *addonsv1alpha2.HelmChartProxy, cluster *clusterv1.Cluster) ([]addonsv1alpha2.HelmReleaseProxy, error) {
 	log := ctrl.LoggerFrom(ctx)
 
-	helmReleaseProxyList := &addonsv1alpha1.HelmReleaseProxyList{}
+	helmReleaseProxyList := &addonsv1alpha2.HelmReleaseProxyList{}
 
 	listOpts := []client.ListOption{
+		client.InNamespace(helmChartProxy.Namespace),
 		client.MatchingLabels{
 			clusterv1.ClusterLabelName:             cluster.Name,
-			addonsv1alpha1.HelmChartProxyLabelName: helmChartProxy.Name,
+			addonsv1alpha2.HelmChartProxyLabelName: helmChartProxy.Name,
 		},
 	}
 
-	// TODO: Figure out if we want this search to be cross-namespaces.
-
-	log.V(2).Info("Attempting to fetch existing HelmReleaseProxy with Cluster and HelmChartProxy labels", "cluster", cluster.Name, "helmChartProxy", helmChartProxy.Name)
-	if err := r.Client.List(context.TODO(), helmReleaseProxyList, listOpts...); err != nil {
+	log.V(2).Info("Attempting to fetch existing HelmReleaseProxies with Cluster and HelmChartProxy labels", "cluster", cluster.Name, "helmChartProxy", helmChartProxy.Name)
+	if err := r.Client.List(ctx, helmReleaseProxyList, listOpts...); err != nil {
 		return nil, err
 	}
 
-	if helmReleaseProxyList.Items == nil || len(helmReleaseProxyList.Items) == 0 {
-		log.V(2).Info("No HelmReleaseProxy found matching the cluster and HelmChartProxy", "cluster", cluster.Name, "helmChartProxy", helmChartProxy.Name)
-		return nil, nil
-	} else if len(helmReleaseProxyList.Items) > 1 {
-		log.V(2).Info("Multiple HelmReleaseProxies found matching the cluster and HelmChartProxy", "cluster", cluster.Name, "helmChartProxy", helmChartProxy.Name)
-		return nil, errors.Errorf("multiple HelmReleaseProxies found matching the cluster and HelmChartProxy")
-	}
-
-	log.V(2).Info("Found existing matching HelmReleaseProxy", "cluster", cluster.Name, "helmChartProxy", helmChartProxy.Name)
-
-	return &helmReleaseProxyList.Items[0], nil
+	return helmReleaseProxyList.Items, nil
 }
 
 // createOrUpdateHelmReleaseProxy...
-func (r *HelmChartProxyReconciler) createOrUpdateHelmReleaseProxy(ctx context.Context, existing *addonsv1alpha1.HelmReleaseProxy, helmChartProxy *addonsv1alpha1.HelmChartProxy, cluster *clusterv1.Cluster, parsedValues string) error {
+func (r *HelmChartProxyReconciler) createOrUpdateHelmReleaseProxy(ctx context.Context, existing *addonsv1alpha2.HelmReleaseProxy, helmChartProxy *addonsv1alpha2.HelmChartProxy, cluster *clusterv1.Cluster, parsedValues *apiextensionsv1.JSON, valueOverrides []string, parsedPostRenderers *addonsv1alpha2.PostRenderers, registryMirrors map[string]string) error {
 	log := ctrl.LoggerFrom(ctx)
-	helmReleaseProxy := constructHelmReleaseProxy(existing, helmChartProxy, parsedValues, cluster)
+	helmReleaseProxy := constructHelmReleaseProxy(existing, helmChartProxy, parsedValues, valueOverrides, parsedPostRenderers, registryMirrors, cluster)
 	if helmReleaseProxy == nil {
 		log.V(2).Info("HelmReleaseProxy is up to date, nothing to do", "helmReleaseProxy", existing.Name, "cluster", cluster.Name)
 		return nil
@@ -139,6 +363,7 @@ func (r *HelmChartProxyReconciler) createOrUpdateHelmReleaseProxy(ctx context.Co
 		if err := r.Client.Create(ctx, helmReleaseProxy); err != nil {
 			return errors.Wrapf(err, "failed to create HelmReleaseProxy '%s' for cluster: %s/%s", helmReleaseProxy.Name, cluster.Namespace, cluster.Name)
 		}
+		r.Recorder.Eventf(helmChartProxy, corev1.EventTypeNormal, createdEventReason, "Created HelmReleaseProxy %s for cluster %s", helmReleaseProxy.Name, cluster.Name)
 	} else {
 		// TODO: should this use patchHelmReleaseProxy() instead of Update() in case there's a race condition?
 		if err := r.Client.Update(ctx, helmReleaseProxy); err != nil {
@@ -150,7 +375,7 @@ func (r *HelmChartProxyReconciler) createOrUpdateHelmReleaseProxy(ctx context.Co
 }
 
 // deleteHelmReleaseProxy...
-func (r *HelmChartProxyReconciler) deleteHelmReleaseProxy(ctx context.Context, helmReleaseProxy *addonsv1alpha1.HelmReleaseProxy) error {
+func (r *HelmChartProxyReconciler) deleteHelmReleaseProxy(ctx context.Context, helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) error {
 	log := ctrl.LoggerFrom(ctx)
 
 	if err := r.Client.Delete(ctx, helmReleaseProxy); err != nil {
@@ -164,16 +389,23 @@ func (r *HelmChartProxyReconciler) deleteHelmReleaseProxy(ctx context.Context, h
 	return nil
 }
 
-func constructHelmReleaseProxy(existing *addonsv1alpha1.HelmReleaseProxy, helmChartProxy *addonsv1alpha1.HelmChartProxy, parsedValues string, cluster *clusterv1.Cluster) *addonsv1alpha1.HelmReleaseProxy {
-	helmReleaseProxy := &addonsv1alpha1.HelmReleaseProxy{}
+func constructHelmReleaseProxy(existing *addonsv1alpha2.HelmReleaseProxy, helmChartProxy *addonsv1alpha2.HelmChartProxy, parsedValues *apiextensionsv1.JSON, valueOverrides []string, parsedPostRenderers *addonsv1alpha2.PostRenderers, registryMirrors map[string]string, cluster *clusterv1.Cluster) *addonsv1alpha2.HelmReleaseProxy {
+	helmReleaseProxy := &addonsv1alpha2.HelmReleaseProxy{}
 	if existing == nil {
 		helmReleaseProxy.GenerateName = fmt.Sprintf("%s-%s-", helmChartProxy.Spec.ChartName, cluster.Name)
 		helmReleaseProxy.Namespace = helmChartProxy.Namespace
 		helmReleaseProxy.OwnerReferences = util.EnsureOwnerRef(helmReleaseProxy.OwnerReferences, *metav1.NewControllerRef(helmChartProxy, helmChartProxy.GroupVersionKind()))
+		// The Cluster owner reference makes clusterctl move the HelmReleaseProxy after the Cluster.
+		helmReleaseProxy.OwnerReferences = util.EnsureOwnerRef(helmReleaseProxy.OwnerReferences, metav1.OwnerReference{
+			APIVersion: clusterv1.GroupVersion.String(),
+			Kind:       "Cluster",
+			Name:       cluster.Name,
+			UID:        cluster.UID,
+		})
 
 		newLabels := map[string]string{}
 		newLabels[clusterv1.ClusterLabelName] = cluster.Name
-		newLabels[addonsv1alpha1.HelmChartProxyLabelName] = helmChartProxy.Name
+		newLabels[addonsv1alpha2.HelmChartProxyLabelName] = helmChartProxy.Name
 		helmReleaseProxy.Labels = newLabels
 
 		helmReleaseProxy.Spec.ClusterRef = corev1.ObjectReference{
@@ -187,6 +419,7 @@ func constructHelmReleaseProxy(existing *addonsv1alpha1.HelmReleaseProxy, helmCh
 		helmReleaseProxy.Spec.ChartName = helmChartProxy.Spec.ChartName
 		helmReleaseProxy.Spec.RepoURL = helmChartProxy.Spec.RepoURL
 		helmReleaseProxy.Spec.ReleaseNamespace = helmChartProxy.Spec.ReleaseNamespace
+		helmReleaseProxy.Spec.Storage = helmChartProxy.Spec.Storage
 
 		// helmChartProxy.ObjectMeta.SetAnnotations(helmReleaseProxy.Annotations)
 	} else {
@@ -195,9 +428,38 @@ func constructHelmReleaseProxy(existing *addonsv1alpha1.HelmReleaseProxy, helmCh
 		if existing.Spec.Version != helmChartProxy.Spec.Version {
 			changed = true
 		}
-		if !cmp.Equal(existing.Spec.Values, parsedValues) {
+		if !internal.ValuesEqual(existing.Spec.Values, parsedValues) {
+			changed = true
+		}
+		if !cmp.Equal(existing.Spec.AppliedValueOverrides, valueOverrides) {
+			changed = true
+		}
+		if !cmp.Equal(existing.Spec.ClusterReadinessConditions, helmChartProxy.Spec.ClusterReadinessConditions) {
 			changed = true
 		}
+		if !cmp.Equal(existing.Spec.PostRenderers, parsedPostRenderers) {
+			changed = true
+		}
+		if !cmp.Equal(existing.Spec.RegistryMirrors, registryMirrors) {
+			changed = true
+		}
+		if existing.Spec.ServiceAccountName != helmChartProxy.Spec.ServiceAccountName {
+			changed = true
+		}
+		if !cmp.Equal(existing.Spec.Impersonate, helmChartProxy.Spec.Impersonate) {
+			changed = true
+		}
+		if !cmp.Equal(existing.Spec.Tests, helmChartProxy.Spec.Tests) {
+			changed = true
+		}
+		if !cmp.Equal(existing.Spec.CRDs, helmChartProxy.Spec.CRDs) {
+			changed = true
+		}
+		for _, annotation := range addonsv1alpha2.ReconcileRequestAnnotations {
+			if value, ok := helmChartProxy.Annotations[annotation]; ok && existing.Annotations[annotation] != value {
+				changed = true
+			}
+		}
 
 		if !changed {
 			return nil
@@ -206,39 +468,137 @@ func constructHelmReleaseProxy(existing *addonsv1alpha1.HelmReleaseProxy, helmCh
 
 	helmReleaseProxy.Spec.Version = helmChartProxy.Spec.Version
 	helmReleaseProxy.Spec.Values = parsedValues
+	helmReleaseProxy.Spec.AppliedValueOverrides = valueOverrides
+	helmReleaseProxy.Spec.ClusterReadinessConditions = helmChartProxy.Spec.ClusterReadinessConditions
+	helmReleaseProxy.Spec.PostRenderers = parsedPostRenderers
+	helmReleaseProxy.Spec.RegistryMirrors = registryMirrors
+	helmReleaseProxy.Spec.ServiceAccountName = helmChartProxy.Spec.ServiceAccountName
+	helmReleaseProxy.Spec.Impersonate = helmChartProxy.Spec.Impersonate
+	helmReleaseProxy.Spec.Tests = helmChartProxy.Spec.Tests
+	helmReleaseProxy.Spec.CRDs = helmChartProxy.Spec.CRDs
+	copyReconcileRequestAnnotations(helmChartProxy, helmReleaseProxy)
 
 	return helmReleaseProxy
 }
 
-func shouldReinstallHelmRelease(ctx context.Context, existing *addonsv1alpha1.HelmReleaseProxy, helmChartProxy *addonsv1alpha1.HelmChartProxy) bool {
-	log := ctrl.LoggerFrom(ctx)
-
-	log.V(2).Info("Checking if HelmReleaseProxy needs to be reinstalled by by checking if immutable fields changed", "helmReleaseProxy", existing.Name)
+// copyReconcileRequestAnnotations copies the reconcile request annotations of a HelmChartProxy to a HelmReleaseProxy, so
+// that the actions they request run on every selected Cluster.
+func copyReconcileRequestAnnotations(helmChartProxy *addonsv1alpha2.HelmChartProxy, helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) {
+	for _, annotation := range addonsv1alpha2.ReconcileRequestAnnotations {
+		value, ok := helmChartProxy.Annotations[annotation]
+		if !ok {
+			continue
+		}
+		if helmReleaseProxy.Annotations == nil {
+			helmReleaseProxy.Annotations = map[string]string{}
+		}
+		helmReleaseProxy.Annotations[annotation] = value
+	}
+}
 
+// immutableFieldChanges returns the fields of a HelmReleaseProxy that differ from the HelmChartProxy and can't be changed
+// without reinstalling the Helm release.
+func immutableFieldChanges(existing *addonsv1alpha2.HelmReleaseProxy, helmChartProxy *addonsv1alpha2.HelmChartProxy) []string {
 	annotations := existing.GetAnnotations()
-	result, ok := annotations[addonsv1alpha1.IsReleaseNameGeneratedAnnotation]
+	result, ok := annotations[addonsv1alpha2.IsReleaseNameGeneratedAnnotation]
+	isReleaseNameGenerated := ok && result == "true"
 
-	// log.V(2).Info("IsReleaseNameGeneratedAnnotation", "result", result, "ok", ok)
+	var changes []string
+	if existing.Spec.ChartName != helmChartProxy.Spec.ChartName {
+		changes = append(changes, "chartName")
+	}
+	if existing.Spec.RepoURL != helmChartProxy.Spec.RepoURL {
+		changes = append(changes, "repoURL")
+	}
+	// A generated release name only changes if the HelmChartProxy sets one.
+	if (isReleaseNameGenerated && helmChartProxy.Spec.ReleaseName != "") || (!isReleaseNameGenerated && existing.Spec.ReleaseName != helmChartProxy.Spec.ReleaseName) {
+		changes = append(changes, "releaseName")
+	}
+	if existing.Spec.ReleaseNamespace != helmChartProxy.Spec.ReleaseNamespace {
+		changes = append(changes, "namespace")
+	}
+	if !cmp.Equal(existing.Spec.Storage, helmChartProxy.Spec.Storage) {
+		changes = append(changes, "storage")
+	}
 
-	isReleaseNameGenerated := ok && result == "true"
-	switch {
-	case existing.Spec.ChartName != helmChartProxy.Spec.ChartName:
-		log.V(2).Info("ChartName changed", "existing", existing.Spec.ChartName, "helmChartProxy", helmChartProxy.Spec.ChartName)
-	case existing.Spec.RepoURL != helmChartProxy.Spec.RepoURL:
-		log.V(2).Info("RepoURL changed", "existing", existing.Spec.RepoURL, "helmChartProxy", helmChartProxy.Spec.RepoURL)
-	case isReleaseNameGenerated && helmChartProxy.Spec.ReleaseName != "":
-		log.V(2).Info("Generated ReleaseName changed", "existing", existing.Spec.ReleaseName, "helmChartProxy", helmChartProxy.Spec.ReleaseName)
-	case !isReleaseNameGenerated && existing.Spec.ReleaseName != helmChartProxy.Spec.ReleaseName:
-		log.V(2).Info("Non-generated ReleaseName changed", "existing", existing.Spec.ReleaseName, "helmChartProxy", helmChartProxy.Spec.ReleaseName)
-	case existing.Spec.ReleaseNamespace != helmChartProxy.Spec.ReleaseNamespace:
-		log.V(2).Info("ReleaseNamespace changed", "existing", existing.Spec.ReleaseNamespace, "helmChartProxy", helmChartProxy.Spec.ReleaseNamespace)
+	return changes
+}
+
+// setClusterStatuses summarizes the HelmReleaseProxies of every selected Cluster into the HelmChartProxy status.
+func setClusterStatuses(helmChartProxy *addonsv1alpha2.HelmChartProxy, helmReleaseProxies []addonsv1alpha2.HelmReleaseProxy, clusterErrs []*clusterReconcileError) {
+	errsByCluster := map[string]*clusterReconcileError{}
+	for _, clusterErr := range clusterErrs {
+		errsByCluster[clusterErr.clusterName] = clusterErr
+	}
+
+	releasesByCluster := map[string]addonsv1alpha2.HelmReleaseProxy{}
+	for _, helmReleaseProxy := range helmReleaseProxies {
+		clusterRef := helmReleaseProxy.Spec.ClusterRef
+		releasesByCluster[clusterRef.Namespace+"/"+clusterRef.Name] = helmReleaseProxy
+	}
+
+	var installed, ready, failed, upgrading int32
+	clusterStatuses := make([]addonsv1alpha2.HelmChartProxyClusterStatus, 0, len(helmChartProxy.Status.MatchingClusters))
+	for _, clusterRef := range helmChartProxy.Status.MatchingClusters {
+		clusterStatus := addonsv1alpha2.HelmChartProxyClusterStatus{
+			ClusterName: clusterRef.Name,
+			Ready:       corev1.ConditionUnknown,
+		}
+
+		helmReleaseProxy, ok := releasesByCluster[clusterRef.Namespace+"/"+clusterRef.Name]
+		if ok {
+			clusterStatus.HelmReleaseProxyName = helmReleaseProxy.Name
+			clusterStatus.Version = helmReleaseProxy.Status.Version
+			clusterStatus.Revision = helmReleaseProxy.Status.Revision
+
+			if helmReleaseProxy.Status.Revision > 0 {
+				installed++
+			}
+
+			if readyCondition := conditions.Get(&helmReleaseProxy, clusterv1.ReadyCondition); readyCondition != nil {
+				clusterStatus.Ready = readyCondition.Status
+				if readyCondition.Status == corev1.ConditionTrue {
+					ready++
+				} else if readyCondition.Severity == clusterv1.ConditionSeverityError {
+					clusterStatus.LastError = readyCondition.Message
+				}
+			}
+		}
+
+		// Errors from reconciling the HelmChartProxy on the Cluster take precedence since they prevent the HelmReleaseProxy
+		// from being brought up to date.
+		if clusterErr, ok := errsByCluster[clusterRef.Name]; ok && clusterErr.severity == clusterv1.ConditionSeverityError {
+			clusterStatus.LastError = clusterErr.Error()
+		}
+		if clusterStatus.LastError != "" {
+			failed++
+		} else if ok && helmReleaseUpgrading(&helmReleaseProxy) {
+			upgrading++
+		}
+
+		clusterStatuses = append(clusterStatuses, clusterStatus)
+	}
+
+	helmChartProxy.Status.ClusterStatuses = clusterStatuses
+	helmChartProxy.Status.InstalledClustersCount = installed
+	helmChartProxy.Status.ReadyClustersCount = ready
+	helmChartProxy.Status.FailedClustersCount = failed
+	helmChartProxy.Status.UpgradingClustersCount = upgrading
+	helmChartProxy.Status.ReadySummary = fmt.Sprintf("%d/%d", ready, helmChartProxy.Status.MatchingClustersCount)
+}
+
+// helmReleaseUpgrading returns true if the Helm release of a HelmReleaseProxy is being installed or upgraded, i.e. if the
+// latest spec of the HelmReleaseProxy hasn't been applied to the release yet, or if the release is in a pending state.
+func helmReleaseUpgrading(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) bool {
+	switch helmReleaseProxy.Status.Status {
+	case release.StatusPendingInstall.String(), release.StatusPendingUpgrade.String(), release.StatusPendingRollback.String():
 		return true
 	}
 
-	return false
+	return helmReleaseProxy.Status.ObservedGeneration != helmReleaseProxy.Generation
 }
 
-func getOrphanedHelmReleaseProxies(ctx context.Context, clusters []clusterv1.Cluster, helmReleaseProxies []addonsv1alpha1.HelmReleaseProxy) []addonsv1alpha1.HelmReleaseProxy {
+func getOrphanedHelmReleaseProxies(ctx context.Context, clusters []clusterv1.Cluster, helmReleaseProxies []addonsv1alpha2.HelmReleaseProxy) []addonsv1alpha2.HelmReleaseProxy {
 	log := ctrl.LoggerFrom(ctx)
 	log.V(2).Info("Getting HelmReleaseProxies to delete")
 
@@ -249,7 +609,7 @@ func getOrphanedHelmReleaseProxies(ctx context.Context, clusters []clusterv1.Clu
 	}
 	log.V(2).Info("Selected clusters", "clusters", selectedClusters)
 
-	releasesToDelete := []addonsv1alpha1.HelmReleaseProxy{}
+	releasesToDelete := []addonsv1alpha2.HelmReleaseProxy{}
 	for _, helmReleaseProxy := range helmReleaseProxies {
 		clusterRef := helmReleaseProxy.Spec.ClusterRef
 		key := clusterRef.Namespace + "/" + clusterRef.Name
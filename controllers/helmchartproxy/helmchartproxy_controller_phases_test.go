@@ -0,0 +1,704 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helmchartproxy
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
+	"cluster-api-addon-provider-helm/internal"
+)
+
+// newHelmChartProxy returns a HelmChartProxy of the nginx chart that selects the Clusters with the addon label.
+func newHelmChartProxy(namespace string) *addonsv1alpha2.HelmChartProxy {
+	return &addonsv1alpha2.HelmChartProxy{
+		TypeMeta:   metav1.TypeMeta{APIVersion: addonsv1alpha2.GroupVersion.String(), Kind: "HelmChartProxy"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-hcp", Namespace: namespace},
+		Spec: addonsv1alpha2.HelmChartProxySpec{
+			ClusterSelector:  metav1.LabelSelector{MatchLabels: map[string]string{"addon": "nginx"}},
+			ChartName:        "nginx",
+			RepoURL:          "https://charts.example.com",
+			ReleaseNamespace: "default",
+			ValuesTemplate:   "replicaCount: 1",
+		},
+	}
+}
+
+// newCluster returns a Cluster selected by the HelmChartProxy of newHelmChartProxy.
+func newCluster(namespace string, name string) *clusterv1.Cluster {
+	return &clusterv1.Cluster{
+		TypeMeta:   metav1.TypeMeta{APIVersion: clusterv1.GroupVersion.String(), Kind: "Cluster"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: map[string]string{"addon": "nginx"}},
+	}
+}
+
+// newHelmReleaseProxy returns a HelmReleaseProxy of the HelmChartProxy of newHelmChartProxy on a Cluster.
+func newHelmReleaseProxy(namespace string, clusterName string) *addonsv1alpha2.HelmReleaseProxy {
+	return &addonsv1alpha2.HelmReleaseProxy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-hcp-" + clusterName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				clusterv1.ClusterLabelName:             clusterName,
+				addonsv1alpha2.HelmChartProxyLabelName: "test-hcp",
+			},
+		},
+		Spec: addonsv1alpha2.HelmReleaseProxySpec{
+			ClusterRef:       corev1.ObjectReference{Name: clusterName, Namespace: namespace},
+			ChartName:        "nginx",
+			RepoURL:          "https://charts.example.com",
+			ReleaseNamespace: "default",
+		},
+	}
+}
+
+// newReconciler returns a HelmChartProxyReconciler that uses the API server of the test environment, and its event
+// recorder.
+func newReconciler() (*HelmChartProxyReconciler, *record.FakeRecorder) {
+	recorder := record.NewFakeRecorder(10)
+
+	return &HelmChartProxyReconciler{
+		Client:   k8sClient,
+		Recorder: recorder,
+	}, recorder
+}
+
+// createNamespace creates a namespace for the objects of a spec, so that specs don't select each other's Clusters and
+// HelmReleaseProxies.
+func createNamespace() *corev1.Namespace {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "test-"}}
+	Expect(k8sClient.Create(ctx, namespace)).To(Succeed())
+
+	return namespace
+}
+
+// createObject creates an object in the API server and keeps its type, which the owner references of the
+// HelmReleaseProxies and the references in the template context are built from.
+func createObject(obj client.Object) {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+}
+
+// createHelmReleaseProxy creates a HelmReleaseProxy with its status, which the API server ignores on create. Its spec is
+// updated until it reaches the generation.
+func createHelmReleaseProxy(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy, generation int64) {
+	status := helmReleaseProxy.Status.DeepCopy()
+	createObject(helmReleaseProxy)
+	for i := 1; helmReleaseProxy.Generation < generation; i++ {
+		helmReleaseProxy.Spec.Version = fmt.Sprintf("1.0.%d", i)
+		Expect(k8sClient.Update(ctx, helmReleaseProxy)).To(Succeed())
+	}
+	helmReleaseProxy.Status = *status
+	Expect(k8sClient.Status().Update(ctx, helmReleaseProxy)).To(Succeed())
+}
+
+// listHelmReleaseProxies returns the HelmReleaseProxies in a namespace.
+func listHelmReleaseProxies(namespace string) []addonsv1alpha2.HelmReleaseProxy {
+	helmReleaseProxyList := &addonsv1alpha2.HelmReleaseProxyList{}
+	Expect(k8sClient.List(ctx, helmReleaseProxyList, client.InNamespace(namespace))).To(Succeed())
+
+	return helmReleaseProxyList.Items
+}
+
+// stubUnavailableRepository replaces loading the chart of a HelmChartProxy, so that specs don't download charts. The repository is
+// unavailable, so the values aren't validated against the chart schema.
+func stubUnavailableRepository() {
+	loadChart = func(ctx context.Context, repoURL string, chartName string, version string) (*chart.Chart, error) {
+		return nil, errors.New("repository unavailable")
+	}
+}
+
+// findHelmReleaseProxy returns the HelmReleaseProxy of a Cluster, or nil if there is none.
+func findHelmReleaseProxy(helmReleaseProxies []addonsv1alpha2.HelmReleaseProxy, clusterName string) *addonsv1alpha2.HelmReleaseProxy {
+	for i := range helmReleaseProxies {
+		if helmReleaseProxies[i].Spec.ClusterRef.Name == clusterName {
+			return &helmReleaseProxies[i]
+		}
+	}
+
+	return nil
+}
+
+var _ = Describe("HelmChartProxy Events", func() {
+	var namespace *corev1.Namespace
+	var helmChartProxy *addonsv1alpha2.HelmChartProxy
+	var cluster *clusterv1.Cluster
+
+	BeforeEach(func() {
+		namespace = createNamespace()
+		helmChartProxy = newHelmChartProxy(namespace.Name)
+		helmChartProxy.Spec.Version = "1.0.0"
+		createObject(helmChartProxy)
+		cluster = newCluster(namespace.Name, "test-cluster")
+		createObject(cluster)
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, namespace)).To(Succeed())
+	})
+
+	// existingHelmReleaseProxy creates the HelmReleaseProxy of the Cluster as the HelmChartProxy creates it, changed by fn.
+	existingHelmReleaseProxy := func(fn func(*addonsv1alpha2.HelmReleaseProxy)) *addonsv1alpha2.HelmReleaseProxy {
+		helmReleaseProxy := constructHelmReleaseProxy(nil, helmChartProxy, nil, nil, nil, nil, cluster)
+		fn(helmReleaseProxy)
+		createObject(helmReleaseProxy)
+
+		return helmReleaseProxy
+	}
+
+	expectEvents := func(recorder *record.FakeRecorder, reasons ...string) {
+		close(recorder.Events)
+		events := []string{}
+		for event := range recorder.Events {
+			events = append(events, event)
+		}
+		Expect(events).To(HaveLen(len(reasons)))
+		for i, reason := range reasons {
+			Expect(events[i]).To(HavePrefix(corev1.EventTypeNormal + " " + reason + " "))
+			Expect(events[i]).To(ContainSubstring(cluster.Name))
+		}
+	}
+
+	It("records an Event when a HelmReleaseProxy is created", func() {
+		r, recorder := newReconciler()
+
+		Expect(r.createOrUpdateHelmReleaseProxy(ctx, nil, helmChartProxy, cluster, nil, nil, nil, nil)).To(Succeed())
+		expectEvents(recorder, createdEventReason)
+	})
+
+	It("doesn't record an Event for an up to date HelmReleaseProxy", func() {
+		r, recorder := newReconciler()
+		current := existingHelmReleaseProxy(func(*addonsv1alpha2.HelmReleaseProxy) {})
+
+		Expect(r.createOrUpdateHelmReleaseProxy(ctx, current, helmChartProxy, cluster, nil, nil, nil, nil)).To(Succeed())
+		expectEvents(recorder)
+	})
+
+	It("doesn't record an Event when a HelmReleaseProxy is updated", func() {
+		r, recorder := newReconciler()
+		outdated := existingHelmReleaseProxy(func(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) {
+			helmReleaseProxy.Spec.Version = "0.9.0"
+		})
+
+		Expect(r.createOrUpdateHelmReleaseProxy(ctx, outdated, helmChartProxy, cluster, nil, nil, nil, nil)).To(Succeed())
+		expectEvents(recorder)
+	})
+
+	It("records an Event when a HelmReleaseProxy is deleted to reinstall the release", func() {
+		r, recorder := newReconciler()
+		renamed := existingHelmReleaseProxy(func(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) {
+			helmReleaseProxy.Spec.ChartName = "ingress-nginx"
+		})
+
+		_, _, reconcileErr := r.reconcileReinstall(ctx, helmChartProxy, cluster, []addonsv1alpha2.HelmReleaseProxy{*renamed})
+		Expect(reconcileErr).NotTo(BeNil())
+		expectEvents(recorder, reinstallingEventReason)
+	})
+})
+
+var _ = Describe("aggregateHelmReleaseProxyReadyCondition", func() {
+	var namespace *corev1.Namespace
+
+	BeforeEach(func() {
+		namespace = createNamespace()
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, namespace)).To(Succeed())
+	})
+
+	type clusterStatusesCase struct {
+		generation    int64
+		status        addonsv1alpha2.HelmReleaseProxyStatus
+		ready         bool
+		failure       string
+		clusterErrs   []*clusterReconcileError
+		wantInstalled int32
+		wantReady     int32
+		wantFailed    int32
+		wantUpgrading int32
+		wantLastError string
+	}
+
+	DescribeTable("counts the Clusters by the state of their HelmReleaseProxy",
+		func(tc clusterStatusesCase) {
+			r, _ := newReconciler()
+			helmChartProxy := newHelmChartProxy(namespace.Name)
+			createObject(helmChartProxy)
+			helmReleaseProxy := newHelmReleaseProxy(namespace.Name, "cluster-1")
+			helmReleaseProxy.Status = tc.status
+			if tc.ready {
+				conditions.MarkTrue(helmReleaseProxy, clusterv1.ReadyCondition)
+			}
+			if tc.failure != "" {
+				conditions.MarkFalse(helmReleaseProxy, clusterv1.ReadyCondition, addonsv1alpha2.HelmInstallOrUpgradeFailedReason, clusterv1.ConditionSeverityError, tc.failure)
+			}
+			createHelmReleaseProxy(helmReleaseProxy, tc.generation)
+
+			patchHelper, err := patch.NewHelper(helmChartProxy, k8sClient)
+			Expect(err).NotTo(HaveOccurred())
+			helmChartProxy.Status.MatchingClusters = []corev1.ObjectReference{{Name: "cluster-1", Namespace: namespace.Name}}
+			helmChartProxy.Status.MatchingClustersCount = 1
+			Expect(r.aggregateHelmReleaseProxyReadyCondition(ctx, helmChartProxy, tc.clusterErrs)).To(Succeed())
+			Expect(patchHelmChartProxy(ctx, patchHelper, helmChartProxy)).To(Succeed())
+
+			patched := &addonsv1alpha2.HelmChartProxy{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(helmChartProxy), patched)).To(Succeed())
+			Expect(patched.Status.InstalledClustersCount).To(Equal(tc.wantInstalled))
+			Expect(patched.Status.ReadyClustersCount).To(Equal(tc.wantReady))
+			Expect(patched.Status.FailedClustersCount).To(Equal(tc.wantFailed))
+			Expect(patched.Status.UpgradingClustersCount).To(Equal(tc.wantUpgrading))
+			Expect(patched.Status.ClusterStatuses).To(HaveLen(1))
+			Expect(patched.Status.ClusterStatuses[0].LastError).To(Equal(tc.wantLastError))
+		},
+		Entry("ready release with the latest generation applied", clusterStatusesCase{
+			generation:    2,
+			status:        addonsv1alpha2.HelmReleaseProxyStatus{Status: "deployed", Revision: 2, ObservedGeneration: 2},
+			ready:         true,
+			wantInstalled: 1,
+			wantReady:     1,
+		}),
+		Entry("spec changed but not applied yet is upgrading", clusterStatusesCase{
+			generation:    3,
+			status:        addonsv1alpha2.HelmReleaseProxyStatus{Status: "deployed", Revision: 2, ObservedGeneration: 2},
+			ready:         true,
+			wantInstalled: 1,
+			wantReady:     1,
+			wantUpgrading: 1,
+		}),
+		Entry("new release that isn't installed yet is upgrading", clusterStatusesCase{
+			generation:    1,
+			wantUpgrading: 1,
+		}),
+		Entry("pending release is upgrading", clusterStatusesCase{
+			generation:    1,
+			status:        addonsv1alpha2.HelmReleaseProxyStatus{Status: "pending-upgrade", Revision: 2, ObservedGeneration: 1},
+			wantInstalled: 1,
+			wantUpgrading: 1,
+		}),
+		Entry("failed upgrade is failed and not upgrading", clusterStatusesCase{
+			generation:    2,
+			status:        addonsv1alpha2.HelmReleaseProxyStatus{Status: "failed", Revision: 2, ObservedGeneration: 1},
+			failure:       "hook failed",
+			wantInstalled: 1,
+			wantFailed:    1,
+			wantLastError: "hook failed",
+		}),
+		Entry("cluster reconcile error takes precedence", clusterStatusesCase{
+			generation: 1,
+			status:     addonsv1alpha2.HelmReleaseProxyStatus{Status: "deployed", Revision: 1, ObservedGeneration: 1},
+			ready:      true,
+			clusterErrs: []*clusterReconcileError{
+				{clusterName: "cluster-1", severity: clusterv1.ConditionSeverityError, err: errors.New("values are invalid")},
+			},
+			wantInstalled: 1,
+			wantReady:     1,
+			wantFailed:    1,
+			wantLastError: "values are invalid",
+		}),
+	)
+})
+
+var _ = Describe("reconcileNormal", func() {
+	const invalidOverrides = "replicaCount: [3"
+	var namespace *corev1.Namespace
+	var helmChartProxy *addonsv1alpha2.HelmChartProxy
+
+	BeforeEach(func() {
+		namespace = createNamespace()
+		helmChartProxy = newHelmChartProxy(namespace.Name)
+		createObject(helmChartProxy)
+		stubUnavailableRepository()
+	})
+
+	AfterEach(func() {
+		loadChart = internal.LoadChart
+		Expect(k8sClient.Delete(ctx, namespace)).To(Succeed())
+	})
+
+	// createClusters creates a Cluster for each name, with the value overrides of the HelmChartProxy of the same index.
+	createClusters := func(names []string, overrides ...string) []clusterv1.Cluster {
+		clusters := []clusterv1.Cluster{}
+		for i, name := range names {
+			cluster := newCluster(namespace.Name, name)
+			if i < len(overrides) && overrides[i] != "" {
+				cluster.Annotations = map[string]string{addonsv1alpha2.ValueOverridesAnnotationPrefix + helmChartProxy.Name: overrides[i]}
+			}
+			createObject(cluster)
+			clusters = append(clusters, *cluster)
+		}
+
+		return clusters
+	}
+
+	DescribeTable("reconciles every Cluster regardless of the failures of the others",
+		func(overrides []string, wantFailed []string, wantReconciled []string) {
+			r, _ := newReconciler()
+			r.ClusterConcurrency = 2
+			clusters := createClusters([]string{"cluster-1", "cluster-2", "cluster-3"}, overrides...)
+
+			result, clusterErrs, err := r.reconcileNormal(ctx, helmChartProxy, clusters, nil)
+			// The chart load failure doesn't prevent the Clusters from being reconciled, and is retried after a fixed
+			// interval instead of as an error.
+			Expect(result.RequeueAfter).To(Equal(chartLoadRequeueAfter))
+			if len(wantFailed) == 0 {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(conditions.GetReason(helmChartProxy, addonsv1alpha2.HelmReleaseProxySpecsUpToDateCondition)).To(Equal(addonsv1alpha2.ChartLoadFailedReason))
+				Expect(*conditions.GetSeverity(helmChartProxy, addonsv1alpha2.HelmReleaseProxySpecsUpToDateCondition)).To(Equal(clusterv1.ConditionSeverityWarning))
+			} else {
+				Expect(err).To(HaveOccurred())
+			}
+
+			failed := []string{}
+			for _, clusterErr := range clusterErrs {
+				Expect(clusterErr.reason).To(Equal(addonsv1alpha2.ValueOverridesFailedReason))
+				failed = append(failed, clusterErr.clusterName)
+			}
+			Expect(failed).To(ConsistOf(wantFailed))
+
+			reconciled := []string{}
+			for _, helmReleaseProxy := range listHelmReleaseProxies(namespace.Name) {
+				reconciled = append(reconciled, helmReleaseProxy.Spec.ClusterRef.Name)
+			}
+			Expect(reconciled).To(ConsistOf(wantReconciled))
+		},
+		Entry("all Clusters are reconciled",
+			nil, []string{}, []string{"cluster-1", "cluster-2", "cluster-3"}),
+		Entry("a failing Cluster doesn't block the others",
+			[]string{"", invalidOverrides, ""}, []string{"cluster-2"}, []string{"cluster-1", "cluster-3"}),
+		Entry("every failing Cluster is reported",
+			[]string{invalidOverrides, "", invalidOverrides}, []string{"cluster-1", "cluster-3"}, []string{"cluster-2"}),
+	)
+
+	It("sets the Cluster as an owner of the HelmReleaseProxies", func() {
+		r, _ := newReconciler()
+		clusters := createClusters([]string{"cluster-1", "cluster-2"})
+
+		_, clusterErrs, err := r.reconcileNormal(ctx, helmChartProxy, clusters, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusterErrs).To(BeEmpty())
+
+		helmReleaseProxies := listHelmReleaseProxies(namespace.Name)
+		Expect(helmReleaseProxies).To(HaveLen(len(clusters)))
+		for _, cluster := range clusters {
+			helmReleaseProxy := findHelmReleaseProxy(helmReleaseProxies, cluster.Name)
+			Expect(helmReleaseProxy).NotTo(BeNil())
+			Expect(helmReleaseProxy.OwnerReferences).To(ContainElement(metav1.OwnerReference{
+				APIVersion: clusterv1.GroupVersion.String(),
+				Kind:       "Cluster",
+				Name:       cluster.Name,
+				UID:        cluster.UID,
+			}))
+		}
+	})
+
+	Context("when a Cluster is paused", func() {
+		var paused clusterv1.Cluster
+
+		BeforeEach(func() {
+			cluster := newCluster(namespace.Name, "paused")
+			cluster.Spec.Paused = true
+			createObject(cluster)
+			paused = *cluster
+		})
+
+		It("doesn't create a HelmReleaseProxy for it", func() {
+			r, _ := newReconciler()
+			clusters := append(createClusters([]string{"cluster-1"}), paused)
+
+			_, clusterErrs, _ := r.reconcileNormal(ctx, helmChartProxy, clusters, nil)
+			Expect(clusterErrs).To(BeEmpty())
+
+			helmReleaseProxies := listHelmReleaseProxies(namespace.Name)
+			Expect(helmReleaseProxies).To(HaveLen(1))
+			Expect(helmReleaseProxies[0].Spec.ClusterRef.Name).To(Equal("cluster-1"))
+		})
+
+		It("doesn't update the HelmReleaseProxy that clusterctl move created without a status", func() {
+			r, _ := newReconciler()
+			moved := newHelmReleaseProxy(namespace.Name, paused.Name)
+			moved.Spec.Values = &apiextensionsv1.JSON{Raw: []byte(`{"replicaCount":2}`)}
+			createObject(moved)
+
+			_, clusterErrs, _ := r.reconcileNormal(ctx, helmChartProxy, []clusterv1.Cluster{paused}, nil)
+			Expect(clusterErrs).To(BeEmpty())
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(moved), moved)).To(Succeed())
+			Expect(string(moved.Spec.Values.Raw)).To(Equal(`{"replicaCount":2}`))
+		})
+	})
+})
+
+var _ = Describe("immutableFieldChanges", func() {
+	helmChartProxy := &addonsv1alpha2.HelmChartProxy{
+		Spec: addonsv1alpha2.HelmChartProxySpec{
+			ChartName:        "nginx",
+			RepoURL:          "https://charts.example.com",
+			ReleaseNamespace: "default",
+		},
+	}
+	withReleaseName := func(releaseName string) func(*addonsv1alpha2.HelmChartProxy) {
+		return func(helmChartProxy *addonsv1alpha2.HelmChartProxy) {
+			helmChartProxy.Spec.ReleaseName = releaseName
+		}
+	}
+
+	DescribeTable("returns the immutable fields of a HelmReleaseProxy that differ from its HelmChartProxy",
+		func(spec addonsv1alpha2.HelmReleaseProxySpec, generatedName bool, update func(*addonsv1alpha2.HelmChartProxy), want []string) {
+			hcp := helmChartProxy.DeepCopy()
+			if update != nil {
+				update(hcp)
+			}
+			existing := &addonsv1alpha2.HelmReleaseProxy{Spec: spec}
+			if generatedName {
+				existing.Annotations = map[string]string{addonsv1alpha2.IsReleaseNameGeneratedAnnotation: "true"}
+			}
+
+			Expect(immutableFieldChanges(existing, hcp)).To(Equal(want))
+		},
+		Entry("no changes",
+			addonsv1alpha2.HelmReleaseProxySpec{ChartName: "nginx", RepoURL: "https://charts.example.com", ReleaseName: "nginx-abcde", ReleaseNamespace: "default"},
+			true, nil, nil),
+		Entry("chart name and repository changed",
+			addonsv1alpha2.HelmReleaseProxySpec{ChartName: "ingress-nginx", RepoURL: "https://kubernetes.github.io/ingress-nginx", ReleaseName: "nginx-abcde", ReleaseNamespace: "default"},
+			true, nil, []string{"chartName", "repoURL"}),
+		Entry("release name set on generated name",
+			addonsv1alpha2.HelmReleaseProxySpec{ChartName: "nginx", RepoURL: "https://charts.example.com", ReleaseName: "nginx-abcde", ReleaseNamespace: "default"},
+			true, withReleaseName("nginx"), []string{"releaseName"}),
+		Entry("release name changed",
+			addonsv1alpha2.HelmReleaseProxySpec{ChartName: "nginx", RepoURL: "https://charts.example.com", ReleaseName: "nginx", ReleaseNamespace: "default"},
+			false, withReleaseName("ingress"), []string{"releaseName"}),
+		Entry("release name removed",
+			addonsv1alpha2.HelmReleaseProxySpec{ChartName: "nginx", RepoURL: "https://charts.example.com", ReleaseName: "nginx", ReleaseNamespace: "default"},
+			false, nil, []string{"releaseName"}),
+		Entry("namespace and storage changed",
+			addonsv1alpha2.HelmReleaseProxySpec{ChartName: "nginx", RepoURL: "https://charts.example.com", ReleaseName: "nginx-abcde", ReleaseNamespace: "ingress"},
+			true, func(helmChartProxy *addonsv1alpha2.HelmChartProxy) {
+				helmChartProxy.Spec.Storage = &addonsv1alpha2.HelmStorage{Driver: addonsv1alpha2.HelmStorageDriverConfigMap}
+			}, []string{"namespace", "storage"}),
+	)
+})
+
+var _ = Describe("reconcileReinstall", func() {
+	var namespace *corev1.Namespace
+	var cluster *clusterv1.Cluster
+
+	BeforeEach(func() {
+		namespace = createNamespace()
+		cluster = newCluster(namespace.Name, "test-cluster")
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, namespace)).To(Succeed())
+	})
+
+	// helmReleaseProxy returns a HelmReleaseProxy of the Cluster with a generated release name. It is outdated unless its
+	// chart is nginx.
+	helmReleaseProxy := func(name string, chartName string, ready bool) *addonsv1alpha2.HelmReleaseProxy {
+		helmReleaseProxy := newHelmReleaseProxy(namespace.Name, cluster.Name)
+		helmReleaseProxy.Name = name
+		helmReleaseProxy.Annotations = map[string]string{addonsv1alpha2.IsReleaseNameGeneratedAnnotation: "true"}
+		helmReleaseProxy.Spec.ChartName = chartName
+		helmReleaseProxy.Spec.ReleaseName = name
+		if ready {
+			conditions.MarkTrue(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition)
+		}
+		createHelmReleaseProxy(helmReleaseProxy, 1)
+
+		return helmReleaseProxy
+	}
+	// deletingHelmReleaseProxy returns an up to date HelmReleaseProxy that is being deleted, and is kept by a finalizer.
+	deletingHelmReleaseProxy := func(name string) *addonsv1alpha2.HelmReleaseProxy {
+		helmReleaseProxy := newHelmReleaseProxy(namespace.Name, cluster.Name)
+		helmReleaseProxy.Name = name
+		helmReleaseProxy.Finalizers = []string{addonsv1alpha2.HelmReleaseProxyFinalizer}
+		createObject(helmReleaseProxy)
+		Expect(k8sClient.Delete(ctx, helmReleaseProxy)).To(Succeed())
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(helmReleaseProxy), helmReleaseProxy)).To(Succeed())
+
+		return helmReleaseProxy
+	}
+
+	type reinstallCase struct {
+		strategy           addonsv1alpha2.ReinstallStrategy
+		releaseName        string
+		helmReleaseProxies func() []*addonsv1alpha2.HelmReleaseProxy
+		wantExisting       string
+		wantProceed        bool
+		wantReason         string
+		wantTerminal       bool
+		wantDeleted        []string
+	}
+
+	DescribeTable("replaces the outdated HelmReleaseProxies according to the reinstall strategy",
+		func(tc reinstallCase) {
+			r, _ := newReconciler()
+			helmChartProxy := newHelmChartProxy(namespace.Name)
+			helmChartProxy.Spec.ReleaseName = tc.releaseName
+			helmChartProxy.Spec.ReinstallStrategy = tc.strategy
+			var helmReleaseProxies []*addonsv1alpha2.HelmReleaseProxy
+			if tc.helmReleaseProxies != nil {
+				helmReleaseProxies = tc.helmReleaseProxies()
+			}
+			items := []addonsv1alpha2.HelmReleaseProxy{}
+			for _, helmReleaseProxy := range helmReleaseProxies {
+				items = append(items, *helmReleaseProxy)
+			}
+
+			existing, proceed, err := r.reconcileReinstall(ctx, helmChartProxy, cluster, items)
+			if tc.wantExisting == "" {
+				Expect(existing).To(BeNil())
+			} else {
+				Expect(existing).NotTo(BeNil())
+				Expect(existing.Name).To(Equal(tc.wantExisting))
+			}
+			Expect(proceed).To(Equal(tc.wantProceed))
+			if tc.wantReason == "" {
+				Expect(err).To(BeNil())
+			} else {
+				Expect(err).NotTo(BeNil())
+				Expect(err.reason).To(Equal(tc.wantReason))
+				Expect(err.terminal).To(Equal(tc.wantTerminal))
+			}
+
+			for _, helmReleaseProxy := range helmReleaseProxies {
+				getErr := k8sClient.Get(ctx, client.ObjectKeyFromObject(helmReleaseProxy), &addonsv1alpha2.HelmReleaseProxy{})
+				if containsString(tc.wantDeleted, helmReleaseProxy.Name) {
+					Expect(apierrors.IsNotFound(getErr)).To(BeTrue(), "HelmReleaseProxy %s should be deleted", helmReleaseProxy.Name)
+				} else {
+					Expect(getErr).NotTo(HaveOccurred(), "HelmReleaseProxy %s should be kept", helmReleaseProxy.Name)
+				}
+			}
+		},
+		Entry("no HelmReleaseProxy", reinstallCase{
+			wantProceed: true,
+		}),
+		Entry("up to date HelmReleaseProxy", reinstallCase{
+			helmReleaseProxies: func() []*addonsv1alpha2.HelmReleaseProxy {
+				return []*addonsv1alpha2.HelmReleaseProxy{helmReleaseProxy("current", "nginx", true)}
+			},
+			wantExisting: "current",
+			wantProceed:  true,
+		}),
+		Entry("multiple up to date HelmReleaseProxies", reinstallCase{
+			helmReleaseProxies: func() []*addonsv1alpha2.HelmReleaseProxy {
+				return []*addonsv1alpha2.HelmReleaseProxy{helmReleaseProxy("current", "nginx", true), helmReleaseProxy("other", "nginx", true)}
+			},
+			wantReason: addonsv1alpha2.HelmReleaseProxyGetFailedReason,
+		}),
+		Entry("waits for the old HelmReleaseProxy to be deleted", reinstallCase{
+			helmReleaseProxies: func() []*addonsv1alpha2.HelmReleaseProxy {
+				return []*addonsv1alpha2.HelmReleaseProxy{deletingHelmReleaseProxy("deleting")}
+			},
+			wantReason: addonsv1alpha2.HelmReleaseProxyReinstallingReason,
+		}),
+		Entry("recreate deletes the outdated HelmReleaseProxy", reinstallCase{
+			strategy: addonsv1alpha2.ReinstallStrategyRecreate,
+			helmReleaseProxies: func() []*addonsv1alpha2.HelmReleaseProxy {
+				return []*addonsv1alpha2.HelmReleaseProxy{helmReleaseProxy("outdated", "ingress-nginx", true)}
+			},
+			wantReason:  addonsv1alpha2.HelmReleaseProxyReinstallingReason,
+			wantDeleted: []string{"outdated"},
+		}),
+		Entry("recreate is the default", reinstallCase{
+			helmReleaseProxies: func() []*addonsv1alpha2.HelmReleaseProxy {
+				return []*addonsv1alpha2.HelmReleaseProxy{helmReleaseProxy("outdated", "ingress-nginx", true)}
+			},
+			wantReason:  addonsv1alpha2.HelmReleaseProxyReinstallingReason,
+			wantDeleted: []string{"outdated"},
+		}),
+		Entry("recreate keeps a new HelmReleaseProxy", reinstallCase{
+			strategy: addonsv1alpha2.ReinstallStrategyRecreate,
+			helmReleaseProxies: func() []*addonsv1alpha2.HelmReleaseProxy {
+				return []*addonsv1alpha2.HelmReleaseProxy{helmReleaseProxy("outdated", "ingress-nginx", true), helmReleaseProxy("current", "nginx", false)}
+			},
+			wantExisting: "current",
+			wantProceed:  true,
+			wantDeleted:  []string{"outdated"},
+		}),
+		Entry("block keeps the outdated HelmReleaseProxy", reinstallCase{
+			strategy: addonsv1alpha2.ReinstallStrategyBlock,
+			helmReleaseProxies: func() []*addonsv1alpha2.HelmReleaseProxy {
+				return []*addonsv1alpha2.HelmReleaseProxy{helmReleaseProxy("outdated", "ingress-nginx", true)}
+			},
+			wantReason:   addonsv1alpha2.ReinstallBlockedReason,
+			wantTerminal: true,
+		}),
+		Entry("create before delete creates the new HelmReleaseProxy first", reinstallCase{
+			strategy: addonsv1alpha2.ReinstallStrategyCreateBeforeDelete,
+			helmReleaseProxies: func() []*addonsv1alpha2.HelmReleaseProxy {
+				return []*addonsv1alpha2.HelmReleaseProxy{helmReleaseProxy("outdated", "ingress-nginx", true)}
+			},
+			wantProceed: true,
+			wantReason:  addonsv1alpha2.HelmReleaseProxyReinstallingReason,
+		}),
+		Entry("create before delete waits for the new HelmReleaseProxy to be ready", reinstallCase{
+			strategy: addonsv1alpha2.ReinstallStrategyCreateBeforeDelete,
+			helmReleaseProxies: func() []*addonsv1alpha2.HelmReleaseProxy {
+				return []*addonsv1alpha2.HelmReleaseProxy{helmReleaseProxy("outdated", "ingress-nginx", true), helmReleaseProxy("current", "nginx", false)}
+			},
+			wantExisting: "current",
+			wantProceed:  true,
+			wantReason:   addonsv1alpha2.HelmReleaseProxyReinstallingReason,
+		}),
+		Entry("create before delete deletes the outdated HelmReleaseProxy once the new one is ready", reinstallCase{
+			strategy: addonsv1alpha2.ReinstallStrategyCreateBeforeDelete,
+			helmReleaseProxies: func() []*addonsv1alpha2.HelmReleaseProxy {
+				return []*addonsv1alpha2.HelmReleaseProxy{helmReleaseProxy("outdated", "ingress-nginx", true), helmReleaseProxy("current", "nginx", true)}
+			},
+			wantExisting: "current",
+			wantProceed:  true,
+			wantDeleted:  []string{"outdated"},
+		}),
+		Entry("create before delete is blocked by the same release name", reinstallCase{
+			strategy:    addonsv1alpha2.ReinstallStrategyCreateBeforeDelete,
+			releaseName: "outdated",
+			helmReleaseProxies: func() []*addonsv1alpha2.HelmReleaseProxy {
+				return []*addonsv1alpha2.HelmReleaseProxy{helmReleaseProxy("outdated", "ingress-nginx", true)}
+			},
+			wantReason:   addonsv1alpha2.ReinstallBlockedReason,
+			wantTerminal: true,
+		}),
+	)
+})
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
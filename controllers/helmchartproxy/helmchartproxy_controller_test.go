@@ -0,0 +1,63 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helmchartproxy
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
+)
+
+var _ = Describe("HelmChartProxy cluster selector index", func() {
+	DescribeTable("indexes a HelmChartProxy by the labels of its cluster selector",
+		func(selector metav1.LabelSelector, want []string) {
+			helmChartProxy := &addonsv1alpha2.HelmChartProxy{
+				Spec: addonsv1alpha2.HelmChartProxySpec{ClusterSelector: selector},
+			}
+
+			Expect(indexHelmChartProxyByClusterSelector(helmChartProxy)).To(ConsistOf(want))
+		},
+		Entry("selector without matchLabels selects all Clusters",
+			metav1.LabelSelector{}, []string{"*"}),
+		Entry("selector with only matchExpressions selects all Clusters",
+			metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "env", Operator: metav1.LabelSelectorOpExists}},
+			}, []string{"*"}),
+		Entry("selector with matchLabels is indexed by each label",
+			metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod", "cni": "calico"}}, []string{"env=prod", "cni=calico"}),
+	)
+
+	It("doesn't index an object that isn't a HelmChartProxy", func() {
+		Expect(indexHelmChartProxyByClusterSelector(&clusterv1.Cluster{})).To(BeEmpty())
+	})
+
+	It("looks up the HelmChartProxies selecting all Clusters for every Cluster", func() {
+		cluster := &clusterv1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"env": "prod"}},
+		}
+		indexValues := clusterSelectorIndexValuesForCluster(cluster)
+		Expect(indexValues).To(ConsistOf("*", "env=prod"))
+
+		selectAll := indexHelmChartProxyByClusterSelector(&addonsv1alpha2.HelmChartProxy{})
+		Expect(indexValues).To(ContainElements(selectAll))
+		Expect(clusterSelectorIndexValuesForCluster(&clusterv1.Cluster{})).To(ContainElements(selectAll))
+	})
+})
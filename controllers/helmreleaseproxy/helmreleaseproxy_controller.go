@@ -19,28 +19,108 @@ package helmreleaseproxy
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/release"
 	helmDriver "helm.sh/helm/v3/pkg/storage/driver"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	addonsv1alpha1 "cluster-api-addon-provider-helm/api/v1alpha1"
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
 	"cluster-api-addon-provider-helm/internal"
 
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/annotations"
 	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
 )
 
+// Event reasons recorded on HelmReleaseProxies.
+const (
+	// installedEventReason is recorded when the Helm release is installed on the Cluster.
+	installedEventReason = "Installed"
+	// upgradedEventReason is recorded when the Helm release is upgraded on the Cluster.
+	upgradedEventReason = "Upgraded"
+	// upToDateEventReason is recorded when the Helm release becomes up to date without requiring an upgrade.
+	upToDateEventReason = "UpToDate"
+	// uninstalledEventReason is recorded when the Helm release is uninstalled from the Cluster.
+	uninstalledEventReason = "Uninstalled"
+	// rolledBackEventReason is recorded when the Helm release is rolled back to a previous revision.
+	rolledBackEventReason = "RolledBack"
+	// testsPassedEventReason is recorded when the test hooks of the Helm release pass.
+	testsPassedEventReason = "TestsPassed"
+	// testsFailedEventReason is recorded when a test hook of the Helm release fails.
+	testsFailedEventReason = "TestsFailed"
+	// adoptedEventReason is recorded when an existing Helm release is taken over without changes, e.g. after the
+	// HelmReleaseProxy was moved to another management cluster with clusterctl move.
+	adoptedEventReason = "Adopted"
+	// insecureConnectionEventReason is recorded when Helm stops verifying the API server certificate of the Cluster.
+	insecureConnectionEventReason = "InsecureConnection"
+	// failedEventReason is recorded when a Helm operation on the Cluster fails.
+	failedEventReason = "Failed"
+)
+
+const (
+	// defaultReleaseTestTimeout is the time to wait for the test hooks of a Helm release if the HelmReleaseProxy doesn't specify one.
+	defaultReleaseTestTimeout = 5 * time.Minute
+
+	// crdDeletionRequeueAfter is the interval at which a HelmReleaseProxy checks whether the CRDs of its chart and their
+	// custom resources are removed before its release is uninstalled.
+	crdDeletionRequeueAfter = 5 * time.Second
+
+	// maxConditionMessageLength limits the size of the HelmReleaseReady condition message, which can include the logs of failed hooks.
+	maxConditionMessageLength = 4096
+	// maxEventMessageLength limits the size of Event messages, which the API server truncates at 1024 bytes.
+	maxEventMessageLength = 1000
+)
+
 // HelmReleaseProxyReconciler reconciles a HelmReleaseProxy object
 type HelmReleaseProxyReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// DefaultStorage is the Helm storage used for new releases of HelmReleaseProxies that don't specify one.
+	DefaultStorage addonsv1alpha2.HelmStorage
+
+	// DefaultStorageNamespace is the namespace of the SQL connection Secret of the DefaultStorage.
+	DefaultStorageNamespace string
+
+	// AllowCRDDeletion allows HelmReleaseProxies to delete the CRDs of their chart when the release is uninstalled.
+	AllowCRDDeletion bool
+
+	// DefaultServiceAccountName is the ServiceAccount in the release namespace that Helm impersonates for HelmReleaseProxies
+	// that don't specify an identity to impersonate.
+	DefaultServiceAccountName string
+
+	// RequireImpersonation refuses to manage the releases of HelmReleaseProxies that would use the credentials from the
+	// Cluster kubeconfig because neither they nor DefaultServiceAccountName specify an identity to impersonate. With
+	// DefaultServiceAccountName, it is also impersonated for HelmReleaseProxies whose identity is not allowed.
+	RequireImpersonation bool
+
+	// ImpersonationAllowlist lists the identities that HelmReleaseProxies in each namespace may impersonate.
+	ImpersonationAllowlist addonsv1alpha2.ImpersonationAllowlist
+
+	// AllowInsecureSkipTLSVerify allows Clusters to disable the verification of their API server certificate with the
+	// InsecureSkipTLSVerifyAnnotation. Otherwise the annotation is ignored.
+	AllowInsecureSkipTLSVerify bool
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -49,30 +129,31 @@ func (r *HelmReleaseProxyReconciler) SetupWithManager(ctx context.Context, mgr c
 
 	return ctrl.NewControllerManagedBy(mgr).
 		WithOptions(options).
-		For(&addonsv1alpha1.HelmReleaseProxy{}).
-		// Watches(
-		// 	&source.Kind{Type: &v1alpha1.HelmReleaseProxy{}},
-		// 	handler.EnqueueRequestsFromMapFunc(r.findProxyForSecret),
-		// 	builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
-		// ).
+		For(&addonsv1alpha2.HelmReleaseProxy{}).
+		// Watch Clusters so that HelmReleaseProxies waiting on Cluster readiness conditions are reconciled as soon as
+		// the conditions change, changes to the Cluster annotations are applied, and HelmReleaseProxies resume as soon as
+		// their Cluster is unpaused.
+		Watches(
+			&source.Kind{Type: &clusterv1.Cluster{}},
+			handler.EnqueueRequestsFromMapFunc(r.ClusterToHelmReleaseProxiesMapper),
+			builder.WithPredicates(clusterChangedForHelmReleaseProxies()),
+		).
 		Complete(r)
 }
 
 //+kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=helmreleaseproxies,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=helmreleaseproxies/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=helmreleaseproxies/finalizers,verbs=update
-//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters,verbs=get;watch
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters,verbs=get;list;watch
 //+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;watch
 //+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=secrets,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io;bootstrap.cluster.x-k8s.io;controlplane.cluster.x-k8s.io,resources=*,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=chartsourcepolicies,verbs=get;list;watch
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the HelmReleaseProxy object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
+// Reconcile installs, upgrades or uninstalls the Helm release of a HelmReleaseProxy on its Cluster and reports the
+// state of the release in the status of the HelmReleaseProxy.
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.11.0/pkg/reconcile
@@ -82,7 +163,7 @@ func (r *HelmReleaseProxyReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	log.V(2).Info("Beginning reconcilation for HelmReleaseProxy", "requestNamespace", req.Namespace, "requestName", req.Name)
 
 	// Fetch the HelmReleaseProxy instance.
-	helmReleaseProxy := &addonsv1alpha1.HelmReleaseProxy{}
+	helmReleaseProxy := &addonsv1alpha2.HelmReleaseProxy{}
 	if err := r.Client.Get(ctx, req.NamespacedName, helmReleaseProxy); err != nil {
 		if apierrors.IsNotFound(err) {
 			log.V(2).Info("HelmReleaseProxy resource not found, skipping reconciliation", "helmReleaseProxy", req.NamespacedName)
@@ -121,8 +202,8 @@ func (r *HelmReleaseProxyReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		// The object is not being deleted, so if it does not have our finalizer,
 		// then lets add the finalizer and update the object. This is equivalent
 		// registering our finalizer.
-		if !controllerutil.ContainsFinalizer(helmReleaseProxy, addonsv1alpha1.HelmReleaseProxyFinalizer) {
-			controllerutil.AddFinalizer(helmReleaseProxy, addonsv1alpha1.HelmReleaseProxyFinalizer)
+		if !controllerutil.ContainsFinalizer(helmReleaseProxy, addonsv1alpha2.HelmReleaseProxyFinalizer) {
+			controllerutil.AddFinalizer(helmReleaseProxy, addonsv1alpha2.HelmReleaseProxyFinalizer)
 			if err := patchHelmReleaseProxy(ctx, patchHelper, helmReleaseProxy); err != nil {
 				// TODO: Should we try to set the error here? If we can't remove the finalizer we likely can't update the status either.
 				return ctrl.Result{}, err
@@ -130,37 +211,56 @@ func (r *HelmReleaseProxyReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		}
 	} else {
 		// The object is being deleted
-		if controllerutil.ContainsFinalizer(helmReleaseProxy, addonsv1alpha1.HelmReleaseProxyFinalizer) {
+		if controllerutil.ContainsFinalizer(helmReleaseProxy, addonsv1alpha2.HelmReleaseProxyFinalizer) {
 			// our finalizer is present, so lets handle any external dependency
-			if err := r.Client.Get(ctx, clusterKey, cluster); err == nil {
+			err := r.Client.Get(ctx, clusterKey, cluster)
+			if err != nil && !apierrors.IsNotFound(err) {
+				wrappedErr := errors.Wrapf(err, "failed to get cluster %s/%s", clusterKey.Namespace, clusterKey.Name)
+				conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.ClusterAvailableCondition, addonsv1alpha2.GetClusterFailedReason, clusterv1.ConditionSeverityError, wrappedErr.Error())
+
+				return ctrl.Result{}, wrappedErr
+			}
+			// Keep the finalizer and the release while paused, so that the release isn't uninstalled from a Cluster that
+			// is e.g. being moved with clusterctl move.
+			if r.reconcilePaused(ctx, helmReleaseProxy, cluster) {
+				return ctrl.Result{}, nil
+			}
+
+			if err == nil {
 				log.V(2).Info("Getting kubeconfig for cluster", "cluster", cluster.Name)
 				kubeconfig, err := internal.GetClusterKubeconfig(ctx, cluster)
 				if err != nil {
 					wrappedErr := errors.Wrapf(err, "failed to get kubeconfig for cluster")
-					conditions.MarkFalse(helmReleaseProxy, addonsv1alpha1.ClusterAvailableCondition, addonsv1alpha1.GetKubeconfigFailedReason, clusterv1.ConditionSeverityError, wrappedErr.Error())
+					conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.ClusterAvailableCondition, addonsv1alpha2.GetKubeconfigFailedReason, clusterv1.ConditionSeverityError, wrappedErr.Error())
 
 					return ctrl.Result{}, wrappedErr
 				}
-				conditions.MarkTrue(helmReleaseProxy, addonsv1alpha1.ClusterAvailableCondition)
+				conditions.MarkTrue(helmReleaseProxy, addonsv1alpha2.ClusterAvailableCondition)
+
+				clientOptions, err := r.helmClientOptions(ctx, helmReleaseProxy, cluster, kubeconfig)
+				if err != nil {
+					return ctrl.Result{}, r.reportHelmClientOptionsError(helmReleaseProxy, err)
+				}
+				r.reconcileTLSVerification(ctx, helmReleaseProxy, cluster, clientOptions)
 
-				if err := r.reconcileDelete(ctx, helmReleaseProxy, kubeconfig); err != nil {
+				result, err := r.reconcileDelete(ctx, helmReleaseProxy, clientOptions)
+				if err != nil {
 					// if fail to delete the external dependency here, return with error
 					// so that it can be retried
 					return ctrl.Result{}, err
 				}
-			} else if apierrors.IsNotFound(err) {
+				if !result.IsZero() {
+					return result, nil
+				}
+			} else {
 				// Cluster is gone, so we should remove our finalizer from the list and delete
-				log.V(2).Info("Cluster not found, no need to delete external dependency", "cluster", cluster.Name)
+				log.V(2).Info("Cluster not found, no need to delete external dependency", "cluster", clusterKey.Name)
 				// TODO: should we set a condition here?
-			} else {
-				wrappedErr := errors.Wrapf(err, "failed to get cluster %s/%s", clusterKey.Namespace, clusterKey.Name)
-				conditions.MarkFalse(helmReleaseProxy, addonsv1alpha1.ClusterAvailableCondition, addonsv1alpha1.GetClusterFailedReason, clusterv1.ConditionSeverityError, wrappedErr.Error())
-
-				return ctrl.Result{}, wrappedErr
 			}
 
 			// remove our finalizer from the list and update it.
-			controllerutil.RemoveFinalizer(helmReleaseProxy, addonsv1alpha1.HelmReleaseProxyFinalizer)
+			controllerutil.RemoveFinalizer(helmReleaseProxy, addonsv1alpha2.HelmReleaseProxyFinalizer)
+			internal.DeleteReleaseMetrics(helmReleaseProxy)
 			if err := patchHelmReleaseProxy(ctx, patchHelper, helmReleaseProxy); err != nil {
 				// TODO: Should we try to set the error here? If we can't remove the finalizer we likely can't update the status either.
 				return ctrl.Result{}, err
@@ -174,133 +274,781 @@ func (r *HelmReleaseProxyReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	if err := r.Client.Get(ctx, clusterKey, cluster); err != nil {
 		// TODO: add check to tell if Cluster is deleted so we can remove the HelmReleaseProxy.
 		wrappedErr := errors.Wrapf(err, "failed to get cluster %s/%s", clusterKey.Namespace, clusterKey.Name)
-		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha1.ClusterAvailableCondition, addonsv1alpha1.GetClusterFailedReason, clusterv1.ConditionSeverityError, wrappedErr.Error())
+		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.ClusterAvailableCondition, addonsv1alpha2.GetClusterFailedReason, clusterv1.ConditionSeverityError, wrappedErr.Error())
 
 		return ctrl.Result{}, wrappedErr
 	}
 
+	// clusterctl move pauses the Cluster while its objects are moved, so the release must not be changed until the
+	// HelmReleaseProxy has been adopted on the target management cluster.
+	if r.reconcilePaused(ctx, helmReleaseProxy, cluster) {
+		return ctrl.Result{}, nil
+	}
+
+	if unmet := internal.GetUnmetClusterConditions(cluster, helmReleaseProxy.Spec.ClusterReadinessConditions); len(unmet) > 0 {
+		// The Cluster watch will requeue this HelmReleaseProxy once the Cluster conditions change.
+		log.V(2).Info("Waiting for Cluster readiness conditions before installing", "cluster", cluster.Name, "conditions", unmet)
+		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.ClusterAvailableCondition, addonsv1alpha2.WaitingForClusterReadinessReason, clusterv1.ConditionSeverityInfo, "Waiting for conditions %s to be true on cluster %s", strings.Join(unmet, ", "), cluster.Name)
+
+		return ctrl.Result{}, nil
+	}
+
 	log.V(2).Info("Getting kubeconfig for cluster", "cluster", cluster.Name)
 	kubeconfig, err := internal.GetClusterKubeconfig(ctx, cluster)
 	if err != nil {
 		wrappedErr := errors.Wrapf(err, "failed to get kubeconfig for cluster")
-		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha1.ClusterAvailableCondition, addonsv1alpha1.GetKubeconfigFailedReason, clusterv1.ConditionSeverityError, wrappedErr.Error())
+		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.ClusterAvailableCondition, addonsv1alpha2.GetKubeconfigFailedReason, clusterv1.ConditionSeverityError, wrappedErr.Error())
 
 		return ctrl.Result{}, wrappedErr
 	}
-	conditions.MarkTrue(helmReleaseProxy, addonsv1alpha1.ClusterAvailableCondition)
+	conditions.MarkTrue(helmReleaseProxy, addonsv1alpha2.ClusterAvailableCondition)
+
+	clientOptions, err := r.helmClientOptions(ctx, helmReleaseProxy, cluster, kubeconfig)
+	if err != nil {
+		return ctrl.Result{}, r.reportHelmClientOptionsError(helmReleaseProxy, err)
+	}
+	r.reconcileTLSVerification(ctx, helmReleaseProxy, cluster, clientOptions)
 
 	log.V(2).Info("Reconciling HelmReleaseProxy", "releaseProxyName", helmReleaseProxy.Name)
-	err = r.reconcileNormal(ctx, helmReleaseProxy, kubeconfig)
+	err = r.reconcileNormal(ctx, patchHelper, helmReleaseProxy, clientOptions)
 
 	return ctrl.Result{}, err
 }
 
+// clusterChangedForHelmReleaseProxies filters Cluster updates to the changes that affect the HelmReleaseProxies of the
+// Cluster, so that status updates such as heartbeats of the Cluster conditions don't reconcile every Helm release on it.
+func clusterChangedForHelmReleaseProxies() predicate.Funcs {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldCluster, ok := e.ObjectOld.(*clusterv1.Cluster)
+			if !ok {
+				return false
+			}
+			newCluster, ok := e.ObjectNew.(*clusterv1.Cluster)
+			if !ok {
+				return false
+			}
+
+			return clusterChanged(oldCluster, newCluster)
+		},
+	}
+}
+
+// clusterChanged returns true if the Cluster was paused or unpaused, if the status of one of its conditions changed, e.g.
+// when the control plane becomes initialized or a readiness condition becomes true, or if an annotation read by the
+// HelmReleaseProxy controller changed.
+func clusterChanged(oldCluster, newCluster *clusterv1.Cluster) bool {
+	if oldCluster.Spec.Paused != newCluster.Spec.Paused || oldCluster.Spec.ControlPlaneEndpoint != newCluster.Spec.ControlPlaneEndpoint {
+		return true
+	}
+
+	oldConditions := map[clusterv1.ConditionType]corev1.ConditionStatus{}
+	for _, condition := range oldCluster.GetConditions() {
+		oldConditions[condition.Type] = condition.Status
+	}
+	newConditions := newCluster.GetConditions()
+	if len(oldConditions) != len(newConditions) {
+		return true
+	}
+	for _, condition := range newConditions {
+		if status, ok := oldConditions[condition.Type]; !ok || status != condition.Status {
+			return true
+		}
+	}
+
+	return !reflect.DeepEqual(relevantClusterAnnotations(oldCluster), relevantClusterAnnotations(newCluster))
+}
+
+// relevantClusterAnnotations returns the annotations of a Cluster that are read by the HelmReleaseProxy controller.
+func relevantClusterAnnotations(cluster *clusterv1.Cluster) map[string]string {
+	relevant := map[string]string{}
+	for key, value := range cluster.GetAnnotations() {
+		if key == clusterv1.PausedAnnotation || key == addonsv1alpha2.InsecureSkipTLSVerifyAnnotation || strings.HasPrefix(key, addonsv1alpha2.ValueOverridesAnnotationPrefix) {
+			relevant[key] = value
+		}
+	}
+
+	return relevant
+}
+
 // reconcileNormal,...
-func (r *HelmReleaseProxyReconciler) reconcileNormal(ctx context.Context, helmReleaseProxy *addonsv1alpha1.HelmReleaseProxy, kubeconfig string) error {
+func (r *HelmReleaseProxyReconciler) reconcileNormal(ctx context.Context, patchHelper *patch.Helper, helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy, clientOptions internal.HelmClientOptions) error {
 	log := ctrl.LoggerFrom(ctx)
 
 	log.V(2).Info("Reconciling HelmReleaseProxy on cluster", "HelmReleaseProxy", helmReleaseProxy.Name, "cluster", helmReleaseProxy.Spec.ClusterRef.Name)
 
 	// TODO: add this here or in HelmChartProxy controller?
 	if helmReleaseProxy.Spec.ReleaseName == "" {
-		helmReleaseProxy.ObjectMeta.SetAnnotations(map[string]string{
-			addonsv1alpha1.IsReleaseNameGeneratedAnnotation: "true",
-		})
+		annotations := helmReleaseProxy.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[addonsv1alpha2.IsReleaseNameGeneratedAnnotation] = "true"
+		helmReleaseProxy.SetAnnotations(annotations)
+	}
+
+	// Requests are recorded as handled once they were acted on: a resync by this reconcile, a reinstall by the uninstall,
+	// and a forced upgrade by the upgrade.
+	if requestedAt, ok := helmReleaseProxy.Annotations[addonsv1alpha2.ReconcileRequestedAtAnnotation]; ok {
+		helmReleaseProxy.Status.SetLastHandled(addonsv1alpha2.ReconcileRequestedAtAnnotation, requestedAt)
+	}
+	forceUpgradeAt, forceUpgrade := pendingReconcileRequest(helmReleaseProxy, addonsv1alpha2.ForceUpgradeAtAnnotation)
+	forceReinstallAt, forceReinstall := pendingReconcileRequest(helmReleaseProxy, addonsv1alpha2.ForceReinstallAtAnnotation)
+
+	wasReady := conditions.IsTrue(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition)
+	previousVersion := helmReleaseProxy.Status.Version
+	// The status is empty for a new HelmReleaseProxy, and for one that was moved from another management cluster.
+	previousRevision := helmReleaseProxy.Status.Revision
+
+	if err := r.checkChartSourcePolicies(ctx, helmReleaseProxy); err != nil {
+		if addonsv1alpha2.IsChartSourceNotAllowed(err) {
+			// Retrying won't help until the policies change, which is picked up by the periodic resync.
+			conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition, addonsv1alpha2.ChartSourceNotAllowedReason, clusterv1.ConditionSeverityError, err.Error())
+			r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeWarning, failedEventReason, "Refusing to install or upgrade Helm release on cluster %s: %v", helmReleaseProxy.Spec.ClusterRef.Name, err)
+
+			return nil
+		}
+		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition, addonsv1alpha2.ChartSourcePolicyCheckFailedReason, clusterv1.ConditionSeverityError, err.Error())
+
+		return err
+	}
+
+	if !forceUpgrade && !forceReinstall && helmReleaseProxy.TestsEnabled() && helmReleaseProxy.Spec.Tests.RollbackOnFailure && helmReleaseProxy.Status.Tests != nil && helmReleaseProxy.Status.Tests.RolledBackGeneration == helmReleaseProxy.Generation {
+		log.V(2).Info("Upgrade was rolled back because its tests failed, waiting for the spec to change", "generation", helmReleaseProxy.Generation)
+		helmReleaseProxy.Status.ObservedGeneration = helmReleaseProxy.Generation
+
+		return nil
 	}
 
 	log.V(2).Info(fmt.Sprintf("Preparing to install or upgrade release '%s' on cluster %s", helmReleaseProxy.Spec.ReleaseName, helmReleaseProxy.Spec.ClusterRef.Name))
-	release, changed, err := internal.InstallOrUpgradeHelmRelease(ctx, kubeconfig, helmReleaseProxy.Spec)
+	postRenderer := internal.NewPostRenderer(helmReleaseProxy.Spec.PostRenderers, helmReleaseProxy.Spec.RegistryMirrors)
+	if forceReinstall {
+		if err := r.uninstallForReinstall(ctx, helmReleaseProxy, clientOptions); err != nil {
+			return err
+		}
+		// The release history is gone, so the hooks of every revision of the new release are diagnosed if the install fails.
+		previousRevision = 0
+		helmReleaseProxy.SetReleaseRevision(0)
+		// Persist the handled request right away, so that the release isn't uninstalled again if the install fails.
+		setLastHandledReconcileRequest(helmReleaseProxy, addonsv1alpha2.ForceReinstallAtAnnotation, forceReinstallAt)
+		if err := patchHelmReleaseProxy(ctx, patchHelper, helmReleaseProxy); err != nil {
+			return err
+		}
+	}
+	// Post-renderers aren't recorded in the release, so compare them with the ones recorded at the last install or upgrade.
+	// A release adopted without a status is assumed to be rendered with the current post-renderers.
+	postRendererHash := postRenderer.Hash()
+	postRendererChanged := previousRevision != 0 && postRendererHash != helmReleaseProxy.Status.PostRendererHash
+	if postRendererChanged {
+		log.V(2).Info("Post-renderers changed, upgrading release", "release", helmReleaseProxy.Spec.ReleaseName)
+	}
+	release, changed, err := internal.InstallOrUpgradeHelmRelease(ctx, clientOptions, helmReleaseProxy.Spec, postRenderer, forceUpgrade || postRendererChanged)
 	if err != nil {
 		log.V(2).Error(err, "error installing or updating chart with Helm on cluster", "cluster", helmReleaseProxy.Spec.ClusterRef.Name)
-		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha1.HelmReleaseReadyCondition, addonsv1alpha1.HelmInstallOrUpgradeFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		message := err.Error()
+		class := internal.ClassifyHelmError(err)
+		if class.Reason == addonsv1alpha2.HookFailedReason {
+			// Hooks report only that they failed, so add the status, events and logs of the failed hooks to the message.
+			diagnostics, diagErr := internal.DiagnoseHookFailures(ctx, clientOptions, helmReleaseProxy.Spec, previousRevision)
+			if diagErr != nil {
+				log.V(2).Info("Failed to collect diagnostics of failed hooks", "error", diagErr.Error())
+			}
+			if diagnostics != "" {
+				message = truncateMessage(fmt.Sprintf("%s\n%s", message, diagnostics), maxConditionMessageLength)
+			}
+		}
+		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition, class.Reason, class.Severity, "%s", message)
+		r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeWarning, failedEventReason, "Failed to install or upgrade Helm release on cluster %s (%s): %s", helmReleaseProxy.Spec.ClusterRef.Name, class.Reason, truncateMessage(message, maxEventMessageLength))
+		internal.RecordReleaseFailure(helmReleaseProxy)
 
+		if class.Terminal {
+			// Retrying won't help until the spec, the chart or the Cluster changes, which is picked up by the watches and
+			// the periodic resync, so don't requeue with backoff.
+			log.V(2).Info("Not retrying install or upgrade after terminal error", "reason", class.Reason)
+
+			return nil
+		}
+
+		// Transient errors are returned so that the request is requeued with exponential backoff.
 		return errors.Wrapf(err, "error installing or updating chart with Helm on cluster %s", helmReleaseProxy.Spec.ClusterRef.Name)
 	}
 	if release != nil {
-		if changed {
-			log.V(2).Info((fmt.Sprintf("Release '%s' successfully installed or updated on cluster %s, revision = %d", release.Name, helmReleaseProxy.Spec.ClusterRef.Name, release.Version)))
-		} else {
+		version := ""
+		if release.Chart != nil && release.Chart.Metadata != nil {
+			version = release.Chart.Metadata.Version
+		}
+
+		switch {
+		case changed && release.Version == 1:
+			log.V(2).Info((fmt.Sprintf("Release '%s' successfully installed on cluster %s, revision = %d", release.Name, helmReleaseProxy.Spec.ClusterRef.Name, release.Version)))
+			r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeNormal, installedEventReason, "Installed release %s with chart %s version %s on cluster %s", release.Name, helmReleaseProxy.Spec.ChartName, version, helmReleaseProxy.Spec.ClusterRef.Name)
+		case changed:
+			log.V(2).Info((fmt.Sprintf("Release '%s' successfully updated on cluster %s, revision = %d", release.Name, helmReleaseProxy.Spec.ClusterRef.Name, release.Version)))
+			r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeNormal, upgradedEventReason, "Upgraded release %s on cluster %s from version %s to %s, revision = %d", release.Name, helmReleaseProxy.Spec.ClusterRef.Name, previousVersion, version, release.Version)
+		case previousRevision == 0:
+			log.V(2).Info(fmt.Sprintf("Adopted existing release '%s' on cluster %s without changes, revision = %d", release.Name, helmReleaseProxy.Spec.ClusterRef.Name, release.Version))
+			r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeNormal, adoptedEventReason, "Adopted existing release %s on cluster %s, revision = %d", release.Name, helmReleaseProxy.Spec.ClusterRef.Name, release.Version)
+			if helmReleaseProxy.TestsEnabled() && helmReleaseProxy.Status.Tests == nil {
+				// The tests of the revision already ran before the release was adopted, so they aren't run again.
+				helmReleaseProxy.SetTestsStatus(&addonsv1alpha2.ReleaseTestsStatus{Revision: release.Version})
+			}
+		default:
 			log.V(2).Info((fmt.Sprintf("Release '%s' is up to date on cluster %s, no upgrade required, revision = %d", release.Name, helmReleaseProxy.Spec.ClusterRef.Name, release.Version)))
+			// Only record the transition so the periodic resync doesn't emit an Event every time.
+			if !wasReady {
+				r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeNormal, upToDateEventReason, "Release %s is up to date on cluster %s, revision = %d", release.Name, helmReleaseProxy.Spec.ClusterRef.Name, release.Version)
+			}
 		}
 
 		helmReleaseProxy.SetReleaseStatus(release.Info.Status.String())
 		helmReleaseProxy.SetReleaseRevision(release.Version)
+		helmReleaseProxy.SetReleaseVersion(version)
 		helmReleaseProxy.SetReleaseName(release.Name)
-		conditions.MarkTrue(helmReleaseProxy, addonsv1alpha1.HelmReleaseReadyCondition)
+		// The post-renderer only runs when the release is installed or upgraded.
+		if changed {
+			helmReleaseProxy.SetRewrittenImages(postRenderer.RewrittenImages())
+		}
+		helmReleaseProxy.Status.PostRendererHash = postRendererHash
+		helmReleaseProxy.SetStorageDriver(clientOptions.StorageDriver)
+		if forceUpgrade {
+			setLastHandledReconcileRequest(helmReleaseProxy, addonsv1alpha2.ForceUpgradeAtAnnotation, forceUpgradeAt)
+		}
+		if helmReleaseProxy.Spec.Storage == nil {
+			annotations := helmReleaseProxy.GetAnnotations()
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[addonsv1alpha2.StorageDriverAnnotation] = string(clientOptions.StorageDriver)
+			helmReleaseProxy.SetAnnotations(annotations)
+		}
+		helmReleaseProxy.Status.ObservedGeneration = helmReleaseProxy.Generation
+		conditions.MarkTrue(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition)
+		internal.ResetReleaseFailures(helmReleaseProxy)
+		internal.SetReleaseMetric(helmReleaseProxy, version, release.Info.Status.String())
 		// addClusterRefToStatusList(ctx, helmReleaseProxy, cluster)
+
+		return r.reconcileReleaseTests(ctx, helmReleaseProxy, clientOptions, release, changed)
+	}
+
+	return nil
+}
+
+// lastHandledAnnotations maps the reconcile request annotations whose actions must not be repeated after clusterctl move
+// to the annotations recording their last handled value.
+var lastHandledAnnotations = map[string]string{
+	addonsv1alpha2.ForceUpgradeAtAnnotation:   addonsv1alpha2.LastHandledForceUpgradeAtAnnotation,
+	addonsv1alpha2.ForceReinstallAtAnnotation: addonsv1alpha2.LastHandledForceReinstallAtAnnotation,
+}
+
+// pendingReconcileRequest returns the value of a reconcile request annotation of a HelmReleaseProxy, and whether the
+// value was not handled yet.
+func pendingReconcileRequest(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy, annotation string) (string, bool) {
+	value, ok := helmReleaseProxy.Annotations[annotation]
+	if !ok {
+		return "", false
+	}
+
+	// The status is cleared by clusterctl move, so prefer the last handled value recorded in the annotations.
+	if lastHandledAnnotation, ok := lastHandledAnnotations[annotation]; ok {
+		if lastHandled, ok := helmReleaseProxy.Annotations[lastHandledAnnotation]; ok {
+			return value, value != lastHandled
+		}
+	}
+
+	return value, value != helmReleaseProxy.Status.GetLastHandled(annotation)
+}
+
+// setLastHandledReconcileRequest records the value of a reconcile request annotation of a HelmReleaseProxy as handled.
+func setLastHandledReconcileRequest(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy, annotation string, value string) {
+	helmReleaseProxy.Status.SetLastHandled(annotation, value)
+
+	lastHandledAnnotation, ok := lastHandledAnnotations[annotation]
+	if !ok {
+		return
+	}
+	annotations := helmReleaseProxy.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[lastHandledAnnotation] = value
+	helmReleaseProxy.SetAnnotations(annotations)
+}
+
+// uninstallForReinstall uninstalls the Helm release of a HelmReleaseProxy so that it is installed again, as requested by
+// the ForceReinstallAtAnnotation. The CRDs of the chart are kept. A release that was already uninstalled is skipped.
+func (r *HelmReleaseProxyReconciler) uninstallForReinstall(ctx context.Context, helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy, clientOptions internal.HelmClientOptions) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	clusterName := helmReleaseProxy.Spec.ClusterRef.Name
+	if helmReleaseProxy.Spec.ReleaseName == "" {
+		return nil
+	}
+
+	log.Info("Uninstalling release to reinstall it", "release", helmReleaseProxy.Spec.ReleaseName, "cluster", clusterName)
+	if _, err := internal.UninstallHelmRelease(ctx, clientOptions, helmReleaseProxy.Spec); err != nil {
+		if errors.Is(err, helmDriver.ErrReleaseNotFound) {
+			return nil
+		}
+		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition, addonsv1alpha2.HelmReleaseDeletionFailedReason, clusterv1.ConditionSeverityError, "Failed to uninstall release %s to reinstall it: %v", helmReleaseProxy.Spec.ReleaseName, err)
+		r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeWarning, failedEventReason, "Failed to uninstall release %s from cluster %s to reinstall it: %v", helmReleaseProxy.Spec.ReleaseName, clusterName, err)
+
+		return errors.Wrapf(err, "error uninstalling release %s on cluster %s to reinstall it", helmReleaseProxy.Spec.ReleaseName, clusterName)
+	}
+	r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeNormal, uninstalledEventReason, "Uninstalled release %s from cluster %s to reinstall it", helmReleaseProxy.Spec.ReleaseName, clusterName)
+
+	return nil
+}
+
+// reconcileReleaseTests runs the test hooks of a Helm release once per installed or upgraded revision, and rolls the release
+// back to its previous revision if they fail and the HelmReleaseProxy requests it.
+func (r *HelmReleaseProxyReconciler) reconcileReleaseTests(ctx context.Context, helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy, clientOptions internal.HelmClientOptions, rel *release.Release, changed bool) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	if !helmReleaseProxy.TestsEnabled() {
+		helmReleaseProxy.SetTestsStatus(nil)
+		conditions.Delete(helmReleaseProxy, addonsv1alpha2.ReleaseTestsPassedCondition)
+
+		return nil
+	}
+	if !changed && helmReleaseProxy.Status.Tests != nil && helmReleaseProxy.Status.Tests.Revision == rel.Version {
+		log.V(2).Info("Tests already ran for the current revision", "release", rel.Name, "revision", rel.Version)
+
+		return nil
+	}
+
+	timeout := defaultReleaseTestTimeout
+	if helmReleaseProxy.Spec.Tests.Timeout != nil {
+		timeout = helmReleaseProxy.Spec.Tests.Timeout.Duration
 	}
 
+	clusterName := helmReleaseProxy.Spec.ClusterRef.Name
+	log.V(2).Info("Running tests of release", "release", rel.Name, "revision", rel.Version, "timeout", timeout)
+	tested, testErr := internal.TestHelmRelease(ctx, clientOptions, helmReleaseProxy.Spec, timeout)
+	failed, err := r.reportReleaseTests(helmReleaseProxy, rel, tested, testErr)
+	if err != nil || !failed {
+		return err
+	}
+	if !helmReleaseProxy.Spec.Tests.RollbackOnFailure || rel.Version <= 1 {
+		return nil
+	}
+
+	log.Info("Rolling back release because its tests failed", "release", rel.Name, "revision", rel.Version)
+	if err := internal.RollbackHelmRelease(ctx, clientOptions, helmReleaseProxy.Spec); err != nil {
+		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition, addonsv1alpha2.HelmInstallOrUpgradeFailedReason, clusterv1.ConditionSeverityError, "Failed to roll back release %s after its tests failed: %v", rel.Name, err)
+		r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeWarning, failedEventReason, "Failed to roll back release %s on cluster %s after its tests failed: %v", rel.Name, clusterName, err)
+
+		return errors.Wrapf(err, "failed to roll back release %s on cluster %s", rel.Name, clusterName)
+	}
+
+	rolledBack, err := internal.GetHelmRelease(ctx, clientOptions, helmReleaseProxy.Spec)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get release %s on cluster %s after rolling it back", rel.Name, clusterName)
+	}
+	version := ""
+	if rolledBack.Chart != nil && rolledBack.Chart.Metadata != nil {
+		version = rolledBack.Chart.Metadata.Version
+	}
+	helmReleaseProxy.SetReleaseStatus(rolledBack.Info.Status.String())
+	helmReleaseProxy.SetReleaseRevision(rolledBack.Version)
+	helmReleaseProxy.SetReleaseVersion(version)
+	helmReleaseProxy.Status.Tests.RolledBackGeneration = helmReleaseProxy.Generation
+	internal.SetReleaseMetric(helmReleaseProxy, version, rolledBack.Info.Status.String())
+
+	conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition, addonsv1alpha2.ReleaseRolledBackReason, clusterv1.ConditionSeverityWarning, "Release %s was rolled back to revision %d because the tests of revision %d failed", rel.Name, rolledBack.Version, rel.Version)
+	r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeWarning, rolledBackEventReason, "Rolled back release %s on cluster %s to revision %d because the tests of revision %d failed", rel.Name, clusterName, rolledBack.Version, rel.Version)
+
 	return nil
 }
 
+// reportReleaseTests records the results of the test hooks of a release on a HelmReleaseProxy and sets the
+// ReleaseTestsPassed condition. It returns true if the tests ran and failed, and an error if they could not be run.
+func (r *HelmReleaseProxyReconciler) reportReleaseTests(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy, rel *release.Release, tested *release.Release, testErr error) (bool, error) {
+	clusterName := helmReleaseProxy.Spec.ClusterRef.Name
+	if tested == nil {
+		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.ReleaseTestsPassedCondition, addonsv1alpha2.ReleaseTestsRunFailedReason, clusterv1.ConditionSeverityError, testErr.Error())
+
+		return false, errors.Wrapf(testErr, "failed to run tests of release %s on cluster %s", rel.Name, clusterName)
+	}
+
+	helmReleaseProxy.SetTestsStatus(&addonsv1alpha2.ReleaseTestsStatus{
+		Revision: rel.Version,
+		Results:  internal.ReleaseTestResults(tested),
+	})
+	if testErr == nil {
+		conditions.MarkTrue(helmReleaseProxy, addonsv1alpha2.ReleaseTestsPassedCondition)
+		r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeNormal, testsPassedEventReason, "Tests of release %s revision %d passed on cluster %s", rel.Name, rel.Version, clusterName)
+
+		return false, nil
+	}
+
+	// The tests are not retried until the next install or upgrade, so the failure is reported without returning an error.
+	conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.ReleaseTestsPassedCondition, addonsv1alpha2.ReleaseTestsFailedReason, clusterv1.ConditionSeverityError, "Tests of release %s revision %d failed on cluster %s: %v", rel.Name, rel.Version, clusterName, testErr)
+	r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeWarning, testsFailedEventReason, "Tests of release %s revision %d failed on cluster %s: %v", rel.Name, rel.Version, clusterName, testErr)
+
+	return true, nil
+}
+
+// reconcilePaused reports whether the Cluster of a HelmReleaseProxy is paused or the HelmReleaseProxy has the paused
+// annotation, and sets the Paused condition accordingly. The Cluster watch requeues the HelmReleaseProxy when the Cluster
+// is unpaused.
+func (r *HelmReleaseProxyReconciler) reconcilePaused(ctx context.Context, helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy, cluster *clusterv1.Cluster) bool {
+	log := ctrl.LoggerFrom(ctx)
+
+	var reason, message string
+	switch {
+	case cluster.Spec.Paused:
+		reason = addonsv1alpha2.ClusterPausedReason
+		message = fmt.Sprintf("Cluster %s is paused", cluster.Name)
+	case annotations.HasPausedAnnotation(helmReleaseProxy):
+		reason = addonsv1alpha2.PausedAnnotationReason
+		message = fmt.Sprintf("HelmReleaseProxy has the %s annotation", clusterv1.PausedAnnotation)
+	default:
+		conditions.Delete(helmReleaseProxy, addonsv1alpha2.PausedCondition)
+
+		return false
+	}
+
+	log.V(2).Info("Reconciliation is paused", "reason", reason, "cluster", helmReleaseProxy.Spec.ClusterRef.Name)
+	conditions.Set(helmReleaseProxy, &clusterv1.Condition{
+		Type:    addonsv1alpha2.PausedCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	})
+
+	return true
+}
+
+// helmClientOptions returns the options for the Helm client managing the release of a HelmReleaseProxy on its Cluster.
+func (r *HelmReleaseProxyReconciler) helmClientOptions(ctx context.Context, helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy, cluster *clusterv1.Cluster, kubeconfig string) (internal.HelmClientOptions, error) {
+	clientOptions := internal.HelmClientOptions{
+		Kubeconfig:            kubeconfig,
+		InsecureSkipTLSVerify: r.AllowInsecureSkipTLSVerify && insecureSkipTLSVerifyRequested(cluster),
+		Cluster:               client.ObjectKeyFromObject(cluster),
+	}
+	impersonate, err := r.impersonation(helmReleaseProxy)
+	if err != nil {
+		return clientOptions, err
+	}
+	clientOptions.Impersonate = impersonate
+
+	storage, secretNamespace := r.getStorage(helmReleaseProxy)
+	clientOptions.StorageDriver = storage.Driver
+	if storage.Driver != addonsv1alpha2.HelmStorageDriverSQL {
+		return clientOptions, nil
+	}
+
+	if storage.SQLConnectionSecretRef == nil {
+		return clientOptions, errors.New("a connection Secret is required for the sql storage driver")
+	}
+	secret := &corev1.Secret{}
+	secretKey := client.ObjectKey{Namespace: secretNamespace, Name: storage.SQLConnectionSecretRef.Name}
+	if err := r.Client.Get(ctx, secretKey, secret); err != nil {
+		return clientOptions, errors.Wrapf(err, "failed to get SQL connection Secret %s", secretKey)
+	}
+	connectionString, ok := secret.Data[storage.SQLConnectionSecretRef.Key]
+	if !ok {
+		return clientOptions, errors.Errorf("SQL connection Secret %s has no key %s", secretKey, storage.SQLConnectionSecretRef.Key)
+	}
+	clientOptions.SQLConnectionString = string(connectionString)
+
+	return clientOptions, nil
+}
+
+// impersonationNotAllowedError is returned when the manager doesn't allow Helm to manage a release with the identity of a
+// HelmReleaseProxy. It is not retried since only a change of the HelmReleaseProxy or the manager configuration fixes it.
+type impersonationNotAllowedError struct {
+	err error
+}
+
+func (e *impersonationNotAllowedError) Error() string {
+	return e.err.Error()
+}
+
+// impersonation returns the identity Helm impersonates on the Cluster of a HelmReleaseProxy. Its identity must be on the
+// ImpersonationAllowlist even if the webhook was bypassed, e.g. for objects created before it enforced it. HelmReleaseProxies
+// without an allowed identity impersonate the DefaultServiceAccountName if it is set and impersonation is required.
+func (r *HelmReleaseProxyReconciler) impersonation(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) (rest.ImpersonationConfig, error) {
+	user, groups := helmReleaseProxy.GetImpersonatedUser()
+	if user != "" {
+		err := r.ImpersonationAllowlist.Check(helmReleaseProxy.Namespace, user, groups)
+		if err == nil {
+			return rest.ImpersonationConfig{UserName: user, Groups: groups}, nil
+		}
+		if !r.RequireImpersonation || r.DefaultServiceAccountName == "" {
+			return rest.ImpersonationConfig{}, &impersonationNotAllowedError{err: err}
+		}
+	}
+
+	if r.DefaultServiceAccountName != "" {
+		return rest.ImpersonationConfig{UserName: addonsv1alpha2.ServiceAccountUser(helmReleaseProxy.Spec.ReleaseNamespace, r.DefaultServiceAccountName)}, nil
+	}
+	if r.RequireImpersonation {
+		return rest.ImpersonationConfig{}, &impersonationNotAllowedError{err: errors.New("a ServiceAccount or user to impersonate is required")}
+	}
+
+	return rest.ImpersonationConfig{}, nil
+}
+
+// reportHelmClientOptionsError sets the HelmReleaseReady condition for an error returned by helmClientOptions and returns
+// the error to retry, or nil if it is terminal.
+func (r *HelmReleaseProxyReconciler) reportHelmClientOptionsError(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy, err error) error {
+	var impersonationErr *impersonationNotAllowedError
+	if errors.As(err, &impersonationErr) {
+		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition, addonsv1alpha2.ImpersonationNotAllowedReason, clusterv1.ConditionSeverityError, err.Error())
+		r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeWarning, failedEventReason, "Refusing to manage Helm release on cluster %s: %v", helmReleaseProxy.Spec.ClusterRef.Name, err)
+
+		return nil
+	}
+
+	conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition, addonsv1alpha2.HelmStorageConfigFailedReason, clusterv1.ConditionSeverityError, err.Error())
+
+	return err
+}
+
+// reconcileTLSVerification reports whether Helm verifies the API server certificate of the Cluster. Disabling verification
+// is logged on every reconcile and recorded as an Event when it is first detected. The annotation of a Cluster is only
+// logged when the manager doesn't allow disabling verification.
+func (r *HelmReleaseProxyReconciler) reconcileTLSVerification(ctx context.Context, helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy, cluster *clusterv1.Cluster, clientOptions internal.HelmClientOptions) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if !clientOptions.InsecureSkipTLSVerify {
+		if insecureSkipTLSVerifyRequested(cluster) {
+			log.Info("Ignoring the annotation to disable TLS verification of the Cluster API server, the manager doesn't allow it", "cluster", cluster.Name, "annotation", addonsv1alpha2.InsecureSkipTLSVerifyAnnotation)
+		}
+		conditions.MarkTrue(helmReleaseProxy, addonsv1alpha2.ClusterTLSVerifiedCondition)
+		return
+	}
+
+	log.Info("TLS verification of the Cluster API server is disabled", "cluster", cluster.Name, "annotation", addonsv1alpha2.InsecureSkipTLSVerifyAnnotation)
+	if !conditions.IsFalse(helmReleaseProxy, addonsv1alpha2.ClusterTLSVerifiedCondition) {
+		r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeWarning, insecureConnectionEventReason, "TLS verification of the API server of cluster %s is disabled by the %s annotation", cluster.Name, addonsv1alpha2.InsecureSkipTLSVerifyAnnotation)
+	}
+	conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.ClusterTLSVerifiedCondition, addonsv1alpha2.InsecureSkipTLSVerifyReason, clusterv1.ConditionSeverityWarning, "TLS verification of the API server of cluster %s is disabled by the %s annotation", cluster.Name, addonsv1alpha2.InsecureSkipTLSVerifyAnnotation)
+}
+
+// insecureSkipTLSVerifyRequested returns true if a Cluster requests to disable the verification of its API server certificate.
+func insecureSkipTLSVerifyRequested(cluster *clusterv1.Cluster) bool {
+	return cluster.Annotations[addonsv1alpha2.InsecureSkipTLSVerifyAnnotation] == "true"
+}
+
+// getStorage returns the Helm storage of a HelmReleaseProxy and the namespace of its SQL connection Secret. Releases that
+// are already installed keep the driver recorded in the status so that changing the manager default doesn't orphan them.
+func (r *HelmReleaseProxyReconciler) getStorage(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) (addonsv1alpha2.HelmStorage, string) {
+	if helmReleaseProxy.Spec.Storage != nil {
+		return *helmReleaseProxy.Spec.Storage, helmReleaseProxy.Namespace
+	}
+
+	storage := r.DefaultStorage
+	if storage.Driver == "" {
+		storage.Driver = addonsv1alpha2.HelmStorageDriverSecret
+	}
+	if helmReleaseProxy.Status.StorageDriver != "" {
+		storage.Driver = helmReleaseProxy.Status.StorageDriver
+	} else if driver := helmReleaseProxy.Annotations[addonsv1alpha2.StorageDriverAnnotation]; driver != "" {
+		storage.Driver = addonsv1alpha2.HelmStorageDriver(driver)
+	}
+
+	return storage, r.DefaultStorageNamespace
+}
+
+// checkChartSourcePolicies evaluates the ChartSourcePolicies again before installing or upgrading the Helm release. When
+// the Version is empty or a range, it is resolved from the chart repository so version constraints are enforced on the
+// chart version that will actually be installed.
+func (r *HelmReleaseProxyReconciler) checkChartSourcePolicies(ctx context.Context, helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) error {
+	policyList := &addonsv1alpha2.ChartSourcePolicyList{}
+	if err := r.Client.List(ctx, policyList); err != nil {
+		return errors.Wrapf(err, "failed to list ChartSourcePolicies")
+	}
+	if len(policyList.Items) == 0 {
+		return nil
+	}
+
+	chartSource := addonsv1alpha2.ChartSource{
+		Namespace: helmReleaseProxy.Namespace,
+		RepoURL:   helmReleaseProxy.Spec.RepoURL,
+		ChartName: helmReleaseProxy.Spec.ChartName,
+		Version:   helmReleaseProxy.Spec.Version,
+	}
+	if _, err := semver.NewVersion(chartSource.Version); err != nil && addonsv1alpha2.HasVersionConstraints(policyList.Items) {
+		chartRequested, err := internal.LoadChart(ctx, chartSource.RepoURL, chartSource.ChartName, chartSource.Version)
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve version of chart %s", chartSource.ChartName)
+		}
+		chartSource.Version = chartRequested.Metadata.Version
+	}
+
+	return addonsv1alpha2.EvaluateChartSourcePolicies(policyList.Items, chartSource)
+}
+
 // reconcileDelete...
-func (r *HelmReleaseProxyReconciler) reconcileDelete(ctx context.Context, helmReleaseProxy *addonsv1alpha1.HelmReleaseProxy, kubeconfig string) error {
+func (r *HelmReleaseProxyReconciler) reconcileDelete(ctx context.Context, helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy, clientOptions internal.HelmClientOptions) (ctrl.Result, error) {
 	log := ctrl.LoggerFrom(ctx)
 
 	log.V(2).Info("Deleting HelmReleaseProxy on cluster", "HelmReleaseProxy", helmReleaseProxy.Name, "cluster", helmReleaseProxy.Spec.ClusterRef.Name)
 
-	_, err := internal.GetHelmRelease(ctx, kubeconfig, helmReleaseProxy.Spec)
+	existing, err := internal.GetHelmRelease(ctx, clientOptions, helmReleaseProxy.Spec)
 	if err != nil {
 		log.V(2).Error(err, "error getting release from cluster", "cluster", helmReleaseProxy.Spec.ClusterRef.Name)
 
 		if err == helmDriver.ErrReleaseNotFound {
 			log.V(2).Info(fmt.Sprintf("Release '%s' not found on cluster %s, nothing to do for uninstall", helmReleaseProxy.Spec.ReleaseName, helmReleaseProxy.Spec.ClusterRef.Name))
-			conditions.MarkFalse(helmReleaseProxy, addonsv1alpha1.HelmReleaseReadyCondition, addonsv1alpha1.HelmReleaseDeletedReason, clusterv1.ConditionSeverityInfo, "")
+			conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition, addonsv1alpha2.HelmReleaseDeletedReason, clusterv1.ConditionSeverityInfo, "")
 
-			return nil
+			return ctrl.Result{}, nil
 		}
 
-		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha1.HelmReleaseReadyCondition, addonsv1alpha1.HelmReleaseGetFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition, addonsv1alpha2.HelmReleaseGetFailedReason, clusterv1.ConditionSeverityError, err.Error())
 
-		return err
+		return ctrl.Result{}, err
+	}
+
+	removed, err := r.deleteCRDs(ctx, helmReleaseProxy, clientOptions, existing)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !removed {
+		// Don't block a worker while the CRDs and their custom resources are removed.
+		return ctrl.Result{RequeueAfter: crdDeletionRequeueAfter}, nil
 	}
 
 	log.V(2).Info("Preparing to uninstall release on cluster", "releaseName", helmReleaseProxy.Spec.ReleaseName, "clusterName", helmReleaseProxy.Spec.ClusterRef.Name)
 
-	response, err := internal.UninstallHelmRelease(ctx, kubeconfig, helmReleaseProxy.Spec)
+	response, err := internal.UninstallHelmRelease(ctx, clientOptions, helmReleaseProxy.Spec)
 	if err != nil {
 		log.V(2).Info("Error uninstalling chart with Helm:", err)
-		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha1.HelmReleaseReadyCondition, addonsv1alpha1.HelmReleaseDeletionFailedReason, clusterv1.ConditionSeverityError, err.Error())
-		return errors.Wrapf(err, "error uninstalling chart with Helm on cluster %s", helmReleaseProxy.Spec.ClusterRef.Name)
+		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition, addonsv1alpha2.HelmReleaseDeletionFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeWarning, failedEventReason, "Failed to uninstall Helm release on cluster %s: %v", helmReleaseProxy.Spec.ClusterRef.Name, err)
+		return ctrl.Result{}, errors.Wrapf(err, "error uninstalling chart with Helm on cluster %s", helmReleaseProxy.Spec.ClusterRef.Name)
 	}
+	r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeNormal, uninstalledEventReason, "Uninstalled release %s from cluster %s", helmReleaseProxy.Spec.ReleaseName, helmReleaseProxy.Spec.ClusterRef.Name)
 
 	log.V(2).Info((fmt.Sprintf("Chart '%s' successfully uninstalled on cluster %s", helmReleaseProxy.Spec.ChartName, helmReleaseProxy.Spec.ClusterRef.Name)))
-	conditions.MarkFalse(helmReleaseProxy, addonsv1alpha1.HelmReleaseReadyCondition, addonsv1alpha1.HelmReleaseDeletedReason, clusterv1.ConditionSeverityInfo, "")
+	conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition, addonsv1alpha2.HelmReleaseDeletedReason, clusterv1.ConditionSeverityInfo, "")
 	if response != nil && response.Info != "" {
 		log.V(2).Info(fmt.Sprintf("Response is %s", response.Info))
 	}
 
-	return nil
+	return ctrl.Result{}, nil
+}
+
+// truncateMessage shortens a message to at most maxLength bytes, keeping the beginning. The message is cut on a rune
+// boundary so that it stays valid UTF-8.
+func truncateMessage(message string, maxLength int) string {
+	const suffix = "... (truncated)"
+	if len(message) <= maxLength {
+		return message
+	}
+
+	end := maxLength - len(suffix)
+	for end > 0 && !utf8.RuneStart(message[end]) {
+		end--
+	}
+
+	return message[:end] + suffix
+}
+
+// ClusterToHelmReleaseProxiesMapper returns a Request for every HelmReleaseProxy installed on a Cluster.
+func (r *HelmReleaseProxyReconciler) ClusterToHelmReleaseProxiesMapper(o client.Object) []ctrl.Request {
+	ctx := context.TODO()
+	log := ctrl.LoggerFrom(ctx)
+
+	cluster, ok := o.(*clusterv1.Cluster)
+	if !ok {
+		log.Error(errors.Errorf("expected a Cluster but got %T", o), "failed to map object to HelmReleaseProxies")
+		return nil
+	}
+
+	helmReleaseProxies := &addonsv1alpha2.HelmReleaseProxyList{}
+
+	listOpts := []client.ListOption{
+		client.InNamespace(cluster.Namespace),
+		client.MatchingLabels{
+			clusterv1.ClusterLabelName: cluster.Name,
+		},
+	}
+
+	if err := r.Client.List(ctx, helmReleaseProxies, listOpts...); err != nil {
+		log.Error(err, "failed to list HelmReleaseProxies of Cluster", "cluster", cluster.Name)
+		return nil
+	}
+
+	results := []ctrl.Request{}
+	for _, helmReleaseProxy := range helmReleaseProxies.Items {
+		results = append(results, ctrl.Request{
+			NamespacedName: client.ObjectKey{Namespace: helmReleaseProxy.GetNamespace(), Name: helmReleaseProxy.GetName()},
+		})
+	}
+
+	return results
+}
+
+// deleteCRDs deletes the CRDs of the deployed chart before its release is uninstalled, if the HelmReleaseProxy requests it
+// and the manager allows it, and returns true once they are removed. The CRDs are deleted first so that the controllers of
+// the release can still finalize their custom resources.
+func (r *HelmReleaseProxyReconciler) deleteCRDs(ctx context.Context, helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy, clientOptions internal.HelmClientOptions, existing *release.Release) (bool, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if helmReleaseProxy.Spec.CRDs == nil || !helmReleaseProxy.Spec.CRDs.DeleteOnUninstall || existing.Chart == nil {
+		return true, nil
+	}
+	clusterName := helmReleaseProxy.Spec.ClusterRef.Name
+	if !r.AllowCRDDeletion {
+		log.Info("Keeping CRDs of the release because CRD deletion is not allowed on the manager", "release", existing.Name)
+
+		return true, nil
+	}
+
+	removed, err := internal.DeleteChartCRDs(ctx, clientOptions, helmReleaseProxy.Spec, existing.Chart)
+	if err != nil {
+		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition, addonsv1alpha2.HelmReleaseDeletionFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeWarning, failedEventReason, "Failed to delete CRDs of release %s on cluster %s: %v", existing.Name, clusterName, err)
+
+		return false, errors.Wrapf(err, "failed to delete CRDs of release %s on cluster %s", existing.Name, clusterName)
+	}
+	if !removed {
+		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition, addonsv1alpha2.DeletingCRDsReason, clusterv1.ConditionSeverityInfo, "Waiting for the CRDs of release %s to be removed from cluster %s", existing.Name, clusterName)
+
+		return false, nil
+	}
+	r.Recorder.Eventf(helmReleaseProxy, corev1.EventTypeNormal, uninstalledEventReason, "Deleted CRDs of release %s from cluster %s", existing.Name, clusterName)
+
+	return true, nil
 }
 
-func initalizeConditions(ctx context.Context, patchHelper *patch.Helper, helmReleaseProxy *addonsv1alpha1.HelmReleaseProxy) {
+func initalizeConditions(ctx context.Context, patchHelper *patch.Helper, helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) {
 	log := ctrl.LoggerFrom(ctx)
 	if len(helmReleaseProxy.GetConditions()) == 0 {
-		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha1.HelmReleaseReadyCondition, addonsv1alpha1.PreparingToHelmInstallReason, clusterv1.ConditionSeverityInfo, "Preparing to to install Helm chart")
+		conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition, addonsv1alpha2.PreparingToHelmInstallReason, clusterv1.ConditionSeverityInfo, "Preparing to to install Helm chart")
 		if err := patchHelmReleaseProxy(ctx, patchHelper, helmReleaseProxy); err != nil {
 			log.Error(err, "failed to patch HelmReleaseProxy with initial conditions")
 		}
 	}
 }
 
-func patchHelmReleaseProxy(ctx context.Context, patchHelper *patch.Helper, helmReleaseProxy *addonsv1alpha1.HelmReleaseProxy) error {
+func patchHelmReleaseProxy(ctx context.Context, patchHelper *patch.Helper, helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) error {
 	// TODO: Update the readyCondition by summarizing the state of other conditions when they are implemented.
 	conditions.SetSummary(helmReleaseProxy,
 		conditions.WithConditions(
-			addonsv1alpha1.HelmReleaseReadyCondition,
-			addonsv1alpha1.ClusterAvailableCondition,
+			addonsv1alpha2.HelmReleaseReadyCondition,
+			addonsv1alpha2.ClusterAvailableCondition,
+			addonsv1alpha2.ClusterTLSVerifiedCondition,
+			addonsv1alpha2.ReleaseTestsPassedCondition,
 		),
 	)
 
-	// Patch the object, ignoring conflicts on the conditions owned by this controller.
+	// Patch the object, ignoring conflicts on the conditions owned by this controller. The observed generation is only
+	// set once the spec is applied to the Helm release, so it isn't set on every patch.
 	return patchHelper.Patch(
 		ctx,
 		helmReleaseProxy,
 		patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
 			clusterv1.ReadyCondition,
-			addonsv1alpha1.HelmReleaseReadyCondition,
-			addonsv1alpha1.ClusterAvailableCondition,
+			addonsv1alpha2.HelmReleaseReadyCondition,
+			addonsv1alpha2.ClusterAvailableCondition,
+			addonsv1alpha2.ClusterTLSVerifiedCondition,
+			addonsv1alpha2.ReleaseTestsPassedCondition,
+			addonsv1alpha2.PausedCondition,
 		}},
-		patch.WithStatusObservedGeneration{},
 	)
 }
@@ -0,0 +1,576 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helmreleaseproxy
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/release"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonsv1alpha1 "cluster-api-addon-provider-helm/api/v1alpha1"
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
+	"cluster-api-addon-provider-helm/internal"
+)
+
+// newHelmReleaseProxy returns a HelmReleaseProxy of the nginx chart on the Cluster test-cluster.
+func newHelmReleaseProxy(namespace string, annotations map[string]string) *addonsv1alpha2.HelmReleaseProxy {
+	return &addonsv1alpha2.HelmReleaseProxy{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-hrp", Namespace: namespace, Annotations: annotations},
+		Spec: addonsv1alpha2.HelmReleaseProxySpec{
+			ClusterRef:       corev1.ObjectReference{Name: "test-cluster", Namespace: namespace},
+			ChartName:        "nginx",
+			RepoURL:          "https://charts.example.com",
+			ReleaseName:      "nginx",
+			ReleaseNamespace: "default",
+		},
+	}
+}
+
+func newCluster(annotations map[string]string) *clusterv1.Cluster {
+	return &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default", Annotations: annotations},
+	}
+}
+
+// newReconciler returns a HelmReleaseProxyReconciler that uses the API server of the test environment, and its event
+// recorder.
+func newReconciler() (*HelmReleaseProxyReconciler, *record.FakeRecorder) {
+	recorder := record.NewFakeRecorder(10)
+
+	return &HelmReleaseProxyReconciler{
+		Client:   k8sClient,
+		Recorder: recorder,
+	}, recorder
+}
+
+// createNamespace creates a namespace for the objects of a spec, so that specs don't see each other's HelmReleaseProxies.
+func createNamespace() *corev1.Namespace {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "test-"}}
+	Expect(k8sClient.Create(ctx, namespace)).To(Succeed())
+
+	return namespace
+}
+
+// createHelmReleaseProxy creates a HelmReleaseProxy with its status, which the API server ignores on create. Its spec is
+// updated until it reaches the generation.
+func createHelmReleaseProxy(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy, generation int64) {
+	status := helmReleaseProxy.Status.DeepCopy()
+	Expect(k8sClient.Create(ctx, helmReleaseProxy)).To(Succeed())
+	for i := 1; helmReleaseProxy.Generation < generation; i++ {
+		helmReleaseProxy.Spec.Version = fmt.Sprintf("1.0.%d", i)
+		Expect(k8sClient.Update(ctx, helmReleaseProxy)).To(Succeed())
+	}
+	helmReleaseProxy.Status = *status
+	Expect(k8sClient.Status().Update(ctx, helmReleaseProxy)).To(Succeed())
+}
+
+// runAndPatch runs a phase of the reconcile on a HelmReleaseProxy and patches it like Reconcile does. It returns the
+// HelmReleaseProxy as it's stored after the patch.
+func runAndPatch(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy, phase func()) *addonsv1alpha2.HelmReleaseProxy {
+	patchHelper, err := patch.NewHelper(helmReleaseProxy, k8sClient)
+	Expect(err).NotTo(HaveOccurred())
+
+	phase()
+	Expect(patchHelmReleaseProxy(ctx, patchHelper, helmReleaseProxy)).To(Succeed())
+
+	patched := &addonsv1alpha2.HelmReleaseProxy{}
+	Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(helmReleaseProxy), patched)).To(Succeed())
+
+	return patched
+}
+
+var _ = Describe("HelmReleaseProxy observed generation", func() {
+	var namespace *corev1.Namespace
+	var helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy
+
+	BeforeEach(func() {
+		namespace = createNamespace()
+		// The spec changed after revision 1 of the release was installed.
+		helmReleaseProxy = newHelmReleaseProxy(namespace.Name, nil)
+		helmReleaseProxy.Status = addonsv1alpha2.HelmReleaseProxyStatus{Status: "deployed", Revision: 1, ObservedGeneration: 1}
+		createHelmReleaseProxy(helmReleaseProxy, 2)
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, namespace)).To(Succeed())
+	})
+
+	It("is not updated when the upgrade fails", func() {
+		r, _ := newReconciler()
+
+		patched := runAndPatch(helmReleaseProxy, func() {
+			// The kubeconfig is invalid, so the upgrade fails.
+			_ = r.reconcileNormal(ctx, nil, helmReleaseProxy, internal.HelmClientOptions{Kubeconfig: "invalid"})
+			Expect(conditions.IsFalse(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition)).To(BeTrue())
+		})
+
+		// Unless the release failed with an error, the HelmChartProxy controller counts it as upgrading until its
+		// generation is observed.
+		Expect(patched.Generation).To(Equal(int64(2)))
+		Expect(patched.Status.ObservedGeneration).To(Equal(int64(1)))
+	})
+
+	It("is updated when the upgrade succeeds", func() {
+		patched := runAndPatch(helmReleaseProxy, func() {
+			// The release can't be upgraded without a workload Cluster, so set the status like reconcileNormal does after
+			// a successful upgrade.
+			helmReleaseProxy.SetReleaseRevision(2)
+			helmReleaseProxy.Status.ObservedGeneration = helmReleaseProxy.Generation
+			conditions.MarkTrue(helmReleaseProxy, addonsv1alpha2.HelmReleaseReadyCondition)
+		})
+
+		Expect(patched.Generation).To(Equal(int64(2)))
+		Expect(patched.Status.ObservedGeneration).To(Equal(int64(2)))
+	})
+})
+
+var _ = Describe("clusterChanged", func() {
+	var oldCluster, updatedCluster *clusterv1.Cluster
+
+	BeforeEach(func() {
+		oldCluster = newInitializingCluster()
+		updatedCluster = newInitializingCluster()
+	})
+
+	DescribeTable("filters the Cluster updates that don't affect HelmReleaseProxies",
+		func(update func(cluster *clusterv1.Cluster), want bool) {
+			update(updatedCluster)
+
+			Expect(clusterChanged(oldCluster, updatedCluster)).To(Equal(want))
+		},
+		Entry("no change", func(cluster *clusterv1.Cluster) {}, false),
+		Entry("condition message and transition time change", func(cluster *clusterv1.Cluster) {
+			cluster.Status.Conditions[0].Message = "still waiting"
+			cluster.Status.Conditions[0].LastTransitionTime = metav1.Now()
+		}, false),
+		Entry("unrelated annotation and status change", func(cluster *clusterv1.Cluster) {
+			cluster.Annotations["unrelated"] = "b"
+			cluster.Status.ObservedGeneration = 5
+		}, false),
+		Entry("control plane becomes initialized", func(cluster *clusterv1.Cluster) {
+			cluster.Status.Conditions[0].Status = corev1.ConditionTrue
+		}, true),
+		Entry("condition added", func(cluster *clusterv1.Cluster) {
+			cluster.Status.Conditions = append(cluster.Status.Conditions, clusterv1.Condition{Type: clusterv1.ReadyCondition, Status: corev1.ConditionTrue})
+		}, true),
+		Entry("cluster paused", func(cluster *clusterv1.Cluster) {
+			cluster.Spec.Paused = true
+		}, true),
+		Entry("paused annotation added", func(cluster *clusterv1.Cluster) {
+			cluster.Annotations[clusterv1.PausedAnnotation] = ""
+		}, true),
+		Entry("value override annotation changed", func(cluster *clusterv1.Cluster) {
+			cluster.Annotations[addonsv1alpha2.ValueOverridesAnnotationPrefix+"nginx-ingress"] = "replicaCount: 3"
+		}, true),
+		Entry("insecure skip TLS verify annotation added", func(cluster *clusterv1.Cluster) {
+			cluster.Annotations[addonsv1alpha2.InsecureSkipTLSVerifyAnnotation] = "true"
+		}, true),
+	)
+})
+
+// newInitializingCluster returns a Cluster whose control plane is not initialized yet.
+func newInitializingCluster() *clusterv1.Cluster {
+	cluster := newCluster(map[string]string{"unrelated": "a"})
+	cluster.Status.Conditions = clusterv1.Conditions{
+		{Type: clusterv1.ControlPlaneInitializedCondition, Status: corev1.ConditionFalse, Reason: "WaitingForControlPlane"},
+	}
+
+	return cluster
+}
+
+var _ = Describe("HelmReleaseProxy impersonation", func() {
+	var namespace *corev1.Namespace
+	var allowlist addonsv1alpha2.ImpersonationAllowlist
+
+	BeforeEach(func() {
+		namespace = createNamespace()
+		var err error
+		allowlist, err = addonsv1alpha2.ParseImpersonationAllowlist(namespace.Name + "=system:serviceaccount:monitoring:prometheus-installer," + namespace.Name + "=helm-operator," + namespace.Name + "=group:platform-team")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, namespace)).To(Succeed())
+	})
+
+	type impersonationCase struct {
+		defaultServiceAccountName string
+		requireImpersonation      bool
+		serviceAccountName        string
+		impersonate               *addonsv1alpha2.ImpersonationConfig
+		want                      rest.ImpersonationConfig
+		wantNotAllowed            bool
+	}
+
+	DescribeTable("impersonates the identity allowed for the HelmReleaseProxy",
+		func(tc impersonationCase) {
+			helmReleaseProxy := newHelmReleaseProxy(namespace.Name, nil)
+			helmReleaseProxy.Spec.ReleaseNamespace = "monitoring"
+			helmReleaseProxy.Spec.ServiceAccountName = tc.serviceAccountName
+			helmReleaseProxy.Spec.Impersonate = tc.impersonate
+			createHelmReleaseProxy(helmReleaseProxy, 1)
+			r, recorder := newReconciler()
+			r.DefaultServiceAccountName = tc.defaultServiceAccountName
+			r.RequireImpersonation = tc.requireImpersonation
+			r.ImpersonationAllowlist = allowlist
+
+			got, err := r.impersonation(helmReleaseProxy)
+			if !tc.wantNotAllowed {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(got).To(Equal(tc.want))
+				return
+			}
+
+			Expect(err).To(HaveOccurred())
+			// The error is terminal: it is reported on the HelmReleaseProxy instead of being retried.
+			patched := runAndPatch(helmReleaseProxy, func() {
+				Expect(r.reportHelmClientOptionsError(helmReleaseProxy, err)).To(Succeed())
+			})
+			Expect(conditions.GetReason(patched, addonsv1alpha2.HelmReleaseReadyCondition)).To(Equal(addonsv1alpha2.ImpersonationNotAllowedReason))
+			Expect(recorder.Events).To(HaveLen(1))
+		},
+		Entry("kubeconfig credentials", impersonationCase{
+			want: rest.ImpersonationConfig{},
+		}),
+		Entry("kubeconfig credentials when impersonation is required", impersonationCase{
+			requireImpersonation: true,
+			wantNotAllowed:       true,
+		}),
+		Entry("default service account", impersonationCase{
+			defaultServiceAccountName: "helm",
+			requireImpersonation:      true,
+			want:                      rest.ImpersonationConfig{UserName: "system:serviceaccount:monitoring:helm"},
+		}),
+		Entry("allowed service account overrides the default", impersonationCase{
+			defaultServiceAccountName: "helm",
+			serviceAccountName:        "prometheus-installer",
+			want:                      rest.ImpersonationConfig{UserName: "system:serviceaccount:monitoring:prometheus-installer"},
+		}),
+		Entry("allowed user overrides the default", impersonationCase{
+			defaultServiceAccountName: "helm",
+			requireImpersonation:      true,
+			impersonate:               &addonsv1alpha2.ImpersonationConfig{User: "helm-operator", Groups: []string{"platform-team"}},
+			want:                      rest.ImpersonationConfig{UserName: "helm-operator", Groups: []string{"platform-team"}},
+		}),
+		Entry("service account that is not allowed", impersonationCase{
+			serviceAccountName: "cluster-admin",
+			wantNotAllowed:     true,
+		}),
+		Entry("group that is not allowed", impersonationCase{
+			impersonate:    &addonsv1alpha2.ImpersonationConfig{User: "helm-operator", Groups: []string{"system:masters"}},
+			wantNotAllowed: true,
+		}),
+		Entry("user that is not allowed with a default service account", impersonationCase{
+			defaultServiceAccountName: "helm",
+			impersonate:               &addonsv1alpha2.ImpersonationConfig{User: "system:admin"},
+			wantNotAllowed:            true,
+		}),
+		Entry("required impersonation falls back to the default service account", impersonationCase{
+			defaultServiceAccountName: "helm",
+			requireImpersonation:      true,
+			impersonate:               &addonsv1alpha2.ImpersonationConfig{User: "system:serviceaccount:kube-system:helm"},
+			want:                      rest.ImpersonationConfig{UserName: "system:serviceaccount:monitoring:helm"},
+		}),
+	)
+})
+
+var _ = Describe("HelmReleaseProxy TLS verification", func() {
+	var namespace *corev1.Namespace
+
+	BeforeEach(func() {
+		namespace = createNamespace()
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, namespace)).To(Succeed())
+	})
+
+	DescribeTable("reports whether Helm verifies the API server certificate of the Cluster",
+		func(annotations map[string]string, allowInsecure bool, wasInsecure bool, wantVerified bool, wantEvent bool) {
+			cluster := newCluster(annotations)
+			helmReleaseProxy := newHelmReleaseProxy(namespace.Name, nil)
+			if wasInsecure {
+				conditions.MarkFalse(helmReleaseProxy, addonsv1alpha2.ClusterTLSVerifiedCondition, addonsv1alpha2.InsecureSkipTLSVerifyReason, clusterv1.ConditionSeverityWarning, "")
+			}
+			createHelmReleaseProxy(helmReleaseProxy, 1)
+			r, recorder := newReconciler()
+			r.AllowInsecureSkipTLSVerify = allowInsecure
+
+			patched := runAndPatch(helmReleaseProxy, func() {
+				clientOptions, err := r.helmClientOptions(ctx, helmReleaseProxy, cluster, "kubeconfig")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(clientOptions.InsecureSkipTLSVerify).To(Equal(!wantVerified))
+				r.reconcileTLSVerification(ctx, helmReleaseProxy, cluster, clientOptions)
+			})
+
+			if wantVerified {
+				Expect(conditions.IsTrue(patched, addonsv1alpha2.ClusterTLSVerifiedCondition)).To(BeTrue())
+			} else {
+				Expect(conditions.GetReason(patched, addonsv1alpha2.ClusterTLSVerifiedCondition)).To(Equal(addonsv1alpha2.InsecureSkipTLSVerifyReason))
+				// The warning is summarized in the Ready condition.
+				Expect(conditions.GetReason(patched, clusterv1.ReadyCondition)).To(Equal(addonsv1alpha2.InsecureSkipTLSVerifyReason))
+			}
+
+			if wantEvent {
+				Expect(recorder.Events).To(Receive(ContainSubstring(insecureConnectionEventReason)))
+			}
+			Expect(recorder.Events).To(BeEmpty())
+		},
+		Entry("annotation not set",
+			nil, false, false, true, false),
+		Entry("annotation set to true",
+			map[string]string{addonsv1alpha2.InsecureSkipTLSVerifyAnnotation: "true"}, true, false, false, true),
+		Entry("annotation set to true again",
+			map[string]string{addonsv1alpha2.InsecureSkipTLSVerifyAnnotation: "true"}, true, true, false, false),
+		Entry("annotation set to true but not allowed",
+			map[string]string{addonsv1alpha2.InsecureSkipTLSVerifyAnnotation: "true"}, false, false, true, false),
+		Entry("annotation set to true but no longer allowed",
+			map[string]string{addonsv1alpha2.InsecureSkipTLSVerifyAnnotation: "true"}, false, true, true, false),
+		Entry("annotation set to false",
+			map[string]string{addonsv1alpha2.InsecureSkipTLSVerifyAnnotation: "false"}, true, false, true, false),
+		Entry("annotation set to another value",
+			map[string]string{addonsv1alpha2.InsecureSkipTLSVerifyAnnotation: "yes"}, true, false, true, false),
+		Entry("annotation removed",
+			nil, true, true, true, false),
+	)
+})
+
+var _ = Describe("HelmReleaseProxy release tests", func() {
+	var namespace *corev1.Namespace
+	var helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy
+
+	testHook := func(name string, phase release.HookPhase) *release.Hook {
+		return &release.Hook{Name: name, Events: []release.HookEvent{release.HookTest}, LastRun: release.HookExecution{Phase: phase}}
+	}
+	installHook := &release.Hook{Name: "migrate", Events: []release.HookEvent{release.HookPreInstall}, LastRun: release.HookExecution{Phase: release.HookPhaseSucceeded}}
+
+	BeforeEach(func() {
+		namespace = createNamespace()
+		helmReleaseProxy = newHelmReleaseProxy(namespace.Name, nil)
+		helmReleaseProxy.Spec.Tests = &addonsv1alpha2.ReleaseTests{Enabled: true}
+		createHelmReleaseProxy(helmReleaseProxy, 1)
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, namespace)).To(Succeed())
+	})
+
+	// reportReleaseTests reports the results of the tests of revision 2 of the release, and returns the HelmReleaseProxy
+	// as it's stored afterwards.
+	reportReleaseTests := func(tested *release.Release, testErr error, wantFailed bool, wantErr bool) (*addonsv1alpha2.HelmReleaseProxy, *record.FakeRecorder) {
+		r, recorder := newReconciler()
+		rel := &release.Release{Name: "nginx", Version: 2}
+
+		patched := runAndPatch(helmReleaseProxy, func() {
+			failed, err := r.reportReleaseTests(helmReleaseProxy, rel, tested, testErr)
+			Expect(failed).To(Equal(wantFailed))
+			if wantErr {
+				Expect(err).To(HaveOccurred())
+			} else {
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		return patched, recorder
+	}
+
+	It("reports the tests that passed", func() {
+		tested := &release.Release{Hooks: []*release.Hook{installHook, testHook("test-connection", release.HookPhaseSucceeded)}}
+
+		patched, recorder := reportReleaseTests(tested, nil, false, false)
+		Expect(conditions.IsTrue(patched, addonsv1alpha2.ReleaseTestsPassedCondition)).To(BeTrue())
+		Expect(patched.Status.Tests).NotTo(BeNil())
+		Expect(patched.Status.Tests.Revision).To(Equal(2))
+		Expect(patched.Status.Tests.Results).To(Equal([]addonsv1alpha2.ReleaseTestResult{{Name: "test-connection", Phase: "Succeeded"}}))
+		Expect(recorder.Events).To(Receive(ContainSubstring(testsPassedEventReason)))
+	})
+
+	It("reports a test that failed", func() {
+		tested := &release.Release{Hooks: []*release.Hook{testHook("test-connection", release.HookPhaseSucceeded), testHook("test-auth", release.HookPhaseFailed)}}
+
+		patched, recorder := reportReleaseTests(tested, errors.New("pod test-auth failed"), true, false)
+		Expect(conditions.GetReason(patched, addonsv1alpha2.ReleaseTestsPassedCondition)).To(Equal(addonsv1alpha2.ReleaseTestsFailedReason))
+		Expect(patched.Status.Tests).NotTo(BeNil())
+		Expect(patched.Status.Tests.Revision).To(Equal(2))
+		Expect(patched.Status.Tests.Results).To(Equal([]addonsv1alpha2.ReleaseTestResult{
+			{Name: "test-connection", Phase: "Succeeded"},
+			{Name: "test-auth", Phase: "Failed"},
+		}))
+		Expect(recorder.Events).To(Receive(ContainSubstring(testsFailedEventReason)))
+	})
+
+	It("reports a test that timed out before it ran as unknown", func() {
+		tested := &release.Release{Hooks: []*release.Hook{testHook("test-connection", "")}}
+
+		patched, recorder := reportReleaseTests(tested, errors.New("timed out waiting for the condition"), true, false)
+		Expect(conditions.GetReason(patched, addonsv1alpha2.ReleaseTestsPassedCondition)).To(Equal(addonsv1alpha2.ReleaseTestsFailedReason))
+		Expect(patched.Status.Tests).NotTo(BeNil())
+		Expect(patched.Status.Tests.Results).To(Equal([]addonsv1alpha2.ReleaseTestResult{{Name: "test-connection", Phase: "Unknown"}}))
+		Expect(recorder.Events).To(Receive(ContainSubstring(testsFailedEventReason)))
+	})
+
+	It("returns an error when the tests could not be run", func() {
+		patched, recorder := reportReleaseTests(nil, errors.New("release: not found"), false, true)
+		Expect(conditions.GetReason(patched, addonsv1alpha2.ReleaseTestsPassedCondition)).To(Equal(addonsv1alpha2.ReleaseTestsRunFailedReason))
+		Expect(patched.Status.Tests).To(BeNil())
+		Expect(recorder.Events).To(BeEmpty())
+	})
+})
+
+var _ = Describe("HelmReleaseProxy pause", func() {
+	var namespace *corev1.Namespace
+
+	BeforeEach(func() {
+		namespace = createNamespace()
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, namespace)).To(Succeed())
+	})
+
+	DescribeTable("reports whether the HelmReleaseProxy is paused",
+		func(clusterPaused bool, annotations map[string]string, wasPaused bool, wantReason string) {
+			cluster := newCluster(nil)
+			cluster.Spec.Paused = clusterPaused
+			helmReleaseProxy := newHelmReleaseProxy(namespace.Name, annotations)
+			if wasPaused {
+				conditions.MarkTrue(helmReleaseProxy, addonsv1alpha2.PausedCondition)
+			}
+			createHelmReleaseProxy(helmReleaseProxy, 1)
+			r, _ := newReconciler()
+
+			patched := runAndPatch(helmReleaseProxy, func() {
+				Expect(r.reconcilePaused(ctx, helmReleaseProxy, cluster)).To(Equal(wantReason != ""))
+			})
+
+			condition := conditions.Get(patched, addonsv1alpha2.PausedCondition)
+			if wantReason == "" {
+				Expect(condition).To(BeNil())
+				return
+			}
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+			Expect(condition.Reason).To(Equal(wantReason))
+		},
+		Entry("not paused",
+			false, nil, false, ""),
+		Entry("Cluster paused",
+			true, nil, false, addonsv1alpha2.ClusterPausedReason),
+		Entry("paused annotation",
+			false, map[string]string{clusterv1.PausedAnnotation: ""}, false, addonsv1alpha2.PausedAnnotationReason),
+		Entry("Cluster paused and paused annotation",
+			true, map[string]string{clusterv1.PausedAnnotation: ""}, false, addonsv1alpha2.ClusterPausedReason),
+		Entry("unpaused",
+			false, nil, true, ""),
+	)
+})
+
+var _ = Describe("pendingReconcileRequest", func() {
+	for _, annotation := range addonsv1alpha2.ReconcileRequestAnnotations {
+		annotation := annotation
+
+		It(fmt.Sprintf("runs a %s request once after a round trip through v1alpha1", annotation), func() {
+			helmReleaseProxy := newHelmReleaseProxy("default", map[string]string{annotation: "2022-06-01T00:00:00Z"})
+			value, pending := pendingReconcileRequest(helmReleaseProxy, annotation)
+			Expect(value).To(Equal("2022-06-01T00:00:00Z"))
+			Expect(pending).To(BeTrue())
+
+			// The action runs and the request is recorded as handled.
+			helmReleaseProxy.Status.SetLastHandled(annotation, value)
+
+			// A client that still uses v1alpha1 reads and writes the HelmReleaseProxy.
+			spoke := &addonsv1alpha1.HelmReleaseProxy{}
+			Expect(spoke.ConvertFrom(helmReleaseProxy.DeepCopy())).To(Succeed())
+			helmReleaseProxy = &addonsv1alpha2.HelmReleaseProxy{}
+			Expect(spoke.ConvertTo(helmReleaseProxy)).To(Succeed())
+
+			_, pending = pendingReconcileRequest(helmReleaseProxy, annotation)
+			Expect(pending).To(BeFalse())
+
+			// A new request runs the action again.
+			helmReleaseProxy.Annotations[annotation] = "2022-06-02T00:00:00Z"
+			_, pending = pendingReconcileRequest(helmReleaseProxy, annotation)
+			Expect(pending).To(BeTrue())
+		})
+	}
+
+	for annotation := range lastHandledAnnotations {
+		annotation := annotation
+
+		It(fmt.Sprintf("runs a %s request once after clusterctl move", annotation), func() {
+			helmReleaseProxy := newHelmReleaseProxy("default", map[string]string{annotation: "2022-06-01T00:00:00Z"})
+			value, pending := pendingReconcileRequest(helmReleaseProxy, annotation)
+			Expect(pending).To(BeTrue())
+
+			// The action runs and the request is recorded as handled.
+			setLastHandledReconcileRequest(helmReleaseProxy, annotation, value)
+
+			// clusterctl move creates the HelmReleaseProxy on the target management cluster with its metadata and spec,
+			// but without its status.
+			moved := &addonsv1alpha2.HelmReleaseProxy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        helmReleaseProxy.Name,
+					Namespace:   helmReleaseProxy.Namespace,
+					Annotations: helmReleaseProxy.Annotations,
+				},
+				Spec: helmReleaseProxy.Spec,
+			}
+
+			_, pending = pendingReconcileRequest(moved, annotation)
+			Expect(pending).To(BeFalse())
+
+			// A new request runs the action again.
+			moved.Annotations[annotation] = "2022-06-02T00:00:00Z"
+			_, pending = pendingReconcileRequest(moved, annotation)
+			Expect(pending).To(BeTrue())
+		})
+	}
+})
+
+var _ = Describe("truncateMessage", func() {
+	DescribeTable("truncates a message on a rune boundary",
+		func(message string, maxLength int, want string) {
+			got := truncateMessage(message, maxLength)
+			Expect(got).To(Equal(want))
+			Expect(len(got)).To(BeNumerically("<=", maxLength))
+			Expect(utf8.ValidString(got)).To(BeTrue())
+		},
+		Entry("short message",
+			"hook failed", 20, "hook failed"),
+		Entry("message of max length",
+			"hook failed", 11, "hook failed"),
+		Entry("long message",
+			"hook job/migrate failed: BackoffLimitExceeded", 30, "hook job/migrat... (truncated)"),
+		Entry("cut inside a multi-byte rune",
+			"hook failed: ✗✗✗✗✗✗✗✗✗✗", 29, "hook failed: ... (truncated)"),
+		Entry("cut after a multi-byte rune",
+			"✗✗✗✗✗✗✗✗✗✗✗✗", 21, "✗✗... (truncated)"),
+	)
+})
@@ -30,6 +30,7 @@ import (
 	"sigs.k8s.io/cluster-api/cmd/clusterctl/client"
 	"sigs.k8s.io/cluster-api/cmd/clusterctl/client/cluster"
 	"sigs.k8s.io/cluster-api/controllers/external"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	ctrl "sigs.k8s.io/controller-runtime"
 	ctrlClient "sigs.k8s.io/controller-runtime/pkg/client"
 	configclient "sigs.k8s.io/controller-runtime/pkg/client/config"
@@ -203,6 +204,18 @@ func WriteClusterKubeconfigToFile(ctx context.Context, cluster *clusterv1.Cluste
 	return filePath, nil
 }
 
+// GetUnmetClusterConditions returns the condition types from conditionTypes that are not true on the Cluster.
+func GetUnmetClusterConditions(cluster *clusterv1.Cluster, conditionTypes []clusterv1.ConditionType) []string {
+	unmet := []string{}
+	for _, conditionType := range conditionTypes {
+		if !conditions.IsTrue(cluster, conditionType) {
+			unmet = append(unmet, string(conditionType))
+		}
+	}
+
+	return unmet
+}
+
 func GetCustomResource(ctx context.Context, c ctrlClient.Client, kind string, apiVersion string, namespace string, name string) (*unstructured.Unstructured, error) {
 	objectRef := corev1.ObjectReference{
 		Kind:       kind,
@@ -0,0 +1,213 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	helmAction "helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
+)
+
+const (
+	// crdFieldManager is the field manager used to server-side apply the CRDs of a chart.
+	crdFieldManager = "cluster-api-addon-provider-helm"
+
+	// crdEstablishedTimeout is the time to wait for applied CRDs to be established before the release is installed or upgraded.
+	crdEstablishedTimeout = time.Minute
+)
+
+// getCRDPolicy returns the CRD policy of a HelmReleaseProxy, defaulting to Create as Helm does.
+func getCRDPolicy(spec addonsv1alpha2.HelmReleaseProxySpec) addonsv1alpha2.CRDPolicy {
+	if spec.CRDs == nil || spec.CRDs.Policy == "" {
+		return addonsv1alpha2.CRDPolicyCreate
+	}
+
+	return spec.CRDs.Policy
+}
+
+// chartCRDs decodes the CRDs in the crds/ directory of a chart and its dependencies.
+func chartCRDs(chartRequested *chart.Chart) ([]*unstructured.Unstructured, error) {
+	var crds []*unstructured.Unstructured
+	for _, crdObject := range chartRequested.CRDObjects() {
+		decoder := k8syaml.NewYAMLOrJSONDecoder(bytes.NewReader(crdObject.File.Data), 4096)
+		for {
+			obj := &unstructured.Unstructured{}
+			if err := decoder.Decode(&obj.Object); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+
+				return nil, errors.Wrapf(err, "failed to decode CRDs in %s", crdObject.Filename)
+			}
+			if len(obj.Object) == 0 {
+				continue
+			}
+			if obj.GroupVersionKind().GroupKind() != (schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}) {
+				return nil, errors.Errorf("%s in %s is a %s, not a CustomResourceDefinition", obj.GetName(), crdObject.Filename, obj.GroupVersionKind())
+			}
+			crds = append(crds, obj)
+		}
+	}
+
+	return crds, nil
+}
+
+func crdResource(crd *unstructured.Unstructured) schema.GroupVersionResource {
+	return crd.GroupVersionKind().GroupVersion().WithResource("customresourcedefinitions")
+}
+
+func getDynamicClient(actionConfig *helmAction.Configuration) (dynamic.Interface, error) {
+	restConfig, err := actionConfig.RESTClientGetter.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return dynamic.NewForConfig(restConfig)
+}
+
+// applyChartCRDs server-side applies the CRDs of a chart to the Cluster, replacing the fields owned by previous applies,
+// and waits for them to be established.
+func applyChartCRDs(ctx context.Context, actionConfig *helmAction.Configuration, chartRequested *chart.Chart) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	crds, err := chartCRDs(chartRequested)
+	if err != nil {
+		return err
+	}
+	if len(crds) == 0 {
+		return nil
+	}
+
+	dynamicClient, err := getDynamicClient(actionConfig)
+	if err != nil {
+		return errors.Wrap(err, "failed to create client to apply CRDs")
+	}
+
+	force := true
+	for _, crd := range crds {
+		data, err := json.Marshal(crd.Object)
+		if err != nil {
+			return errors.Wrapf(err, "failed to encode CRD %s", crd.GetName())
+		}
+		log.V(2).Info("Applying CRD", "crd", crd.GetName())
+		if _, err := dynamicClient.Resource(crdResource(crd)).Patch(ctx, crd.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: crdFieldManager, Force: &force}); err != nil {
+			return errors.Wrapf(err, "failed to apply CRD %s", crd.GetName())
+		}
+	}
+
+	for _, crd := range crds {
+		if err := wait.PollImmediate(time.Second, crdEstablishedTimeout, func() (bool, error) {
+			existing, err := dynamicClient.Resource(crdResource(crd)).Get(ctx, crd.GetName(), metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+
+			return isCRDEstablished(existing), nil
+		}); err != nil {
+			return errors.Wrapf(err, "CRD %s was not established", crd.GetName())
+		}
+	}
+
+	// Refresh the discovery cache so that the release can use the kinds of new CRDs.
+	discoveryClient, err := actionConfig.RESTClientGetter.ToDiscoveryClient()
+	if err != nil {
+		return err
+	}
+	discoveryClient.Invalidate()
+
+	return nil
+}
+
+func isCRDEstablished(crd *unstructured.Unstructured) bool {
+	crdConditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, c := range crdConditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == "Established" && condition["status"] == "True" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DeleteChartCRDs deletes the CRDs of a chart from the Cluster, which also deletes all of their custom resources. It
+// doesn't wait for them to be removed, and returns true once all of them are gone.
+func DeleteChartCRDs(ctx context.Context, clientOptions HelmClientOptions, spec addonsv1alpha2.HelmReleaseProxySpec, chartDeployed *chart.Chart) (bool, error) {
+	crds, err := chartCRDs(chartDeployed)
+	if err != nil {
+		return false, err
+	}
+	if len(crds) == 0 {
+		return true, nil
+	}
+
+	_, actionConfig, err := HelmInit(ctx, spec.ReleaseNamespace, clientOptions)
+	if err != nil {
+		return false, err
+	}
+	dynamicClient, err := getDynamicClient(actionConfig)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to create client to delete CRDs")
+	}
+
+	return deleteCRDs(ctx, dynamicClient, crds)
+}
+
+// deleteCRDs deletes the CRDs that still exist and aren't being deleted yet, and returns true if none of them exist.
+func deleteCRDs(ctx context.Context, dynamicClient dynamic.Interface, crds []*unstructured.Unstructured) (bool, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	removed := true
+	for _, crd := range crds {
+		existing, err := dynamicClient.Resource(crdResource(crd)).Get(ctx, crd.GetName(), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to get CRD %s", crd.GetName())
+		}
+		removed = false
+		if existing.GetDeletionTimestamp() != nil {
+			log.V(2).Info("Waiting for CRD to be removed", "crd", crd.GetName())
+			continue
+		}
+
+		log.V(2).Info("Deleting CRD", "crd", crd.GetName())
+		if err := dynamicClient.Resource(crdResource(crd)).Delete(ctx, crd.GetName(), metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return false, errors.Wrapf(err, "failed to delete CRD %s", crd.GetName())
+		}
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestDeleteCRDs(t *testing.T) {
+	newCRD := func(name string, terminating bool) *unstructured.Unstructured {
+		crd := &unstructured.Unstructured{}
+		crd.SetAPIVersion("apiextensions.k8s.io/v1")
+		crd.SetKind("CustomResourceDefinition")
+		crd.SetName(name)
+		if terminating {
+			now := metav1.Now()
+			crd.SetDeletionTimestamp(&now)
+			crd.SetFinalizers([]string{"customresourcecleanup.apiextensions.k8s.io"})
+		}
+
+		return crd
+	}
+	chartCRDs := []*unstructured.Unstructured{newCRD("certificates.cert-manager.io", false), newCRD("issuers.cert-manager.io", false)}
+
+	tests := []struct {
+		name        string
+		existing    []runtime.Object
+		wantRemoved bool
+		wantDeleted []string
+	}{
+		{
+			name:        "CRDs already removed",
+			wantRemoved: true,
+		},
+		{
+			name:        "CRDs are deleted without waiting",
+			existing:    []runtime.Object{newCRD("certificates.cert-manager.io", false), newCRD("issuers.cert-manager.io", false)},
+			wantRemoved: false,
+			wantDeleted: []string{"certificates.cert-manager.io", "issuers.cert-manager.io"},
+		},
+		{
+			name:        "terminating CRDs aren't deleted again",
+			existing:    []runtime.Object{newCRD("certificates.cert-manager.io", true), newCRD("issuers.cert-manager.io", false)},
+			wantRemoved: false,
+			wantDeleted: []string{"issuers.cert-manager.io"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), tt.existing...)
+
+			removed, err := deleteCRDs(context.Background(), dynamicClient, chartCRDs)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(removed).To(Equal(tt.wantRemoved))
+
+			var deleted []string
+			for _, action := range dynamicClient.Actions() {
+				if deleteAction, ok := action.(k8stesting.DeleteAction); ok {
+					deleted = append(deleted, deleteAction.GetName())
+				}
+			}
+			g.Expect(deleted).To(Equal(tt.wantDeleted))
+		})
+	}
+}
+
+func TestDeleteCRDsRequeuesUntilRemoved(t *testing.T) {
+	g := NewWithT(t)
+
+	crd := &unstructured.Unstructured{}
+	crd.SetAPIVersion("apiextensions.k8s.io/v1")
+	crd.SetKind("CustomResourceDefinition")
+	crd.SetName("certificates.cert-manager.io")
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), crd.DeepCopy())
+
+	// The first call issues the delete and returns without waiting for the CRD to be removed.
+	removed, err := deleteCRDs(context.Background(), dynamicClient, []*unstructured.Unstructured{crd})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(removed).To(BeFalse())
+
+	// The fake client removes the CRD immediately, so the requeued call finds it gone.
+	removed, err = deleteCRDs(context.Background(), dynamicClient, []*unstructured.Unstructured{crd})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(removed).To(BeTrue())
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/repo"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
+)
+
+// chartFetchError is returned when a chart can't be located or downloaded from its repository.
+type chartFetchError struct {
+	repoURL   string
+	chartName string
+	err       error
+}
+
+func (e *chartFetchError) Error() string {
+	return fmt.Sprintf("failed to fetch chart %s from %s: %v", e.chartName, e.repoURL, e.err)
+}
+
+func (e *chartFetchError) Unwrap() error {
+	return e.err
+}
+
+// HelmErrorClass describes a category of Helm install or upgrade failures.
+type HelmErrorClass struct {
+	// Reason is the reason of the HelmReleaseReady condition for failures of this category.
+	Reason string
+	// Severity is the severity of the HelmReleaseReady condition for failures of this category.
+	Severity clusterv1.ConditionSeverity
+	// Terminal is true if retrying won't help until the HelmReleaseProxy, the chart or the Cluster changes.
+	Terminal bool
+}
+
+var (
+	chartNotFoundClass                 = HelmErrorClass{Reason: addonsv1alpha2.ChartNotFoundReason, Severity: clusterv1.ConditionSeverityError, Terminal: true}
+	repositoryAuthFailedClass          = HelmErrorClass{Reason: addonsv1alpha2.RepositoryAuthFailedReason, Severity: clusterv1.ConditionSeverityError, Terminal: true}
+	chartFetchFailedClass              = HelmErrorClass{Reason: addonsv1alpha2.ChartFetchFailedReason, Severity: clusterv1.ConditionSeverityWarning}
+	valuesInvalidClass                 = HelmErrorClass{Reason: addonsv1alpha2.ValuesInvalidReason, Severity: clusterv1.ConditionSeverityError, Terminal: true}
+	kubernetesVersionIncompatibleClass = HelmErrorClass{Reason: addonsv1alpha2.KubernetesVersionIncompatibleReason, Severity: clusterv1.ConditionSeverityError, Terminal: true}
+	resourceKindNotFoundClass          = HelmErrorClass{Reason: addonsv1alpha2.ResourceKindNotFoundReason, Severity: clusterv1.ConditionSeverityWarning}
+	clusterUnreachableClass            = HelmErrorClass{Reason: addonsv1alpha2.ClusterUnreachableReason, Severity: clusterv1.ConditionSeverityWarning}
+	releasePendingClass                = HelmErrorClass{Reason: addonsv1alpha2.ReleasePendingReason, Severity: clusterv1.ConditionSeverityWarning}
+	hookFailedClass                    = HelmErrorClass{Reason: addonsv1alpha2.HookFailedReason, Severity: clusterv1.ConditionSeverityError}
+	unknownClass                       = HelmErrorClass{Reason: addonsv1alpha2.HelmInstallOrUpgradeFailedReason, Severity: clusterv1.ConditionSeverityError}
+)
+
+// ClassifyHelmError returns the category of an error returned by InstallOrUpgradeHelmRelease. Helm wraps most errors
+// with fmt.Errorf and without %w, so the categories are matched on the error message where there is no typed error.
+func ClassifyHelmError(err error) HelmErrorClass {
+	var fetchErr *chartFetchError
+	var netErr net.Error
+	var noKindMatchErr *meta.NoKindMatchError
+	message := strings.ToLower(err.Error())
+
+	switch {
+	// Hooks are checked first, as the message of a failed hook includes the error of the hook resource.
+	case containsAny(message, "failed pre-install", "failed post-install", "pre-upgrade hooks failed", "post-upgrade hooks failed"):
+		return hookFailedClass
+	case strings.Contains(message, "another operation (install/upgrade/rollback) is in progress"):
+		return releasePendingClass
+	// Errors of the chart repository are checked before the network errors of the Cluster, as they are network errors
+	// too when the repository can't be reached.
+	case errors.As(err, &fetchErr), strings.Contains(message, "is not a valid chart repository or cannot be reached"):
+		return classifyChartFetchError(err, message)
+	case strings.Contains(message, "kubernetes cluster unreachable"),
+		errors.As(err, &netErr),
+		apierrors.IsServerTimeout(err), apierrors.IsTimeout(err), apierrors.IsServiceUnavailable(err),
+		containsAny(message, "connection refused", "no such host", "i/o timeout", "tls handshake timeout", "no route to host"):
+		return clusterUnreachableClass
+	case isChartNotFound(err, message):
+		return chartNotFoundClass
+	case isRepositoryAuthFailed(message):
+		return repositoryAuthFailedClass
+	case strings.Contains(message, "which is incompatible with kubernetes"):
+		return kubernetesVersionIncompatibleClass
+	// A missing kind is often served once the release that installs its CRD is ready, so it is retried.
+	case errors.As(err, &noKindMatchErr), containsAny(message, "no matches for kind", "unable to recognize"):
+		return resourceKindNotFoundClass
+	case containsAny(message, "values don't meet the specifications", "failed to parse values", "execution error at", "error converting yaml to json", "yaml: line"):
+		return valuesInvalidClass
+	default:
+		return unknownClass
+	}
+}
+
+// classifyChartFetchError returns the category of an error fetching a chart from its repository. Errors that don't
+// identify a missing chart or rejected credentials are retried, as the repository may be temporarily unreachable.
+func classifyChartFetchError(err error, message string) HelmErrorClass {
+	switch {
+	case isChartNotFound(err, message):
+		return chartNotFoundClass
+	case isRepositoryAuthFailed(message):
+		return repositoryAuthFailedClass
+	default:
+		return chartFetchFailedClass
+	}
+}
+
+func isChartNotFound(err error, message string) bool {
+	return errors.Is(err, repo.ErrNoChartName) || errors.Is(err, repo.ErrNoChartVersion) ||
+		containsAny(message, "not found in", "no chart version found", "no chart name found", "404 not found", "manifest unknown")
+}
+
+func isRepositoryAuthFailed(message string) bool {
+	return (strings.Contains(message, "failed to fetch") && containsAny(message, "401 unauthorized", "403 forbidden")) ||
+		containsAny(message, "unauthorized: authentication required", "basic credential not found")
+}
+
+// containsAny returns true if s contains any of the substrings.
+func containsAny(s string, substrings ...string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/repo"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
+)
+
+func TestClassifyHelmError(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	fetchErr := func(err error) error {
+		return &chartFetchError{repoURL: "https://charts.example.com", chartName: "nginx", err: err}
+	}
+
+	tests := []struct {
+		name         string
+		err          error
+		wantReason   string
+		wantTerminal bool
+	}{
+		{
+			name:       "failed pre-upgrade hook",
+			err:        errors.New("pre-upgrade hooks failed: job failed: BackoffLimitExceeded"),
+			wantReason: addonsv1alpha2.HookFailedReason,
+		},
+		{
+			name:       "failed pre-install hook with an unreachable service",
+			err:        errors.New(`failed pre-install: warning: Hook pre-install nginx/templates/check.yaml failed: Post "https://nginx-webhook.svc": dial tcp 10.96.0.10:443: connect: connection refused`),
+			wantReason: addonsv1alpha2.HookFailedReason,
+		},
+		{
+			name:       "operation in progress",
+			err:        errors.New("another operation (install/upgrade/rollback) is in progress"),
+			wantReason: addonsv1alpha2.ReleasePendingReason,
+		},
+		{
+			name:       "unreachable repository index",
+			err:        fetchErr(errors.New(`looks like "https://charts.example.com" is not a valid chart repository or cannot be reached: Get "https://charts.example.com/index.yaml": dial tcp: lookup charts.example.com: no such host`)),
+			wantReason: addonsv1alpha2.ChartFetchFailedReason,
+		},
+		{
+			name:       "repository network error",
+			err:        fetchErr(&url.Error{Op: "Get", URL: "https://charts.example.com/nginx-1.0.0.tgz", Err: dialErr}),
+			wantReason: addonsv1alpha2.ChartFetchFailedReason,
+		},
+		{
+			name:       "wrapped repository error",
+			err:        errors.Wrap(fetchErr(errors.New("failed to fetch https://charts.example.com/nginx-1.0.0.tgz : 503 Service Unavailable")), "failed to resolve version of chart nginx"),
+			wantReason: addonsv1alpha2.ChartFetchFailedReason,
+		},
+		{
+			name:       "unreachable repository without a fetch error",
+			err:        errors.New(`looks like "https://charts.example.com" is not a valid chart repository or cannot be reached: Get "https://charts.example.com/index.yaml": i/o timeout`),
+			wantReason: addonsv1alpha2.ChartFetchFailedReason,
+		},
+		{
+			name:         "chart version not found in repository",
+			err:          fetchErr(errors.Errorf(`chart "nginx" version "9.9.9" not found in https://charts.example.com repository`)),
+			wantReason:   addonsv1alpha2.ChartNotFoundReason,
+			wantTerminal: true,
+		},
+		{
+			name:         "no chart version",
+			err:          fetchErr(errors.Wrap(repo.ErrNoChartVersion, "nginx")),
+			wantReason:   addonsv1alpha2.ChartNotFoundReason,
+			wantTerminal: true,
+		},
+		{
+			name:         "repository rejects credentials",
+			err:          fetchErr(errors.New("failed to fetch https://charts.example.com/index.yaml : 401 Unauthorized")),
+			wantReason:   addonsv1alpha2.RepositoryAuthFailedReason,
+			wantTerminal: true,
+		},
+		{
+			name:       "unreachable Cluster",
+			err:        errors.New(`Kubernetes cluster unreachable: Get "https://10.0.0.1:6443/version": dial tcp 10.0.0.1:6443: connect: connection refused`),
+			wantReason: addonsv1alpha2.ClusterUnreachableReason,
+		},
+		{
+			name:       "Cluster network error",
+			err:        errors.Wrap(dialErr, "failed to create resource"),
+			wantReason: addonsv1alpha2.ClusterUnreachableReason,
+		},
+		{
+			name:       "Cluster API server timeout",
+			err:        apierrors.NewServerTimeout(schema.GroupResource{Resource: "deployments"}, "create", 5),
+			wantReason: addonsv1alpha2.ClusterUnreachableReason,
+		},
+		{
+			name:         "unsupported Kubernetes version",
+			err:          errors.New("chart requires kubeVersion: >=1.25.0-0 which is incompatible with Kubernetes v1.23.0"),
+			wantReason:   addonsv1alpha2.KubernetesVersionIncompatibleReason,
+			wantTerminal: true,
+		},
+		{
+			name:       "missing kind",
+			err:        errors.New(`unable to build kubernetes objects from release manifest: unable to recognize "": no matches for kind "ServiceMonitor" in version "monitoring.coreos.com/v1"`),
+			wantReason: addonsv1alpha2.ResourceKindNotFoundReason,
+		},
+		{
+			name:       "typed missing kind",
+			err:        &meta.NoKindMatchError{GroupKind: schema.GroupKind{Group: "monitoring.coreos.com", Kind: "ServiceMonitor"}, SearchedVersions: []string{"v1"}},
+			wantReason: addonsv1alpha2.ResourceKindNotFoundReason,
+		},
+		{
+			name:         "values don't match the schema",
+			err:          errors.New("values don't meet the specifications of the schema(s) in the following chart(s):\nnginx:\n- replicaCount: Invalid type. Expected: integer, given: string"),
+			wantReason:   addonsv1alpha2.ValuesInvalidReason,
+			wantTerminal: true,
+		},
+		{
+			name:         "template error",
+			err:          errors.New(`template: nginx/templates/deployment.yaml:10:4: executing "nginx/templates/deployment.yaml" at <fail "image is required">: error calling fail: execution error at (nginx/templates/deployment.yaml:10:4): image is required`),
+			wantReason:   addonsv1alpha2.ValuesInvalidReason,
+			wantTerminal: true,
+		},
+		{
+			name:       "unknown error",
+			err:        errors.New("something went wrong"),
+			wantReason: addonsv1alpha2.HelmInstallOrUpgradeFailedReason,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			class := ClassifyHelmError(tt.err)
+			g.Expect(class.Reason).To(Equal(tt.wantReason))
+			g.Expect(class.Terminal).To(Equal(tt.wantTerminal))
+		})
+	}
+}
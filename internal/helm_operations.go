@@ -21,29 +21,69 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/mitchellh/copystructure"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 	helmAction "helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
 	helmLoader "helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
 	helmCli "helm.sh/helm/v3/pkg/cli"
 
 	helmVals "helm.sh/helm/v3/pkg/cli/values"
 	helmGetter "helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
 	helmDriver "helm.sh/helm/v3/pkg/storage/driver"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 
-	addonsv1alpha1 "cluster-api-addon-provider-helm/api/v1alpha1"
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
 )
 
-func GetActionConfig(ctx context.Context, namespace string, config *rest.Config) (*helmAction.Configuration, error) {
+// HelmClientOptions configures how Helm connects to a workload Cluster.
+type HelmClientOptions struct {
+	// Kubeconfig is the kubeconfig of the workload Cluster.
+	Kubeconfig string
+
+	// Impersonate is the identity Helm impersonates on the workload Cluster. If the username is empty, Helm uses the
+	// credentials from the kubeconfig.
+	Impersonate rest.ImpersonationConfig
+
+	// StorageDriver is the Helm storage driver for the release. If it is empty, the secret driver is used.
+	StorageDriver addonsv1alpha2.HelmStorageDriver
+
+	// SQLConnectionString is the PostgreSQL connection string used by the sql storage driver.
+	SQLConnectionString string
+
+	// Cluster is the namespace and name of the workload Cluster. The sql storage driver qualifies the namespace of
+	// releases with it, since several Clusters can share a database.
+	Cluster types.NamespacedName
+
+	// InsecureSkipTLSVerify disables verification of the API server certificate of the workload Cluster.
+	InsecureSkipTLSVerify bool
+}
+
+var (
+	// sqlDrivers caches the SQL storage drivers by connection string, since each driver holds a pool of database
+	// connections that is never closed. All Clusters and namespaces that use the same database share the driver.
+	sqlDrivers     = map[string]*helmDriver.SQL{}
+	sqlDriversLock sync.Mutex
+
+	// newSQLDriver connects to the Helm release database and creates the release table if it doesn't exist yet.
+	newSQLDriver = helmDriver.NewSQL
+)
+
+func GetActionConfig(ctx context.Context, namespace string, config *rest.Config, clientOptions HelmClientOptions) (*helmAction.Configuration, error) {
 	log := ctrl.LoggerFrom(ctx)
 	log.V(4).Info("Getting action config")
 	actionConfig := new(helmAction.Configuration)
@@ -58,36 +98,90 @@ func GetActionConfig(ctx context.Context, namespace string, config *rest.Config)
 	// 	Impersonate:      &env.KubeAsUser,
 	// 	ImpersonateGroup: &env.KubeAsGroups,
 	// }
-	insecure := true
 	cliConfig := genericclioptions.NewConfigFlags(false)
 	cliConfig.APIServer = &config.Host
 	cliConfig.BearerToken = &config.BearerToken
 	cliConfig.Namespace = &namespace
-	cliConfig.Insecure = &insecure
-	// Drop their rest.Config and just return inject own
+	// Drop their rest.Config and just return inject own, which verifies the API server with the CA from the kubeconfig.
 	wrapper := func(*rest.Config) *rest.Config {
 		return config
 	}
 	cliConfig.WithWrapConfigFn(wrapper)
-	// cliConfig.Insecure = &insecure
 	// Note: can change this to klog.V(4) or use a debug level
-	if err := actionConfig.Init(cliConfig, namespace, "secret", klog.V(4).Infof); err != nil {
-		return nil, err
+	switch clientOptions.StorageDriver {
+	case "", addonsv1alpha2.HelmStorageDriverSecret, addonsv1alpha2.HelmStorageDriverConfigMap:
+		storageDriver := string(clientOptions.StorageDriver)
+		if storageDriver == "" {
+			storageDriver = string(addonsv1alpha2.HelmStorageDriverSecret)
+		}
+		if err := actionConfig.Init(cliConfig, namespace, storageDriver, klog.V(4).Infof); err != nil {
+			return nil, err
+		}
+	case addonsv1alpha2.HelmStorageDriverSQL:
+		// Helm reads the connection string of the sql driver from the environment, so initialize with the default driver
+		// and replace the release storage.
+		if err := actionConfig.Init(cliConfig, namespace, string(addonsv1alpha2.HelmStorageDriverSecret), klog.V(4).Infof); err != nil {
+			return nil, err
+		}
+		if clientOptions.Cluster.Name == "" {
+			return nil, errors.New("a Cluster is required for the sql storage driver")
+		}
+		sqlDriver, err := getSQLDriver(clientOptions.SQLConnectionString)
+		if err != nil {
+			return nil, err
+		}
+		sqlDriver, err = namespacedSQLDriver(sqlDriver, sqlReleaseNamespace(clientOptions.Cluster, namespace))
+		if err != nil {
+			return nil, err
+		}
+		actionConfig.Releases = storage.Init(newClusterSQLDriver(sqlDriver, clientOptions.Cluster, namespace))
+	default:
+		return nil, errors.Errorf("unknown Helm storage driver %q", clientOptions.StorageDriver)
 	}
+
 	return actionConfig, nil
 }
 
-func HelmInit(ctx context.Context, namespace string, kubeconfig string) (*helmCli.EnvSettings, *helmAction.Configuration, error) {
+// getSQLDriver returns the shared SQL storage driver of a database. It must not be used directly, since Helm's SQL driver
+// reads the releases of a single namespace; use a copy returned by namespacedSQLDriver instead.
+func getSQLDriver(connectionString string) (*helmDriver.SQL, error) {
+	if connectionString == "" {
+		return nil, errors.New("a connection string is required for the sql storage driver")
+	}
+
+	sqlDriversLock.Lock()
+	defer sqlDriversLock.Unlock()
+
+	if sqlDriver, ok := sqlDrivers[connectionString]; ok {
+		return sqlDriver, nil
+	}
+	sqlDriver, err := newSQLDriver(connectionString, klog.V(4).Infof, "")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to the Helm release database")
+	}
+	sqlDrivers[connectionString] = sqlDriver
+
+	return sqlDriver, nil
+}
+
+func HelmInit(ctx context.Context, namespace string, clientOptions HelmClientOptions) (*helmCli.EnvSettings, *helmAction.Configuration, error) {
 	// log := ctrl.LoggerFrom(ctx)
 
 	settings := helmCli.New()
 
-	restConfig, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfig))
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig([]byte(clientOptions.Kubeconfig))
 	if err != nil {
 		return nil, nil, err
 	}
+	restConfig.Impersonate = clientOptions.Impersonate
+	if clientOptions.InsecureSkipTLSVerify {
+		// The CA can't be set together with insecure.
+		restConfig.TLSClientConfig.Insecure = true
+		restConfig.TLSClientConfig.CAData = nil
+		restConfig.TLSClientConfig.CAFile = ""
+	}
 
-	actionConfig, err := GetActionConfig(ctx, namespace, restConfig)
+	actionConfig, err := GetActionConfig(ctx, namespace, restConfig, clientOptions)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -101,8 +195,9 @@ func HelmInit(ctx context.Context, namespace string, kubeconfig string) (*helmCl
 	return settings, actionConfig, nil
 }
 
-// Install Helm release if it doesn't exist. If it exists, check if it needs to be updated.
-func InstallOrUpgradeHelmRelease(ctx context.Context, kubeconfig string, spec addonsv1alpha1.HelmReleaseProxySpec) (*release.Release, bool, error) {
+// Install Helm release if it doesn't exist. If it exists, check if it needs to be updated, or upgrade it regardless if
+// forceUpgrade is set.
+func InstallOrUpgradeHelmRelease(ctx context.Context, clientOptions HelmClientOptions, spec addonsv1alpha2.HelmReleaseProxySpec, postRenderer *PostRenderer, forceUpgrade bool) (*release.Release, bool, error) {
 	log := ctrl.LoggerFrom(ctx)
 
 	log.V(2).Info("Installing or upgrading Helm release")
@@ -110,22 +205,25 @@ func InstallOrUpgradeHelmRelease(ctx context.Context, kubeconfig string, spec ad
 	// historyClient := helmAction.NewHistory(actionConfig)
 	// historyClient.Max = 1
 	// if _, err := historyClient.Run(spec.ReleaseName); err == helmDriver.ErrReleaseNotFound {
-	existingRelease, err := GetHelmRelease(ctx, kubeconfig, spec)
-	if err == helmDriver.ErrReleaseNotFound {
-		release, err := InstallHelmRelease(ctx, kubeconfig, spec)
+	existingRelease, err := getHelmRelease(ctx, clientOptions, spec)
+	if errors.Is(err, helmDriver.ErrReleaseNotFound) {
+		release, err := InstallHelmRelease(ctx, clientOptions, spec, postRenderer)
 		if err != nil {
 			return nil, false, err
 		}
 		return release, true, nil
 	}
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "failed to get Helm release %s", spec.ReleaseName)
+	}
 
-	return UpgradeHelmReleaseIfChanged(ctx, kubeconfig, spec, existingRelease)
+	return UpgradeHelmReleaseIfChanged(ctx, clientOptions, spec, existingRelease, postRenderer, forceUpgrade)
 }
 
-func InstallHelmRelease(ctx context.Context, kubeconfig string, spec addonsv1alpha1.HelmReleaseProxySpec) (*release.Release, error) {
+func InstallHelmRelease(ctx context.Context, clientOptions HelmClientOptions, spec addonsv1alpha2.HelmReleaseProxySpec, postRenderer *PostRenderer) (*release.Release, error) {
 	log := ctrl.LoggerFrom(ctx)
 
-	settings, actionConfig, err := HelmInit(ctx, spec.ReleaseNamespace, kubeconfig)
+	settings, actionConfig, err := HelmInit(ctx, spec.ReleaseNamespace, clientOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -134,6 +232,12 @@ func InstallHelmRelease(ctx context.Context, kubeconfig string, spec addonsv1alp
 	installClient.Version = spec.Version
 	installClient.Namespace = spec.ReleaseNamespace
 	installClient.CreateNamespace = true
+	// Helm only creates CRDs that don't exist yet, so CreateReplace applies them before the install instead.
+	installClient.SkipCRDs = getCRDPolicy(spec) != addonsv1alpha2.CRDPolicyCreate
+	if postRenderer != nil {
+		installClient.PostRenderer = postRenderer
+		actionConfig.KubeClient = newHookPostRenderingKubeClient(actionConfig.KubeClient, postRenderer)
+	}
 
 	if spec.ReleaseName == "" {
 		installClient.GenerateName = true
@@ -145,9 +249,11 @@ func InstallHelmRelease(ctx context.Context, kubeconfig string, spec addonsv1alp
 	installClient.ReleaseName = spec.ReleaseName
 
 	log.V(2).Info("Locating chart...")
+	start := time.Now()
 	cp, err := installClient.ChartPathOptions.LocateChart(spec.ChartName, settings)
+	observeChartDownload(spec.ChartName, start, err)
 	if err != nil {
-		return nil, err
+		return nil, &chartFetchError{repoURL: spec.RepoURL, chartName: spec.ChartName, err: err}
 	}
 	log.V(2).Info("Located chart at path", "path", cp)
 
@@ -178,8 +284,16 @@ func InstallHelmRelease(ctx context.Context, kubeconfig string, spec addonsv1alp
 	if err != nil {
 		return nil, err
 	}
+	if getCRDPolicy(spec) == addonsv1alpha2.CRDPolicyCreateReplace {
+		if err := applyChartCRDs(ctx, actionConfig, chartRequested); err != nil {
+			return nil, err
+		}
+	}
+
 	log.V(2).Info("Installing with Helm...")
+	start = time.Now()
 	release, err := installClient.RunWithContext(ctx, chartRequested, vals)
+	observeHelmOperation(helmOperationInstall, start, err)
 	if err != nil {
 		return nil, err
 	}
@@ -190,10 +304,10 @@ func InstallHelmRelease(ctx context.Context, kubeconfig string, spec addonsv1alp
 }
 
 // This function will be refactored to differentiate from installHelmRelease()
-func UpgradeHelmReleaseIfChanged(ctx context.Context, kubeconfig string, spec addonsv1alpha1.HelmReleaseProxySpec, existing *release.Release) (*release.Release, bool, error) {
+func UpgradeHelmReleaseIfChanged(ctx context.Context, clientOptions HelmClientOptions, spec addonsv1alpha2.HelmReleaseProxySpec, existing *release.Release, postRenderer *PostRenderer, forceUpgrade bool) (*release.Release, bool, error) {
 	log := ctrl.LoggerFrom(ctx)
 
-	settings, actionConfig, err := HelmInit(ctx, spec.ReleaseNamespace, kubeconfig)
+	settings, actionConfig, err := HelmInit(ctx, spec.ReleaseNamespace, clientOptions)
 	if err != nil {
 		return nil, false, err
 	}
@@ -201,10 +315,16 @@ func UpgradeHelmReleaseIfChanged(ctx context.Context, kubeconfig string, spec ad
 	upgradeClient.RepoURL = spec.RepoURL
 	upgradeClient.Version = spec.Version
 	upgradeClient.Namespace = spec.ReleaseNamespace
+	if postRenderer != nil {
+		upgradeClient.PostRenderer = postRenderer
+		actionConfig.KubeClient = newHookPostRenderingKubeClient(actionConfig.KubeClient, postRenderer)
+	}
 	log.V(2).Info("Locating chart...")
+	start := time.Now()
 	cp, err := upgradeClient.ChartPathOptions.LocateChart(spec.ChartName, settings)
+	observeChartDownload(spec.ChartName, start, err)
 	if err != nil {
-		return nil, false, err
+		return nil, false, &chartFetchError{repoURL: spec.RepoURL, chartName: spec.ChartName, err: err}
 	}
 	log.V(2).Info("Located chart at path", "path", cp)
 
@@ -238,18 +358,30 @@ func UpgradeHelmReleaseIfChanged(ctx context.Context, kubeconfig string, spec ad
 		return nil, false, errors.Errorf("failed to load request chart %s", spec.ChartName)
 	}
 
-	shouldUpgrade, err := shouldUpgradeHelmRelease(ctx, *existing, chartRequested, vals)
-	if err != nil {
-		return nil, false, err
+	shouldUpgrade := forceUpgrade
+	if !shouldUpgrade {
+		shouldUpgrade, err = shouldUpgradeHelmRelease(ctx, *existing, chartRequested, vals)
+		if err != nil {
+			return nil, false, err
+		}
 	}
 	if !shouldUpgrade {
 		log.V(2).Info(fmt.Sprintf("Release `%s` is up to date, no upgrade requried, revision = %d", existing.Name, existing.Version))
 		return existing, false, nil
 	}
 
+	if getCRDPolicy(spec) == addonsv1alpha2.CRDPolicyCreateReplace {
+		// Helm never upgrades CRDs, so apply them before the upgrade.
+		if err := applyChartCRDs(ctx, actionConfig, chartRequested); err != nil {
+			return nil, false, err
+		}
+	}
+
 	log.V(2).Info(fmt.Sprintf("Upgrading release `%s` with Helm", spec.ReleaseName))
 	// upgrader.DryRun = true
+	start = time.Now()
 	release, err := upgradeClient.RunWithContext(ctx, spec.ReleaseName, chartRequested, vals)
+	observeHelmOperation(helmOperationUpgrade, start, err)
 	if err != nil {
 		return nil, false, err
 	}
@@ -257,7 +389,7 @@ func UpgradeHelmReleaseIfChanged(ctx context.Context, kubeconfig string, spec ad
 	return release, true, nil
 }
 
-func writeValuesToFile(ctx context.Context, spec addonsv1alpha1.HelmReleaseProxySpec) (string, error) {
+func writeValuesToFile(ctx context.Context, spec addonsv1alpha2.HelmReleaseProxySpec) (string, error) {
 	log := ctrl.LoggerFrom(ctx)
 	log.V(2).Info("Writing values to file")
 	valuesFile, err := ioutil.TempFile("", spec.ChartName+"-"+spec.ReleaseName+"-*.yaml")
@@ -265,13 +397,138 @@ func writeValuesToFile(ctx context.Context, spec addonsv1alpha1.HelmReleaseProxy
 		return "", err
 	}
 
-	if _, err := valuesFile.Write([]byte(spec.Values)); err != nil {
-		return "", err
+	// JSON is valid YAML, so the structured values can be written as is.
+	if spec.Values != nil {
+		if _, err := valuesFile.Write(spec.Values.Raw); err != nil {
+			return "", err
+		}
 	}
 
 	return valuesFile.Name(), nil
 }
 
+// chartCacheTTL is how long LoadChart reuses a loaded chart. The chart of a fixed version doesn't change, but a chart
+// without a version or with a version range resolves to the latest matching version, which is picked up after the TTL.
+const chartCacheTTL = 10 * time.Minute
+
+type cachedChart struct {
+	chart    *chart.Chart
+	loadedAt time.Time
+}
+
+var (
+	// chartCache caches the charts loaded by LoadChart by repository, chart name and version, so that the chart isn't
+	// downloaded on every reconcile.
+	chartCache     = map[string]cachedChart{}
+	chartCacheLock sync.Mutex
+)
+
+// LoadChart locates and loads a chart from its repository without connecting to a workload Cluster. Charts are cached for
+// chartCacheTTL, and an expired chart is still returned if the repository can't be reached. The returned chart is shared
+// between callers and must not be modified.
+func LoadChart(ctx context.Context, repoURL string, chartName string, version string) (*chart.Chart, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	key := repoURL + "/" + chartName + "@" + version
+	chartCacheLock.Lock()
+	cached, ok := chartCache[key]
+	chartCacheLock.Unlock()
+	if ok && time.Since(cached.loadedAt) < chartCacheTTL {
+		return cached.chart, nil
+	}
+
+	chartRequested, err := loadChart(ctx, repoURL, chartName, version)
+	if err != nil {
+		if ok {
+			log.V(2).Info("Failed to load chart, using the chart loaded before", "chart", chartName, "repoURL", repoURL, "loadedAt", cached.loadedAt, "error", err.Error())
+			return cached.chart, nil
+		}
+
+		return nil, err
+	}
+
+	chartCacheLock.Lock()
+	chartCache[key] = cachedChart{chart: chartRequested, loadedAt: time.Now()}
+	chartCacheLock.Unlock()
+
+	return chartRequested, nil
+}
+
+// loadChart downloads and loads a chart from its repository.
+func loadChart(ctx context.Context, repoURL string, chartName string, version string) (*chart.Chart, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	settings := helmCli.New()
+	chartPathOptions := helmAction.ChartPathOptions{
+		RepoURL: repoURL,
+		Version: version,
+	}
+	log.V(2).Info("Locating chart...")
+	start := time.Now()
+	cp, err := chartPathOptions.LocateChart(chartName, settings)
+	observeChartDownload(chartName, start, err)
+	if err != nil {
+		return nil, &chartFetchError{repoURL: repoURL, chartName: chartName, err: err}
+	}
+	log.V(2).Info("Located chart at path", "path", cp)
+
+	chartRequested, err := helmLoader.Load(cp)
+	if err != nil {
+		return nil, err
+	}
+	if chartRequested == nil {
+		return nil, errors.Errorf("failed to load request chart %s", chartName)
+	}
+
+	return chartRequested, nil
+}
+
+// ValidateValuesAgainstSchema validates YAML values against the values.schema.json of the chart and its dependencies. Charts
+// without a schema always pass. The returned error lists the offending value paths for each chart.
+func ValidateValuesAgainstSchema(chartRequested *chart.Chart, values string) error {
+	vals, err := chartutil.ReadValues([]byte(values))
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse values")
+	}
+
+	// Helm validates the values after merging them with the chart defaults, so do the same here to avoid
+	// reporting required fields that the chart already provides. Coalescing copies the maps of the chart values into the
+	// result and then merges globals into them, so coalesce with a copy of the values of the chart, which is shared
+	// between callers.
+	chartCopy, err := copyChartValues(chartRequested)
+	if err != nil {
+		return errors.Wrapf(err, "failed to copy values of chart %s", chartRequested.Name())
+	}
+	coalesced, err := chartutil.CoalesceValues(chartCopy, vals)
+	if err != nil {
+		return errors.Wrapf(err, "failed to merge values with chart defaults")
+	}
+
+	return chartutil.ValidateAgainstSchema(chartCopy, coalesced)
+}
+
+// copyChartValues returns a shallow copy of a chart and its dependencies with a deep copy of their values.
+func copyChartValues(c *chart.Chart) (*chart.Chart, error) {
+	copied := *c
+	values, err := copystructure.Copy(c.Values)
+	if err != nil {
+		return nil, err
+	}
+	copied.Values, _ = values.(map[string]interface{})
+
+	dependencies := make([]*chart.Chart, 0, len(c.Dependencies()))
+	for _, dependency := range c.Dependencies() {
+		copiedDependency, err := copyChartValues(dependency)
+		if err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, copiedDependency)
+	}
+	copied.SetDependencies(dependencies...)
+
+	return &copied, nil
+}
+
 func shouldUpgradeHelmRelease(ctx context.Context, existing release.Release, chartRequested *chart.Chart, values map[string]interface{}) (bool, error) {
 	log := ctrl.LoggerFrom(ctx)
 
@@ -298,12 +555,15 @@ func shouldUpgradeHelmRelease(ctx context.Context, existing release.Release, cha
 	return !cmp.Equal(oldValues, newValues), nil
 }
 
-func GetHelmRelease(ctx context.Context, kubeconfig string, spec addonsv1alpha1.HelmReleaseProxySpec) (*release.Release, error) {
+// getHelmRelease gets the existing release in InstallOrUpgradeHelmRelease. It is a variable so that tests can replace it.
+var getHelmRelease = GetHelmRelease
+
+func GetHelmRelease(ctx context.Context, clientOptions HelmClientOptions, spec addonsv1alpha2.HelmReleaseProxySpec) (*release.Release, error) {
 	if spec.ReleaseName == "" {
 		return nil, helmDriver.ErrReleaseNotFound
 	}
 
-	_, actionConfig, err := HelmInit(ctx, spec.ReleaseNamespace, kubeconfig)
+	_, actionConfig, err := HelmInit(ctx, spec.ReleaseNamespace, clientOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -316,8 +576,8 @@ func GetHelmRelease(ctx context.Context, kubeconfig string, spec addonsv1alpha1.
 	return release, nil
 }
 
-func ListHelmReleases(ctx context.Context, kubeconfig string, spec addonsv1alpha1.HelmReleaseProxySpec) ([]*release.Release, error) {
-	_, actionConfig, err := HelmInit(ctx, spec.ReleaseNamespace, kubeconfig)
+func ListHelmReleases(ctx context.Context, clientOptions HelmClientOptions, spec addonsv1alpha2.HelmReleaseProxySpec) ([]*release.Release, error) {
+	_, actionConfig, err := HelmInit(ctx, spec.ReleaseNamespace, clientOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -330,14 +590,16 @@ func ListHelmReleases(ctx context.Context, kubeconfig string, spec addonsv1alpha
 	return releases, nil
 }
 
-func UninstallHelmRelease(ctx context.Context, kubeconfig string, spec addonsv1alpha1.HelmReleaseProxySpec) (*release.UninstallReleaseResponse, error) {
-	_, actionConfig, err := HelmInit(ctx, spec.ReleaseNamespace, kubeconfig)
+func UninstallHelmRelease(ctx context.Context, clientOptions HelmClientOptions, spec addonsv1alpha2.HelmReleaseProxySpec) (*release.UninstallReleaseResponse, error) {
+	_, actionConfig, err := HelmInit(ctx, spec.ReleaseNamespace, clientOptions)
 	if err != nil {
 		return nil, err
 	}
 
 	uninstallClient := helmAction.NewUninstall(actionConfig)
+	start := time.Now()
 	response, err := uninstallClient.Run(spec.ReleaseName)
+	observeHelmOperation(helmOperationUninstall, start, err)
 	if err != nil {
 		return nil, err
 	}
@@ -345,12 +607,69 @@ func UninstallHelmRelease(ctx context.Context, kubeconfig string, spec addonsv1a
 	return response, nil
 }
 
-func RollbackHelmRelease(ctx context.Context, kubeconfig string, spec addonsv1alpha1.HelmReleaseProxySpec) error {
-	_, actionConfig, err := HelmInit(ctx, spec.ReleaseNamespace, kubeconfig)
+func RollbackHelmRelease(ctx context.Context, clientOptions HelmClientOptions, spec addonsv1alpha2.HelmReleaseProxySpec) error {
+	_, actionConfig, err := HelmInit(ctx, spec.ReleaseNamespace, clientOptions)
 	if err != nil {
 		return err
 	}
 
 	rollbackClient := helmAction.NewRollback(actionConfig)
-	return rollbackClient.Run(spec.ReleaseName)
+	start := time.Now()
+	err = rollbackClient.Run(spec.ReleaseName)
+	observeHelmOperation(helmOperationRollback, start, err)
+
+	return err
+}
+
+// TestHelmRelease runs the test hooks of a Helm release, as `helm test` does, and waits up to timeout for them to complete.
+// The returned release holds the outcome of each hook and is also returned if a test hook failed.
+func TestHelmRelease(ctx context.Context, clientOptions HelmClientOptions, spec addonsv1alpha2.HelmReleaseProxySpec, timeout time.Duration) (*release.Release, error) {
+	_, actionConfig, err := HelmInit(ctx, spec.ReleaseNamespace, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	testClient := helmAction.NewReleaseTesting(actionConfig)
+	testClient.Namespace = spec.ReleaseNamespace
+	testClient.Timeout = timeout
+	start := time.Now()
+	rel, err := testClient.Run(spec.ReleaseName)
+	observeHelmOperation(helmOperationTest, start, err)
+
+	return rel, err
+}
+
+// ReleaseTestResults returns the outcome of each test hook of a Helm release.
+func ReleaseTestResults(rel *release.Release) []addonsv1alpha2.ReleaseTestResult {
+	var results []addonsv1alpha2.ReleaseTestResult
+	for _, hook := range rel.Hooks {
+		isTest := false
+		for _, event := range hook.Events {
+			if event == release.HookTest {
+				isTest = true
+			}
+		}
+		if !isTest {
+			continue
+		}
+
+		result := addonsv1alpha2.ReleaseTestResult{
+			Name:  hook.Name,
+			Phase: string(release.HookPhaseUnknown),
+		}
+		if hook.LastRun.Phase != "" {
+			result.Phase = hook.LastRun.Phase.String()
+		}
+		if !hook.LastRun.StartedAt.IsZero() {
+			startedAt := metav1.NewTime(hook.LastRun.StartedAt.Time)
+			result.StartedAt = &startedAt
+		}
+		if !hook.LastRun.CompletedAt.IsZero() {
+			completedAt := metav1.NewTime(hook.LastRun.CompletedAt.Time)
+			result.CompletedAt = &completedAt
+		}
+		results = append(results, result)
+	}
+
+	return results
 }
@@ -0,0 +1,201 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
+)
+
+func TestLoadChartCache(t *testing.T) {
+	// The repository URL can't be resolved, so any chart returned comes from the cache.
+	const repoURL = "https://charts.invalid"
+
+	tests := []struct {
+		name      string
+		cached    *cachedChart
+		wantChart bool
+	}{
+		{
+			name:      "fresh chart is returned from the cache",
+			cached:    &cachedChart{loadedAt: time.Now()},
+			wantChart: true,
+		},
+		{
+			name:      "expired chart is returned if the repository can't be reached",
+			cached:    &cachedChart{loadedAt: time.Now().Add(-2 * chartCacheTTL)},
+			wantChart: true,
+		},
+		{
+			name:      "error is returned if the repository can't be reached and nothing is cached",
+			wantChart: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			chartName := "test-chart"
+			key := repoURL + "/" + chartName + "@1.0.0"
+			chartCacheLock.Lock()
+			delete(chartCache, key)
+			var want *chart.Chart
+			if tt.cached != nil {
+				want = &chart.Chart{Metadata: &chart.Metadata{Name: chartName, Version: "1.0.0"}}
+				chartCache[key] = cachedChart{chart: want, loadedAt: tt.cached.loadedAt}
+			}
+			chartCacheLock.Unlock()
+
+			got, err := LoadChart(context.Background(), repoURL, chartName, "1.0.0")
+			if !tt.wantChart {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got).To(BeIdenticalTo(want))
+		})
+	}
+}
+
+func newTestChartWithSubchart() *chart.Chart {
+	subchart := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "subchart", Version: "1.0.0", APIVersion: chart.APIVersionV2},
+		Values: map[string]interface{}{
+			"global": map[string]interface{}{"registry": "docker.io"},
+			"image":  map[string]interface{}{"tag": "1.0.0"},
+		},
+		Schema: []byte(`{
+			"type": "object",
+			"properties": {
+				"image": {"type": "object", "properties": {"tag": {"type": "string"}}}
+			}
+		}`),
+	}
+	parent := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "parent", Version: "1.0.0", APIVersion: chart.APIVersionV2},
+		Values: map[string]interface{}{
+			"global":   map[string]interface{}{"registry": "docker.io"},
+			"replicas": 1,
+			"subchart": map[string]interface{}{"image": map[string]interface{}{"tag": "1.0.0"}},
+		},
+		Schema: []byte(`{
+			"type": "object",
+			"properties": {
+				"replicas": {"type": "integer", "minimum": 1}
+			}
+		}`),
+	}
+	parent.SetDependencies(subchart)
+
+	return parent
+}
+
+func TestValidateValuesAgainstSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  string
+		wantErr bool
+	}{
+		{
+			name:   "empty values use the chart defaults",
+			values: "",
+		},
+		{
+			name:   "valid values",
+			values: "replicas: 3\nsubchart:\n  image:\n    tag: 2.0.0\n",
+		},
+		{
+			name:    "values that don't match the parent schema",
+			values:  "replicas: 0\n",
+			wantErr: true,
+		},
+		{
+			name:    "values that don't match the subchart schema",
+			values:  "subchart:\n  image:\n    tag: 2\n",
+			wantErr: true,
+		},
+		{
+			name:    "values that can't be parsed",
+			values:  "replicas: [",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := ValidateValuesAgainstSchema(newTestChartWithSubchart(), tt.values)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestValidateValuesAgainstSchemaDoesNotModifyChart(t *testing.T) {
+	g := NewWithT(t)
+
+	chartRequested := newTestChartWithSubchart()
+	want := newTestChartWithSubchart()
+
+	// Validate values of different Clusters against the same chart concurrently, as the HelmChartProxy controller does.
+	var wg sync.WaitGroup
+	for _, registry := range []string{"registry-a.example.com", "registry-b.example.com", "registry-c.example.com"} {
+		wg.Add(1)
+		go func(registry string) {
+			defer wg.Done()
+			g.Expect(ValidateValuesAgainstSchema(chartRequested, "global:\n  registry: "+registry+"\n  pullPolicy: Always\n")).To(Succeed())
+		}(registry)
+	}
+	wg.Wait()
+
+	g.Expect(chartRequested.Values).To(Equal(want.Values))
+	g.Expect(chartRequested.Dependencies()).To(HaveLen(1))
+	g.Expect(chartRequested.Dependencies()[0].Values).To(Equal(want.Dependencies()[0].Values))
+	g.Expect(chartRequested.Dependencies()[0].Parent()).To(BeIdenticalTo(chartRequested))
+}
+
+func TestInstallOrUpgradeHelmReleaseGetFailed(t *testing.T) {
+	g := NewWithT(t)
+
+	getErr := errors.New("connection refused")
+	defer func(get func(context.Context, HelmClientOptions, addonsv1alpha2.HelmReleaseProxySpec) (*release.Release, error)) {
+		getHelmRelease = get
+	}(getHelmRelease)
+	getHelmRelease = func(context.Context, HelmClientOptions, addonsv1alpha2.HelmReleaseProxySpec) (*release.Release, error) {
+		return nil, getErr
+	}
+
+	spec := addonsv1alpha2.HelmReleaseProxySpec{ReleaseName: "nginx", ReleaseNamespace: "default", ChartName: "nginx"}
+	rel, changed, err := InstallOrUpgradeHelmRelease(context.Background(), HelmClientOptions{}, spec, nil, false)
+	g.Expect(errors.Cause(err)).To(Equal(getErr))
+	g.Expect(rel).To(BeNil())
+	g.Expect(changed).To(BeFalse())
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/release"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
+
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
+)
+
+const (
+	// hookEventsLimit is the number of most recent events of a failed hook pod included in the diagnostics.
+	hookEventsLimit = 5
+	// hookLogTailLines is the number of lines at the end of the logs of a failed hook container included in the diagnostics.
+	hookLogTailLines = 20
+	// hookLogLimitBytes limits the size of the logs of a failed hook container included in the diagnostics.
+	hookLogLimitBytes = 2048
+)
+
+// DiagnoseHookFailures returns a summary of why the hooks of a failed install or upgrade of a Helm release failed, with the
+// status of each failed hook Job, the recent events of its pod and the tail of its container logs. Only the hooks of a
+// failed revision newer than previousRevision are diagnosed, so that the hooks of an older release aren't reported for a
+// failure that didn't create a revision. It returns an empty summary if no hook of that revision failed.
+func DiagnoseHookFailures(ctx context.Context, clientOptions HelmClientOptions, spec addonsv1alpha2.HelmReleaseProxySpec, previousRevision int) (string, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if spec.ReleaseName == "" {
+		return "", nil
+	}
+
+	_, actionConfig, err := HelmInit(ctx, spec.ReleaseNamespace, clientOptions)
+	if err != nil {
+		return "", err
+	}
+	rel, err := actionConfig.Releases.Last(spec.ReleaseName)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get release %s", spec.ReleaseName)
+	}
+	failed := failedHooks(rel, previousRevision)
+	if len(failed) == 0 {
+		log.V(2).Info("No failed hooks in the latest revision of the release", "release", spec.ReleaseName, "revision", rel.Version, "previousRevision", previousRevision)
+		return "", nil
+	}
+
+	clientset, err := actionConfig.KubernetesClientSet()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create Kubernetes client")
+	}
+
+	summaries := make([]string, 0, len(failed))
+	for _, hook := range failed {
+		namespace := hookNamespace(hook, spec.ReleaseNamespace)
+		log.V(2).Info("Collecting diagnostics of failed hook", "hook", hook.Name, "kind", hook.Kind, "namespace", namespace)
+
+		var details []string
+		var err error
+		switch hook.Kind {
+		case "Job":
+			details, err = diagnoseHookJob(ctx, clientset, namespace, hook.Name)
+		case "Pod":
+			details, err = diagnoseHookPod(ctx, clientset, namespace, hook.Name)
+		}
+		if err != nil {
+			details = append(details, fmt.Sprintf("failed to collect diagnostics: %v", err))
+		}
+
+		summary := fmt.Sprintf("hook %s %s/%s failed", strings.ToLower(hook.Kind), namespace, hook.Name)
+		if len(details) > 0 {
+			summary += ": " + strings.Join(details, "; ")
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return strings.Join(summaries, "\n"), nil
+}
+
+// failedHooks returns the failed hooks of a release if it is a failed revision newer than previousRevision.
+func failedHooks(rel *release.Release, previousRevision int) []*release.Hook {
+	if rel.Version <= previousRevision || rel.Info == nil || rel.Info.Status != release.StatusFailed {
+		return nil
+	}
+
+	var failed []*release.Hook
+	for _, hook := range rel.Hooks {
+		if hook.LastRun.Phase == release.HookPhaseFailed {
+			failed = append(failed, hook)
+		}
+	}
+
+	return failed
+}
+
+// hookNamespace returns the namespace in the manifest of a hook, or the release namespace if the manifest doesn't set one.
+func hookNamespace(hook *release.Hook, releaseNamespace string) string {
+	metadata := &metav1.PartialObjectMetadata{}
+	if err := yaml.Unmarshal([]byte(hook.Manifest), metadata); err == nil && metadata.Namespace != "" {
+		return metadata.Namespace
+	}
+
+	return releaseNamespace
+}
+
+// diagnoseHookJob describes the failed condition of a hook Job and diagnoses its most recent pod.
+func diagnoseHookJob(ctx context.Context, clientset kubernetes.Interface, namespace string, name string) ([]string, error) {
+	job, err := clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get Job %s/%s", namespace, name)
+	}
+
+	var details []string
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			details = append(details, fmt.Sprintf("Job %s: %s", condition.Reason, condition.Message))
+		}
+	}
+	details = append(details, fmt.Sprintf("%d active, %d succeeded, %d failed pods", job.Status.Active, job.Status.Succeeded, job.Status.Failed))
+
+	selector, err := metav1.LabelSelectorAsSelector(job.Spec.Selector)
+	if err != nil {
+		return details, errors.Wrapf(err, "failed to parse selector of Job %s/%s", namespace, name)
+	}
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return details, errors.Wrapf(err, "failed to list pods of Job %s/%s", namespace, name)
+	}
+	if len(pods.Items) == 0 {
+		return details, nil
+	}
+
+	// The most recent pod is the one that failed last.
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].CreationTimestamp.Before(&pods.Items[j].CreationTimestamp)
+	})
+	podDetails, err := diagnosePod(ctx, clientset, &pods.Items[len(pods.Items)-1])
+
+	return append(details, podDetails...), err
+}
+
+// diagnoseHookPod diagnoses a hook Pod.
+func diagnoseHookPod(ctx context.Context, clientset kubernetes.Interface, namespace string, name string) ([]string, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get Pod %s/%s", namespace, name)
+	}
+
+	return diagnosePod(ctx, clientset, pod)
+}
+
+// diagnosePod describes the recent events of a pod and the tail of the logs of its failed containers.
+func diagnosePod(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod) ([]string, error) {
+	var details []string
+
+	events, err := clientset.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{"involvedObject.kind": "Pod", "involvedObject.name": pod.Name}.String(),
+	})
+	if err != nil {
+		return details, errors.Wrapf(err, "failed to list events of pod %s", pod.Name)
+	}
+	sort.Slice(events.Items, func(i, j int) bool {
+		return events.Items[i].LastTimestamp.Before(&events.Items[j].LastTimestamp)
+	})
+	if len(events.Items) > hookEventsLimit {
+		events.Items = events.Items[len(events.Items)-hookEventsLimit:]
+	}
+	if len(events.Items) > 0 {
+		messages := make([]string, 0, len(events.Items))
+		for _, event := range events.Items {
+			messages = append(messages, fmt.Sprintf("%s: %s", event.Reason, event.Message))
+		}
+		details = append(details, fmt.Sprintf("pod %s events: %s", pod.Name, strings.Join(messages, ", ")))
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		terminated := status.State.Terminated
+		if terminated == nil {
+			terminated = status.LastTerminationState.Terminated
+		}
+		if terminated == nil || terminated.ExitCode == 0 {
+			continue
+		}
+
+		tailLines := int64(hookLogTailLines)
+		limitBytes := int64(hookLogLimitBytes)
+		logs, err := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+			Container:  status.Name,
+			Previous:   status.State.Terminated == nil,
+			TailLines:  &tailLines,
+			LimitBytes: &limitBytes,
+		}).DoRaw(ctx)
+		if err != nil {
+			details = append(details, fmt.Sprintf("container %s exited with code %d (%s), failed to get logs: %v", status.Name, terminated.ExitCode, terminated.Reason, err))
+			continue
+		}
+		details = append(details, fmt.Sprintf("container %s exited with code %d (%s), logs:\n%s", status.Name, terminated.ExitCode, terminated.Reason, strings.TrimSpace(string(logs))))
+	}
+
+	return details, nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestFailedHooks(t *testing.T) {
+	succeededHook := &release.Hook{Name: "migrate", Kind: "Job", LastRun: release.HookExecution{Phase: release.HookPhaseSucceeded}}
+	failedHook := &release.Hook{Name: "check", Kind: "Job", LastRun: release.HookExecution{Phase: release.HookPhaseFailed}}
+	newRelease := func(version int, status release.Status) *release.Release {
+		return &release.Release{
+			Name:    "nginx",
+			Version: version,
+			Info:    &release.Info{Status: status},
+			Hooks:   []*release.Hook{succeededHook, failedHook},
+		}
+	}
+
+	tests := []struct {
+		name             string
+		release          *release.Release
+		previousRevision int
+		want             []*release.Hook
+	}{
+		{
+			name:             "failed upgrade",
+			release:          newRelease(3, release.StatusFailed),
+			previousRevision: 2,
+			want:             []*release.Hook{failedHook},
+		},
+		{
+			name:             "failed install",
+			release:          newRelease(1, release.StatusFailed),
+			previousRevision: 0,
+			want:             []*release.Hook{failedHook},
+		},
+		{
+			name:             "latest revision is older than the operation",
+			release:          newRelease(2, release.StatusFailed),
+			previousRevision: 2,
+			want:             nil,
+		},
+		{
+			name:             "latest revision didn't fail",
+			release:          newRelease(3, release.StatusDeployed),
+			previousRevision: 2,
+			want:             nil,
+		},
+		{
+			name:             "release without info",
+			release:          &release.Release{Name: "nginx", Version: 3, Hooks: []*release.Hook{failedHook}},
+			previousRevision: 2,
+			want:             nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(failedHooks(tt.release, tt.previousRevision)).To(Equal(tt.want))
+		})
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
+)
+
+const (
+	metricsNamespace = "caaph"
+
+	helmOperationInstall   = "install"
+	helmOperationUpgrade   = "upgrade"
+	helmOperationUninstall = "uninstall"
+	helmOperationRollback  = "rollback"
+	helmOperationTest      = "test"
+
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+)
+
+var (
+	helmOperationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "helm_operations_total",
+			Help:      "Total number of Helm operations run against workload Clusters, by operation and outcome.",
+		},
+		[]string{"operation", "outcome"},
+	)
+
+	helmOperationDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "helm_operation_duration_seconds",
+			Help:      "Duration of Helm operations run against workload Clusters, by operation and outcome.",
+			Buckets:   []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+		},
+		[]string{"operation", "outcome"},
+	)
+
+	chartDownloadDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "chart_download_duration_seconds",
+			Help:      "Time taken to locate and download a chart from its repository, by chart and outcome.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"chart", "outcome"},
+	)
+
+	helmReleases = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "helm_releases",
+			Help:      "Helm releases managed by HelmReleaseProxies, by chart, version and status. Each HelmReleaseProxy contributes one series with value 1.",
+		},
+		[]string{"namespace", "helmreleaseproxy", "cluster", "chart", "version", "status"},
+	)
+
+	helmReleaseConsecutiveFailures = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "helm_release_consecutive_failures",
+			Help:      "Number of consecutive failed reconciles of a HelmReleaseProxy on its Cluster. Reset to 0 on success.",
+		},
+		[]string{"namespace", "helmreleaseproxy", "cluster"},
+	)
+
+	helmChartProxyMatchingClusters = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "helmchartproxy_matching_clusters",
+			Help:      "Number of Clusters selected by the ClusterSelector of a HelmChartProxy.",
+		},
+		[]string{"namespace", "helmchartproxy"},
+	)
+
+	// releaseLabels tracks the label values last reported for each HelmReleaseProxy so the stale series can be removed
+	// when the chart version or release status changes.
+	releaseLabels     = map[types.NamespacedName]prometheus.Labels{}
+	releaseLabelsLock sync.Mutex
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		helmOperationsTotal,
+		helmOperationDurationSeconds,
+		chartDownloadDurationSeconds,
+		helmReleases,
+		helmReleaseConsecutiveFailures,
+		helmChartProxyMatchingClusters,
+	)
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return outcomeFailure
+	}
+
+	return outcomeSuccess
+}
+
+// observeHelmOperation records the outcome and duration of a Helm operation that started at start.
+func observeHelmOperation(operation string, start time.Time, err error) {
+	helmOperationsTotal.WithLabelValues(operation, outcome(err)).Inc()
+	helmOperationDurationSeconds.WithLabelValues(operation, outcome(err)).Observe(time.Since(start).Seconds())
+}
+
+// observeChartDownload records the time taken to locate a chart that started at start.
+func observeChartDownload(chartName string, start time.Time, err error) {
+	chartDownloadDurationSeconds.WithLabelValues(chartName, outcome(err)).Observe(time.Since(start).Seconds())
+}
+
+// SetReleaseMetric reports the chart version and status of the Helm release managed by a HelmReleaseProxy.
+func SetReleaseMetric(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy, version string, status string) {
+	key := types.NamespacedName{Namespace: helmReleaseProxy.Namespace, Name: helmReleaseProxy.Name}
+	labels := prometheus.Labels{
+		"namespace":        helmReleaseProxy.Namespace,
+		"helmreleaseproxy": helmReleaseProxy.Name,
+		"cluster":          helmReleaseProxy.Spec.ClusterRef.Name,
+		"chart":            helmReleaseProxy.Spec.ChartName,
+		"version":          version,
+		"status":           status,
+	}
+
+	releaseLabelsLock.Lock()
+	defer releaseLabelsLock.Unlock()
+
+	if previous, ok := releaseLabels[key]; ok {
+		helmReleases.Delete(previous)
+	}
+	helmReleases.With(labels).Set(1)
+	releaseLabels[key] = labels
+}
+
+// RecordReleaseFailure increments the consecutive failure count of a HelmReleaseProxy.
+func RecordReleaseFailure(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) {
+	helmReleaseConsecutiveFailures.WithLabelValues(helmReleaseProxy.Namespace, helmReleaseProxy.Name, helmReleaseProxy.Spec.ClusterRef.Name).Inc()
+}
+
+// ResetReleaseFailures resets the consecutive failure count of a HelmReleaseProxy after a successful reconcile.
+func ResetReleaseFailures(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) {
+	helmReleaseConsecutiveFailures.WithLabelValues(helmReleaseProxy.Namespace, helmReleaseProxy.Name, helmReleaseProxy.Spec.ClusterRef.Name).Set(0)
+}
+
+// DeleteReleaseMetrics removes all series reported for a HelmReleaseProxy once it is deleted.
+func DeleteReleaseMetrics(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) {
+	key := types.NamespacedName{Namespace: helmReleaseProxy.Namespace, Name: helmReleaseProxy.Name}
+
+	releaseLabelsLock.Lock()
+	if previous, ok := releaseLabels[key]; ok {
+		helmReleases.Delete(previous)
+		delete(releaseLabels, key)
+	}
+	releaseLabelsLock.Unlock()
+
+	helmReleaseConsecutiveFailures.DeleteLabelValues(helmReleaseProxy.Namespace, helmReleaseProxy.Name, helmReleaseProxy.Spec.ClusterRef.Name)
+}
+
+// SetMatchingClustersMetric reports the number of Clusters selected by a HelmChartProxy.
+func SetMatchingClustersMetric(helmChartProxy *addonsv1alpha2.HelmChartProxy, count int) {
+	helmChartProxyMatchingClusters.WithLabelValues(helmChartProxy.Namespace, helmChartProxy.Name).Set(float64(count))
+}
+
+// DeleteHelmChartProxyMetrics removes all series reported for a HelmChartProxy once it is deleted.
+func DeleteHelmChartProxyMetrics(helmChartProxy *addonsv1alpha2.HelmChartProxy) {
+	helmChartProxyMatchingClusters.DeleteLabelValues(helmChartProxy.Namespace, helmChartProxy.Name)
+}
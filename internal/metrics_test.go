@@ -0,0 +1,127 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
+)
+
+func TestReleaseMetrics(t *testing.T) {
+	helmReleaseProxy := &addonsv1alpha2.HelmReleaseProxy{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx-test-cluster", Namespace: "default"},
+		Spec: addonsv1alpha2.HelmReleaseProxySpec{
+			ClusterRef: corev1.ObjectReference{Name: "test-cluster"},
+			ChartName:  "nginx",
+		},
+	}
+	seriesLabels := func(version string, status string) prometheus.Labels {
+		return prometheus.Labels{
+			"namespace":        "default",
+			"helmreleaseproxy": "nginx-test-cluster",
+			"cluster":          "test-cluster",
+			"chart":            "nginx",
+			"version":          version,
+			"status":           status,
+		}
+	}
+	failures := func(count float64) *float64 {
+		return &count
+	}
+
+	tests := []struct {
+		name         string
+		run          func(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy)
+		wantReleases []prometheus.Labels
+		wantFailures *float64
+	}{
+		{
+			name: "release is reported",
+			run: func(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) {
+				SetReleaseMetric(helmReleaseProxy, "1.0.0", "deployed")
+			},
+			wantReleases: []prometheus.Labels{seriesLabels("1.0.0", "deployed")},
+		},
+		{
+			name: "upgrade replaces the series of the previous version",
+			run: func(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) {
+				SetReleaseMetric(helmReleaseProxy, "1.0.0", "deployed")
+				SetReleaseMetric(helmReleaseProxy, "1.1.0", "pending-upgrade")
+				SetReleaseMetric(helmReleaseProxy, "1.1.0", "deployed")
+			},
+			wantReleases: []prometheus.Labels{seriesLabels("1.1.0", "deployed")},
+		},
+		{
+			name: "consecutive failures are counted",
+			run: func(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) {
+				RecordReleaseFailure(helmReleaseProxy)
+				RecordReleaseFailure(helmReleaseProxy)
+			},
+			wantFailures: failures(2),
+		},
+		{
+			name: "success resets the failures",
+			run: func(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) {
+				RecordReleaseFailure(helmReleaseProxy)
+				ResetReleaseFailures(helmReleaseProxy)
+				SetReleaseMetric(helmReleaseProxy, "1.0.0", "deployed")
+			},
+			wantReleases: []prometheus.Labels{seriesLabels("1.0.0", "deployed")},
+			wantFailures: failures(0),
+		},
+		{
+			name: "deletion removes all series",
+			run: func(helmReleaseProxy *addonsv1alpha2.HelmReleaseProxy) {
+				SetReleaseMetric(helmReleaseProxy, "1.0.0", "deployed")
+				RecordReleaseFailure(helmReleaseProxy)
+				DeleteReleaseMetrics(helmReleaseProxy)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			helmReleases.Reset()
+			helmReleaseConsecutiveFailures.Reset()
+			releaseLabelsLock.Lock()
+			releaseLabels = map[types.NamespacedName]prometheus.Labels{}
+			releaseLabelsLock.Unlock()
+
+			tt.run(helmReleaseProxy)
+
+			g.Expect(testutil.CollectAndCount(helmReleases)).To(Equal(len(tt.wantReleases)))
+			for _, labels := range tt.wantReleases {
+				g.Expect(testutil.ToFloat64(helmReleases.With(labels))).To(Equal(float64(1)))
+			}
+			if tt.wantFailures == nil {
+				g.Expect(testutil.CollectAndCount(helmReleaseConsecutiveFailures)).To(Equal(0))
+			} else {
+				g.Expect(testutil.ToFloat64(helmReleaseConsecutiveFailures.WithLabelValues("default", "nginx-test-cluster", "test-cluster"))).To(Equal(*tt.wantFailures))
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/postrender"
+	"helm.sh/helm/v3/pkg/release"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	kustomizeTypes "sigs.k8s.io/kustomize/api/types"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/yaml"
+
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
+)
+
+const (
+	renderedManifestsFile = "helm-rendered.yaml"
+	kustomizationFile     = "kustomization.yaml"
+)
+
+// PostRenderer is a Helm post-renderer that applies PostRenderers to the rendered manifests with Kustomize and then
+// rewrites the container images to pull from the mirrors of their registries.
+type PostRenderer struct {
+	postRenderers   addonsv1alpha2.PostRenderers
+	registryMirrors map[string]string
+
+	// rewrittenImages maps each image rewritten to a mirror in the last run to the image it was rewritten to.
+	rewrittenImages map[string]string
+}
+
+var _ postrender.PostRenderer = &PostRenderer{}
+
+// NewPostRenderer returns a Helm post-renderer applying the PostRenderers and registry mirrors, or nil if there are none.
+func NewPostRenderer(postRenderers *addonsv1alpha2.PostRenderers, registryMirrors map[string]string) *PostRenderer {
+	if postRenderers == nil && len(registryMirrors) == 0 {
+		return nil
+	}
+
+	postRenderer := &PostRenderer{registryMirrors: registryMirrors}
+	if postRenderers != nil {
+		postRenderer.postRenderers = *postRenderers
+	}
+
+	return postRenderer
+}
+
+// RewrittenImages returns the images rewritten to a mirror in the last run, sorted by the original image.
+func (p *PostRenderer) RewrittenImages() []addonsv1alpha2.RewrittenImage {
+	if p == nil || len(p.rewrittenImages) == 0 {
+		return nil
+	}
+
+	rewrittenImages := make([]addonsv1alpha2.RewrittenImage, 0, len(p.rewrittenImages))
+	for original, rewritten := range p.rewrittenImages {
+		rewrittenImages = append(rewrittenImages, addonsv1alpha2.RewrittenImage{Original: original, Rewritten: rewritten})
+	}
+	sort.Slice(rewrittenImages, func(i, j int) bool { return rewrittenImages[i].Original < rewrittenImages[j].Original })
+
+	return rewrittenImages
+}
+
+// Hash returns a hash of the post-renderers and registry mirrors. Post-renderers aren't recorded in the Helm release, so
+// the hash is recorded in the HelmReleaseProxy status instead to detect when the release must be upgraded because they
+// changed. It returns an empty string if there is no PostRenderer.
+func (p *PostRenderer) Hash() string {
+	if p == nil {
+		return ""
+	}
+
+	// Maps are marshaled with sorted keys, so the hash doesn't depend on the iteration order. The post-renderers and
+	// registry mirrors only contain strings, which always marshal.
+	data, _ := json.Marshal(struct {
+		PostRenderers   addonsv1alpha2.PostRenderers `json:"postRenderers"`
+		RegistryMirrors map[string]string            `json:"registryMirrors"`
+	}{p.postRenderers, p.registryMirrors})
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Run builds a Kustomization with the rendered manifests as its only resource in an in-memory filesystem and returns the
+// result of building it. Helm calls Run once with the manifest of the release, before the hooks are run.
+func (p *PostRenderer) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	p.rewrittenImages = map[string]string{}
+
+	return p.run(renderedManifests.Bytes(), p.postRenderers.PatchesStrategicMerge)
+}
+
+// runHook post-renders the manifest of a single hook. Strategic merge patches fail if the resource they patch doesn't
+// exist, so only the patches of the hook resource are applied.
+func (p *PostRenderer) runHook(manifest []byte, hook *kyaml.RNode) (*bytes.Buffer, error) {
+	if p.rewrittenImages == nil {
+		p.rewrittenImages = map[string]string{}
+	}
+
+	var patches []string
+	for _, patch := range p.postRenderers.PatchesStrategicMerge {
+		target, err := kyaml.Parse(patch)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse strategic merge patch")
+		}
+		if target.GetKind() == hook.GetKind() && target.GetName() == hook.GetName() && (target.GetNamespace() == "" || target.GetNamespace() == hook.GetNamespace()) {
+			patches = append(patches, patch)
+		}
+	}
+
+	return p.run(manifest, patches)
+}
+
+func (p *PostRenderer) run(renderedManifests []byte, patchesStrategicMerge []string) (*bytes.Buffer, error) {
+	fSys := filesys.MakeFsInMemory()
+	if err := fSys.WriteFile(renderedManifestsFile, renderedManifests); err != nil {
+		return nil, errors.Wrapf(err, "failed to write rendered manifests")
+	}
+
+	kustomization, err := yaml.Marshal(p.kustomization(patchesStrategicMerge))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal kustomization")
+	}
+	if err := fSys.WriteFile(kustomizationFile, kustomization); err != nil {
+		return nil, errors.Wrapf(err, "failed to write kustomization")
+	}
+
+	resMap, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fSys, ".")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to apply post-renderers to rendered manifests")
+	}
+
+	if len(p.registryMirrors) > 0 {
+		for _, res := range resMap.Resources() {
+			p.rewriteImages(res.YNode())
+		}
+	}
+	postRendered, err := resMap.AsYaml()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert post-rendered manifests to YAML")
+	}
+
+	return bytes.NewBuffer(postRendered), nil
+}
+
+func (p *PostRenderer) kustomization(patchesStrategicMerge []string) kustomizeTypes.Kustomization {
+	kustomization := kustomizeTypes.Kustomization{
+		TypeMeta: kustomizeTypes.TypeMeta{
+			APIVersion: kustomizeTypes.KustomizationVersion,
+			Kind:       kustomizeTypes.KustomizationKind,
+		},
+		Resources:         []string{renderedManifestsFile},
+		CommonAnnotations: p.postRenderers.CommonAnnotations,
+	}
+
+	for _, patch := range patchesStrategicMerge {
+		kustomization.PatchesStrategicMerge = append(kustomization.PatchesStrategicMerge, kustomizeTypes.PatchStrategicMerge(patch))
+	}
+
+	for _, patch := range p.postRenderers.PatchesJSON6902 {
+		selector := &kustomizeTypes.Selector{
+			AnnotationSelector: patch.Target.AnnotationSelector,
+			LabelSelector:      patch.Target.LabelSelector,
+		}
+		selector.Group = patch.Target.Group
+		selector.Version = patch.Target.Version
+		selector.Kind = patch.Target.Kind
+		selector.Name = patch.Target.Name
+		selector.Namespace = patch.Target.Namespace
+		kustomization.Patches = append(kustomization.Patches, kustomizeTypes.Patch{
+			Patch:  patch.Patch,
+			Target: selector,
+		})
+	}
+
+	for _, image := range p.postRenderers.Images {
+		kustomization.Images = append(kustomization.Images, kustomizeTypes.Image{
+			Name:    image.Name,
+			NewName: image.NewName,
+			NewTag:  image.NewTag,
+			Digest:  image.Digest,
+		})
+	}
+
+	if len(p.postRenderers.CommonLabels) > 0 {
+		kustomization.Labels = []kustomizeTypes.Label{{Pairs: p.postRenderers.CommonLabels}}
+	}
+
+	return kustomization
+}
+
+// rewriteImages rewrites the image of every container, init container and ephemeral container found in node to its mirror.
+func (p *PostRenderer) rewriteImages(node *kyaml.Node) {
+	switch node.Kind {
+	case kyaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			switch key.Value {
+			case "containers", "initContainers", "ephemeralContainers":
+				if value.Kind == kyaml.SequenceNode {
+					for _, container := range value.Content {
+						p.rewriteContainerImage(container)
+					}
+				}
+			}
+			p.rewriteImages(value)
+		}
+	case kyaml.SequenceNode, kyaml.DocumentNode:
+		for _, child := range node.Content {
+			p.rewriteImages(child)
+		}
+	}
+}
+
+func (p *PostRenderer) rewriteContainerImage(container *kyaml.Node) {
+	if container.Kind != kyaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(container.Content); i += 2 {
+		if container.Content[i].Value != "image" || container.Content[i+1].Kind != kyaml.ScalarNode {
+			continue
+		}
+		image := container.Content[i+1].Value
+		if rewritten, ok := rewriteImage(image, p.registryMirrors); ok {
+			container.Content[i+1].Value = rewritten
+			p.rewrittenImages[image] = rewritten
+		}
+	}
+}
+
+// hookPostRenderingKubeClient post-renders the manifests of hooks. Helm only passes the manifest of the release to the
+// post-renderer and builds the manifest of each hook separately with its KubeClient before creating or deleting the hook,
+// so the manifests of hooks are post-rendered when they are built instead.
+type hookPostRenderingKubeClient struct {
+	kube.Interface
+	postRenderer *PostRenderer
+}
+
+func newHookPostRenderingKubeClient(client kube.Interface, postRenderer *PostRenderer) kube.Interface {
+	return &hookPostRenderingKubeClient{Interface: client, postRenderer: postRenderer}
+}
+
+// Build post-renders the manifest if it is the manifest of a hook, and builds the resources in it.
+func (c *hookPostRenderingKubeClient) Build(reader io.Reader, validate bool) (kube.ResourceList, error) {
+	manifest, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// Helm builds each hook from its own manifest with a single resource, and the manifest of the release doesn't
+	// contain hooks.
+	resource, err := kyaml.Parse(string(manifest))
+	if err != nil || resource.GetAnnotations()[release.HookAnnotation] == "" {
+		return c.Interface.Build(bytes.NewReader(manifest), validate)
+	}
+
+	postRendered, err := c.postRenderer.runHook(manifest, resource)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to post-render hook %s %s", resource.GetKind(), resource.GetName())
+	}
+
+	return c.Interface.Build(postRendered, validate)
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/kube"
+
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
+)
+
+// recordingKubeClient records the manifests built with it.
+type recordingKubeClient struct {
+	kube.Interface
+	built []string
+}
+
+func (c *recordingKubeClient) Build(reader io.Reader, _ bool) (kube.ResourceList, error) {
+	manifest, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	c.built = append(c.built, string(manifest))
+
+	return kube.ResourceList{}, nil
+}
+
+const (
+	testDeploymentManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: controller
+spec:
+  template:
+    spec:
+      containers:
+      - name: controller
+        image: registry.k8s.io/ingress-nginx/controller:v1.2.0
+`
+	testHookManifest = `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: admission-create
+  annotations:
+    helm.sh/hook: pre-install,pre-upgrade
+spec:
+  template:
+    spec:
+      containers:
+      - name: create
+        image: registry.k8s.io/ingress-nginx/kube-webhook-certgen:v1.1.1
+`
+)
+
+func TestPostRendererHash(t *testing.T) {
+	postRenderers := &addonsv1alpha2.PostRenderers{CommonLabels: map[string]string{"a": "1", "b": "2"}}
+	mirrors := map[string]string{"docker.io": "mirror.example.com/dockerhub", "quay.io": "mirror.example.com/quay"}
+
+	tests := []struct {
+		name      string
+		a         *PostRenderer
+		b         *PostRenderer
+		wantEqual bool
+	}{
+		{
+			name:      "no post-renderer",
+			a:         NewPostRenderer(nil, nil),
+			b:         NewPostRenderer(nil, nil),
+			wantEqual: true,
+		},
+		{
+			name:      "same post-renderers and mirrors",
+			a:         NewPostRenderer(postRenderers, mirrors),
+			b:         NewPostRenderer(&addonsv1alpha2.PostRenderers{CommonLabels: map[string]string{"b": "2", "a": "1"}}, map[string]string{"quay.io": "mirror.example.com/quay", "docker.io": "mirror.example.com/dockerhub"}),
+			wantEqual: true,
+		},
+		{
+			name:      "post-renderer added",
+			a:         NewPostRenderer(nil, nil),
+			b:         NewPostRenderer(postRenderers, nil),
+			wantEqual: false,
+		},
+		{
+			name:      "patch changed",
+			a:         NewPostRenderer(&addonsv1alpha2.PostRenderers{PatchesStrategicMerge: []string{"a"}}, nil),
+			b:         NewPostRenderer(&addonsv1alpha2.PostRenderers{PatchesStrategicMerge: []string{"b"}}, nil),
+			wantEqual: false,
+		},
+		{
+			name:      "mirror changed",
+			a:         NewPostRenderer(nil, mirrors),
+			b:         NewPostRenderer(nil, map[string]string{"docker.io": "other.example.com/dockerhub", "quay.io": "mirror.example.com/quay"}),
+			wantEqual: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			if tt.wantEqual {
+				g.Expect(tt.a.Hash()).To(Equal(tt.b.Hash()))
+			} else {
+				g.Expect(tt.a.Hash()).NotTo(Equal(tt.b.Hash()))
+			}
+		})
+	}
+}
+
+func TestHookPostRenderingKubeClientBuild(t *testing.T) {
+	postRenderers := &addonsv1alpha2.PostRenderers{
+		PatchesStrategicMerge: []string{
+			// Only the patch of the hook applies to the hook manifest, the other one would fail without its target.
+			"apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: admission-create\nspec:\n  template:\n    spec:\n      tolerations:\n      - key: node-role.kubernetes.io/control-plane\n        effect: NoSchedule\n",
+			"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: controller\nspec:\n  replicas: 2\n",
+		},
+	}
+	mirrors := map[string]string{"registry.k8s.io": "mirror.example.com/k8s"}
+
+	tests := []struct {
+		name            string
+		manifest        string
+		wantContains    []string
+		wantNotContains []string
+		wantRewritten   []addonsv1alpha2.RewrittenImage
+	}{
+		{
+			name:     "hook is patched and its images are rewritten",
+			manifest: testHookManifest,
+			wantContains: []string{
+				"key: node-role.kubernetes.io/control-plane",
+				"image: mirror.example.com/k8s/ingress-nginx/kube-webhook-certgen:v1.1.1",
+			},
+			wantNotContains: []string{"replicas: 2"},
+			wantRewritten: []addonsv1alpha2.RewrittenImage{
+				{Original: "registry.k8s.io/ingress-nginx/kube-webhook-certgen:v1.1.1", Rewritten: "mirror.example.com/k8s/ingress-nginx/kube-webhook-certgen:v1.1.1"},
+			},
+		},
+		{
+			name:            "manifest without hooks is passed through",
+			manifest:        testDeploymentManifest,
+			wantContains:    []string{"image: registry.k8s.io/ingress-nginx/controller:v1.2.0"},
+			wantNotContains: []string{"replicas: 2", "mirror.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			recorder := &recordingKubeClient{}
+			postRenderer := NewPostRenderer(postRenderers, mirrors)
+			client := newHookPostRenderingKubeClient(recorder, postRenderer)
+
+			_, err := client.Build(bytes.NewBufferString(tt.manifest), true)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(recorder.built).To(HaveLen(1))
+			for _, s := range tt.wantContains {
+				g.Expect(recorder.built[0]).To(ContainSubstring(s))
+			}
+			for _, s := range tt.wantNotContains {
+				g.Expect(recorder.built[0]).NotTo(ContainSubstring(s))
+			}
+			g.Expect(postRenderer.RewrittenImages()).To(Equal(tt.wantRewritten))
+		})
+	}
+}
+
+func TestPostRendererRunAndHooksRecordRewrittenImages(t *testing.T) {
+	g := NewWithT(t)
+
+	postRenderer := NewPostRenderer(nil, map[string]string{"registry.k8s.io": "mirror.example.com/k8s"})
+	client := newHookPostRenderingKubeClient(&recordingKubeClient{}, postRenderer)
+
+	// Helm post-renders the release manifest first and builds the hooks afterwards.
+	postRendered, err := postRenderer.Run(bytes.NewBufferString(testDeploymentManifest))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(postRendered.String()).To(ContainSubstring("image: mirror.example.com/k8s/ingress-nginx/controller:v1.2.0"))
+	_, err = client.Build(bytes.NewBufferString(testHookManifest), true)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(postRenderer.RewrittenImages()).To(ConsistOf(
+		addonsv1alpha2.RewrittenImage{Original: "registry.k8s.io/ingress-nginx/controller:v1.2.0", Rewritten: "mirror.example.com/k8s/ingress-nginx/controller:v1.2.0"},
+		addonsv1alpha2.RewrittenImage{Original: "registry.k8s.io/ingress-nginx/kube-webhook-certgen:v1.1.1", Rewritten: "mirror.example.com/k8s/ingress-nginx/kube-webhook-certgen:v1.1.1"},
+	))
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const defaultRegistry = "docker.io"
+
+// ParseRegistryMirrors parses a comma-separated list of registry=mirror pairs, e.g.
+// "docker.io=registry.internal/dockerhub,quay.io=registry.internal/quay".
+func ParseRegistryMirrors(value string) (map[string]string, error) {
+	mirrors := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("invalid registry mirror %q, expected registry=mirror", pair)
+		}
+		mirrors[strings.TrimSuffix(parts[0], "/")] = strings.TrimSuffix(parts[1], "/")
+	}
+
+	return mirrors, nil
+}
+
+// GetRegistryMirrorsFromConfigMap returns the registry mirrors in the data of a ConfigMap, where each key is a registry
+// and its value is the mirror to rewrite it to.
+func GetRegistryMirrorsFromConfigMap(ctx context.Context, c ctrlClient.Reader, key types.NamespacedName) (map[string]string, error) {
+	configMap := &corev1.ConfigMap{}
+	if err := c.Get(ctx, key, configMap); err != nil {
+		return nil, errors.Wrapf(err, "failed to get registry mirrors ConfigMap %s", key)
+	}
+
+	mirrors := map[string]string{}
+	for registry, mirror := range configMap.Data {
+		mirrors[strings.TrimSuffix(registry, "/")] = strings.TrimSuffix(strings.TrimSpace(mirror), "/")
+	}
+
+	return mirrors, nil
+}
+
+// MergeRegistryMirrors merges sets of registry mirrors, where mirrors later in the list take precedence.
+func MergeRegistryMirrors(mirrorSets ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, mirrors := range mirrorSets {
+		for registry, mirror := range mirrors {
+			merged[registry] = mirror
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+
+	return merged
+}
+
+// rewriteImage rewrites an image reference to pull from the mirror of its registry. The registries in mirrors may also
+// include a repository path, e.g. docker.io/bitnami, in which case the longest matching prefix is used.
+func rewriteImage(image string, mirrors map[string]string) (string, bool) {
+	normalized := normalizeImage(image)
+
+	prefixes := make([]string, 0, len(mirrors))
+	for prefix := range mirrors {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(normalized, prefix+"/") {
+			return mirrors[prefix] + strings.TrimPrefix(normalized, prefix), true
+		}
+	}
+
+	return image, false
+}
+
+// normalizeImage returns the fully qualified form of an image reference, e.g. nginx:1.21 and docker.io/nginx:1.21 become
+// docker.io/library/nginx:1.21.
+func normalizeImage(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 1 {
+		return defaultRegistry + "/library/" + image
+	}
+	if parts[0] == defaultRegistry && !strings.Contains(parts[1], "/") {
+		return defaultRegistry + "/library/" + parts[1]
+	}
+	if parts[0] == "localhost" || strings.ContainsAny(parts[0], ".:") {
+		return image
+	}
+
+	return defaultRegistry + "/" + image
+}
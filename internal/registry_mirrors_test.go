@@ -0,0 +1,175 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseRegistryMirrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			value: "",
+			want:  map[string]string{},
+		},
+		{
+			name:  "multiple pairs with whitespace and trailing slashes",
+			value: " docker.io=registry.internal/dockerhub/ , quay.io/=registry.internal/quay,",
+			want: map[string]string{
+				"docker.io": "registry.internal/dockerhub",
+				"quay.io":   "registry.internal/quay",
+			},
+		},
+		{
+			name:  "registry with repository path",
+			value: "docker.io/bitnami=registry.internal/bitnami",
+			want:  map[string]string{"docker.io/bitnami": "registry.internal/bitnami"},
+		},
+		{
+			name:    "missing mirror",
+			value:   "docker.io=",
+			wantErr: true,
+		},
+		{
+			name:    "missing registry",
+			value:   "=registry.internal",
+			wantErr: true,
+		},
+		{
+			name:    "not a pair",
+			value:   "docker.io",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			got, err := ParseRegistryMirrors(tt.value)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestNormalizeImage(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "nginx", want: "docker.io/library/nginx"},
+		{image: "nginx:1.21", want: "docker.io/library/nginx:1.21"},
+		{image: "nginx@sha256:abc", want: "docker.io/library/nginx@sha256:abc"},
+		{image: "bitnami/redis:7.0", want: "docker.io/bitnami/redis:7.0"},
+		{image: "docker.io/bitnami/redis:7.0", want: "docker.io/bitnami/redis:7.0"},
+		{image: "docker.io/nginx", want: "docker.io/library/nginx"},
+		{image: "docker.io/nginx:1.21", want: "docker.io/library/nginx:1.21"},
+		{image: "docker.io/library/nginx:1.21", want: "docker.io/library/nginx:1.21"},
+		{image: "quay.io/jetstack/cert-manager-controller:v1.8.0", want: "quay.io/jetstack/cert-manager-controller:v1.8.0"},
+		{image: "localhost/app:dev", want: "localhost/app:dev"},
+		{image: "registry.internal:5000/app:1.0", want: "registry.internal:5000/app:1.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(normalizeImage(tt.image)).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestRewriteImage(t *testing.T) {
+	mirrors := map[string]string{
+		"docker.io":         "registry.internal/dockerhub",
+		"docker.io/bitnami": "registry.internal/bitnami",
+		"registry.k8s.io":   "registry.internal/k8s",
+	}
+
+	tests := []struct {
+		name          string
+		image         string
+		want          string
+		wantRewritten bool
+	}{
+		{
+			name:          "official image without registry",
+			image:         "nginx:1.21",
+			want:          "registry.internal/dockerhub/library/nginx:1.21",
+			wantRewritten: true,
+		},
+		{
+			name:          "longest matching prefix wins",
+			image:         "bitnami/redis:7.0",
+			want:          "registry.internal/bitnami/redis:7.0",
+			wantRewritten: true,
+		},
+		{
+			name:          "explicit registry",
+			image:         "registry.k8s.io/ingress-nginx/controller:v1.2.0",
+			want:          "registry.internal/k8s/ingress-nginx/controller:v1.2.0",
+			wantRewritten: true,
+		},
+		{
+			name:          "digest is kept",
+			image:         "registry.k8s.io/pause@sha256:abc",
+			want:          "registry.internal/k8s/pause@sha256:abc",
+			wantRewritten: true,
+		},
+		{
+			name:          "registry without mirror",
+			image:         "quay.io/jetstack/cert-manager-controller:v1.8.0",
+			want:          "quay.io/jetstack/cert-manager-controller:v1.8.0",
+			wantRewritten: false,
+		},
+		{
+			name:          "registry that only shares a prefix with a mirrored registry",
+			image:         "registry.k8s.io.evil.com/pause:3.6",
+			want:          "registry.k8s.io.evil.com/pause:3.6",
+			wantRewritten: false,
+		},
+		{
+			name:          "repository that only shares a prefix with a mirrored repository",
+			image:         "docker.io/bitnamilabs/app:1.0",
+			want:          "registry.internal/dockerhub/bitnamilabs/app:1.0",
+			wantRewritten: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			got, rewritten := rewriteImage(tt.image, mirrors)
+			g.Expect(got).To(Equal(tt.want))
+			g.Expect(rewritten).To(Equal(tt.wantRewritten))
+		})
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/release"
+	helmDriver "helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// sqlNamespaceColumnLength is the length of the namespace column of Helm's release table.
+const sqlNamespaceColumnLength = 64
+
+// sqlReleaseNamespace returns the namespace that the releases in a namespace of a workload Cluster are stored under in
+// the SQL database. All Clusters that use the same database share one release table, so the namespace is qualified with
+// the Cluster to keep releases with the same name and namespace on different Clusters apart. It is hashed if it doesn't
+// fit the namespace column.
+func sqlReleaseNamespace(cluster types.NamespacedName, namespace string) string {
+	qualified := cluster.Namespace + "/" + cluster.Name + "/" + namespace
+	if len(qualified) <= sqlNamespaceColumnLength {
+		return qualified
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(qualified)))
+}
+
+// namespacedSQLDriver returns a copy of a shared SQL driver that reads the releases stored under a SQL namespace. The
+// copy uses the connection pool of the shared driver. Helm's SQL driver has no way to set its namespace other than
+// NewSQL, which opens a new connection pool, but it switches to the namespace of each release it creates or updates. So
+// the namespace is set by updating a release with an empty key, which doesn't exist.
+func namespacedSQLDriver(shared *helmDriver.SQL, sqlNamespace string) (*helmDriver.SQL, error) {
+	sqlDriver := *shared
+	if err := sqlDriver.Update("", &release.Release{Namespace: sqlNamespace, Info: &release.Info{}}); err != nil {
+		return nil, errors.Wrapf(err, "failed to query the Helm release database")
+	}
+
+	return &sqlDriver, nil
+}
+
+// clusterSQLDriver stores the releases of a namespace of a workload Cluster under its qualified SQL namespace. Helm's
+// SQL driver stores each release under the namespace of the release, so the namespace is replaced when a release is
+// stored and restored when it is read.
+type clusterSQLDriver struct {
+	helmDriver.Driver
+
+	namespace    string
+	sqlNamespace string
+}
+
+var _ helmDriver.Driver = &clusterSQLDriver{}
+
+func newClusterSQLDriver(driver helmDriver.Driver, cluster types.NamespacedName, namespace string) *clusterSQLDriver {
+	return &clusterSQLDriver{
+		Driver:       driver,
+		namespace:    namespace,
+		sqlNamespace: sqlReleaseNamespace(cluster, namespace),
+	}
+}
+
+func (d *clusterSQLDriver) Create(key string, rls *release.Release) error {
+	return d.Driver.Create(key, d.toSQL(rls))
+}
+
+func (d *clusterSQLDriver) Update(key string, rls *release.Release) error {
+	return d.Driver.Update(key, d.toSQL(rls))
+}
+
+func (d *clusterSQLDriver) Delete(key string) (*release.Release, error) {
+	rls, err := d.Driver.Delete(key)
+
+	return d.fromSQL(rls), err
+}
+
+func (d *clusterSQLDriver) Get(key string) (*release.Release, error) {
+	rls, err := d.Driver.Get(key)
+
+	return d.fromSQL(rls), err
+}
+
+func (d *clusterSQLDriver) List(filter func(*release.Release) bool) ([]*release.Release, error) {
+	return d.Driver.List(func(rls *release.Release) bool {
+		return filter(d.fromSQL(rls))
+	})
+}
+
+func (d *clusterSQLDriver) Query(labels map[string]string) ([]*release.Release, error) {
+	releases, err := d.Driver.Query(labels)
+	for _, rls := range releases {
+		d.fromSQL(rls)
+	}
+
+	return releases, err
+}
+
+// toSQL returns a copy of the release with the qualified SQL namespace, since Helm keeps using the release after it is
+// stored.
+func (d *clusterSQLDriver) toSQL(rls *release.Release) *release.Release {
+	if rls == nil {
+		return nil
+	}
+	sqlRelease := *rls
+	sqlRelease.Namespace = d.sqlNamespace
+
+	return &sqlRelease
+}
+
+// fromSQL restores the namespace of a release read from the database.
+func (d *clusterSQLDriver) fromSQL(rls *release.Release) *release.Release {
+	if rls != nil && rls.Namespace == d.sqlNamespace {
+		rls.Namespace = d.namespace
+	}
+
+	return rls
+}
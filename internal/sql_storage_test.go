@@ -0,0 +1,208 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	helmDriver "helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/types"
+
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
+)
+
+// fakeSQLDatabase is a release table shared by several fakeSQLDrivers.
+type fakeSQLDatabase map[string]release.Release
+
+// fakeSQLDriver behaves like Helm's SQL driver: it stores releases under the namespace of the release, and reads the
+// releases of the namespace it was created with.
+type fakeSQLDriver struct {
+	db        fakeSQLDatabase
+	namespace string
+}
+
+func (d *fakeSQLDriver) Name() string {
+	return helmDriver.SQLDriverName
+}
+
+func (d *fakeSQLDriver) Create(key string, rls *release.Release) error {
+	if _, ok := d.db[rls.Namespace+"/"+key]; ok {
+		return helmDriver.ErrReleaseExists
+	}
+	d.db[rls.Namespace+"/"+key] = *rls
+
+	return nil
+}
+
+func (d *fakeSQLDriver) Update(key string, rls *release.Release) error {
+	d.db[rls.Namespace+"/"+key] = *rls
+
+	return nil
+}
+
+func (d *fakeSQLDriver) Delete(key string) (*release.Release, error) {
+	rls, err := d.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	delete(d.db, d.namespace+"/"+key)
+
+	return rls, nil
+}
+
+func (d *fakeSQLDriver) Get(key string) (*release.Release, error) {
+	rls, ok := d.db[d.namespace+"/"+key]
+	if !ok {
+		return nil, helmDriver.ErrReleaseNotFound
+	}
+
+	return &rls, nil
+}
+
+func (d *fakeSQLDriver) List(filter func(*release.Release) bool) ([]*release.Release, error) {
+	var releases []*release.Release
+	for key := range d.db {
+		if !strings.HasPrefix(key, d.namespace+"/") {
+			continue
+		}
+		rls := d.db[key]
+		if filter(&rls) {
+			releases = append(releases, &rls)
+		}
+	}
+
+	return releases, nil
+}
+
+func (d *fakeSQLDriver) Query(labels map[string]string) ([]*release.Release, error) {
+	releases, _ := d.List(func(rls *release.Release) bool {
+		return labels["name"] == "" || labels["name"] == rls.Name
+	})
+	if len(releases) == 0 {
+		return nil, helmDriver.ErrReleaseNotFound
+	}
+
+	return releases, nil
+}
+
+func TestSQLReleaseNamespace(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterA := types.NamespacedName{Namespace: "default", Name: "cluster-a"}
+	clusterB := types.NamespacedName{Namespace: "default", Name: "cluster-b"}
+	g.Expect(sqlReleaseNamespace(clusterA, "kube-system")).To(Equal("default/cluster-a/kube-system"))
+	g.Expect(sqlReleaseNamespace(clusterA, "kube-system")).NotTo(Equal(sqlReleaseNamespace(clusterB, "kube-system")))
+
+	long := types.NamespacedName{Namespace: strings.Repeat("n", 63), Name: strings.Repeat("c", 63)}
+	g.Expect(sqlReleaseNamespace(long, "kube-system")).To(HaveLen(sqlNamespaceColumnLength))
+	g.Expect(sqlReleaseNamespace(long, "kube-system")).NotTo(Equal(sqlReleaseNamespace(long, "default")))
+}
+
+func TestClusterSQLDriverSharedDatabase(t *testing.T) {
+	g := NewWithT(t)
+
+	db := fakeSQLDatabase{}
+	clusterStorage := func(cluster types.NamespacedName, namespace string) *storage.Storage {
+		sqlDriver := &fakeSQLDriver{db: db, namespace: sqlReleaseNamespace(cluster, namespace)}
+
+		return storage.Init(newClusterSQLDriver(sqlDriver, cluster, namespace))
+	}
+	newRelease := func(version int, status release.Status) *release.Release {
+		return &release.Release{Name: "nginx", Namespace: "ingress", Version: version, Info: &release.Info{Status: status}}
+	}
+
+	clusterA := clusterStorage(types.NamespacedName{Namespace: "default", Name: "cluster-a"}, "ingress")
+	clusterB := clusterStorage(types.NamespacedName{Namespace: "default", Name: "cluster-b"}, "ingress")
+
+	// The same release is installed on both Clusters, and upgraded on the first.
+	g.Expect(clusterA.Create(newRelease(1, release.StatusDeployed))).To(Succeed())
+	g.Expect(clusterB.Create(newRelease(1, release.StatusDeployed))).To(Succeed())
+	rls := newRelease(1, release.StatusSuperseded)
+	g.Expect(clusterA.Update(rls)).To(Succeed())
+	g.Expect(rls.Namespace).To(Equal("ingress"))
+	g.Expect(clusterA.Create(newRelease(2, release.StatusDeployed))).To(Succeed())
+	g.Expect(db).To(HaveLen(3))
+
+	last, err := clusterA.Last("nginx")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(last.Version).To(Equal(2))
+	g.Expect(last.Namespace).To(Equal("ingress"))
+	history, err := clusterA.History("nginx")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(history).To(HaveLen(2))
+
+	last, err = clusterB.Last("nginx")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(last.Version).To(Equal(1))
+	g.Expect(last.Info.Status).To(Equal(release.StatusDeployed))
+	deployed, err := clusterB.ListDeployed()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(deployed).To(HaveLen(1))
+	g.Expect(deployed[0].Namespace).To(Equal("ingress"))
+
+	// Uninstalling the release from the second Cluster doesn't delete the release of the first.
+	deleted, err := clusterB.Delete("nginx", 1)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(deleted.Namespace).To(Equal("ingress"))
+	_, err = clusterB.Get("nginx", 1)
+	g.Expect(err).To(MatchError(helmDriver.ErrReleaseNotFound))
+	_, err = clusterA.Get("nginx", 1)
+	g.Expect(err).NotTo(HaveOccurred())
+}
+
+func TestGetSQLDriverSharedByClusters(t *testing.T) {
+	g := NewWithT(t)
+
+	connections := map[string]int{}
+	originalSQLDrivers, originalNewSQLDriver := sqlDrivers, newSQLDriver
+	defer func() {
+		sqlDrivers, newSQLDriver = originalSQLDrivers, originalNewSQLDriver
+	}()
+	sqlDrivers = map[string]*helmDriver.SQL{}
+	newSQLDriver = func(connectionString string, _ func(string, ...interface{}), namespace string) (*helmDriver.SQL, error) {
+		connections[connectionString]++
+		g.Expect(namespace).To(BeEmpty())
+
+		return &helmDriver.SQL{}, nil
+	}
+
+	clusterA := HelmClientOptions{
+		StorageDriver:       addonsv1alpha2.HelmStorageDriverSQL,
+		SQLConnectionString: "postgres://helm@db.example.com/releases",
+		Cluster:             types.NamespacedName{Namespace: "default", Name: "cluster-a"},
+	}
+	clusterB := clusterA
+	clusterB.Cluster.Name = "cluster-b"
+	clusterC := clusterA
+	clusterC.Cluster.Name = "cluster-c"
+	clusterC.SQLConnectionString = "postgres://helm@other-db.example.com/releases"
+
+	driverA, err := getSQLDriver(clusterA.SQLConnectionString)
+	g.Expect(err).NotTo(HaveOccurred())
+	driverB, err := getSQLDriver(clusterB.SQLConnectionString)
+	g.Expect(err).NotTo(HaveOccurred())
+	driverC, err := getSQLDriver(clusterC.SQLConnectionString)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(driverB).To(BeIdenticalTo(driverA))
+	g.Expect(driverC).NotTo(BeIdenticalTo(driverA))
+	g.Expect(connections).To(Equal(map[string]int{clusterA.SQLConnectionString: 1, clusterC.SQLConnectionString: 1}))
+}
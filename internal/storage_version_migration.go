@@ -0,0 +1,139 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// storageVersionMigrationPageSize is the number of objects listed per request while migrating a CRD.
+const storageVersionMigrationPageSize = 100
+
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions/status,verbs=update;patch
+//+kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=chartsourcepolicies,verbs=list;update
+
+// StorageVersionMigrator rewrites every object of the given CRDs in their storage version and then drops the old
+// versions from status.storedVersions, so that served versions can be removed from the CRDs in a later release.
+type StorageVersionMigrator struct {
+	Client    client.Client
+	APIReader client.Reader
+
+	// CRDNames are the names of the CustomResourceDefinitions to migrate.
+	CRDNames []string
+}
+
+var _ manager.LeaderElectionRunnable = &StorageVersionMigrator{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable so that only the leader migrates objects.
+func (m *StorageVersionMigrator) NeedLeaderElection() bool {
+	return true
+}
+
+// Start implements manager.Runnable. A CRD that fails to migrate is retried with a backoff and logged, without stopping the
+// manager, since the old versions are still served.
+func (m *StorageVersionMigrator) Start(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("storage-version-migration")
+
+	backoff := wait.Backoff{Duration: 5 * time.Second, Factor: 2, Steps: 6}
+	for _, name := range m.CRDNames {
+		var lastErr error
+		err := wait.ExponentialBackoffWithContext(ctx, backoff, func() (bool, error) {
+			if lastErr = m.migrate(ctx, name); lastErr != nil {
+				log.V(2).Info("Retrying storage version migration", "crd", name, "error", lastErr.Error())
+				return false, nil
+			}
+
+			return true, nil
+		})
+		if err != nil {
+			if lastErr != nil {
+				err = lastErr
+			}
+			log.Error(err, "Failed to migrate storage version", "crd", name)
+		}
+	}
+
+	return nil
+}
+
+// migrate rewrites the objects of a CRD in its storage version if status.storedVersions lists any other version.
+func (m *StorageVersionMigrator) migrate(ctx context.Context, name string) error {
+	log := ctrl.LoggerFrom(ctx).WithName("storage-version-migration")
+
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := m.APIReader.Get(ctx, types.NamespacedName{Name: name}, crd); err != nil {
+		return errors.Wrapf(err, "failed to get CustomResourceDefinition %s", name)
+	}
+
+	storageVersion := ""
+	for _, version := range crd.Spec.Versions {
+		if version.Storage {
+			storageVersion = version.Name
+			break
+		}
+	}
+	if storageVersion == "" {
+		return errors.Errorf("CustomResourceDefinition %s has no storage version", name)
+	}
+	if len(crd.Status.StoredVersions) == 1 && crd.Status.StoredVersions[0] == storageVersion {
+		return nil
+	}
+
+	log.Info("Migrating objects to storage version", "crd", name, "storedVersions", crd.Status.StoredVersions, "storageVersion", storageVersion)
+
+	list := &unstructured.UnstructuredList{}
+	list.SetAPIVersion(crd.Spec.Group + "/" + storageVersion)
+	list.SetKind(crd.Spec.Names.ListKind)
+	for {
+		if err := m.APIReader.List(ctx, list, client.Limit(storageVersionMigrationPageSize), client.Continue(list.GetContinue())); err != nil {
+			return errors.Wrapf(err, "failed to list %s", crd.Spec.Names.Plural)
+		}
+
+		for i := range list.Items {
+			// An update without changes still makes the API server write the object in the storage version.
+			if err := m.Client.Update(ctx, &list.Items[i]); err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+				return errors.Wrapf(err, "failed to migrate %s %s", crd.Spec.Names.Kind, client.ObjectKeyFromObject(&list.Items[i]))
+			}
+		}
+
+		if list.GetContinue() == "" {
+			break
+		}
+	}
+
+	patch := client.MergeFrom(crd.DeepCopy())
+	crd.Status.StoredVersions = []string{storageVersion}
+	if err := m.Client.Status().Patch(ctx, crd, patch); err != nil {
+		return errors.Wrapf(err, "failed to update stored versions of CustomResourceDefinition %s", name)
+	}
+
+	log.Info("Migrated objects to storage version", "crd", name, "storageVersion", storageVersion)
+
+	return nil
+}
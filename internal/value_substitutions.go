@@ -19,22 +19,28 @@ package internal
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"text/template"
 
 	"github.com/Masterminds/sprig"
 	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chartutil"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/controllers/external"
 	kcpv1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	ctrlClient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
 
-	addonsv1alpha1 "cluster-api-addon-provider-helm/api/v1alpha1"
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
 )
 
-func initializeBuiltins(ctx context.Context, c ctrlClient.Client, referenceMap map[string]corev1.ObjectReference, spec addonsv1alpha1.HelmChartProxySpec, cluster *clusterv1.Cluster) (map[string]interface{}, error) {
+func initializeBuiltins(ctx context.Context, c ctrlClient.Client, referenceMap map[string]corev1.ObjectReference, spec addonsv1alpha2.HelmChartProxySpec, cluster *clusterv1.Cluster) (map[string]interface{}, error) {
 	log := ctrl.LoggerFrom(ctx)
 
 	valueLookUp := make(map[string]interface{})
@@ -59,10 +65,10 @@ type BuiltinTypes struct {
 	Machines           map[string]clusterv1.Machine
 }
 
-func ParseValues(ctx context.Context, c ctrlClient.Client, spec addonsv1alpha1.HelmChartProxySpec, cluster *clusterv1.Cluster) (string, error) {
-	log := ctrl.LoggerFrom(ctx)
-
-	log.V(2).Info("Rendering templating in values:", "values", spec.ValuesTemplate)
+// InitializeTemplateContext fetches the objects referenced by a Cluster that can be used in the Go templating of a
+// HelmChartProxy, keyed by the name they are referenced by in the templates. For a Cluster with a managed topology this
+// also includes its ClusterClass, the templates it references and the resolved topology variables.
+func InitializeTemplateContext(ctx context.Context, c ctrlClient.Client, spec addonsv1alpha2.HelmChartProxySpec, cluster *clusterv1.Cluster) (map[string]interface{}, error) {
 	references := map[string]corev1.ObjectReference{
 		"Cluster": {
 			APIVersion: cluster.APIVersion,
@@ -78,28 +84,282 @@ func ParseValues(ctx context.Context, c ctrlClient.Client, spec addonsv1alpha1.H
 	if cluster.Spec.InfrastructureRef != nil {
 		references["InfraCluster"] = *cluster.Spec.InfrastructureRef
 	}
-	// TODO: would we want to add ControlPlaneMachineTemplate?
+
+	if cluster.Spec.Topology == nil {
+		return initializeBuiltins(ctx, c, references, spec, cluster)
+	}
+
+	clusterClass := &clusterv1.ClusterClass{}
+	clusterClassKey := ctrlClient.ObjectKey{Namespace: cluster.Namespace, Name: cluster.Spec.Topology.Class}
+	if err := c.Get(ctx, clusterClassKey, clusterClass); err != nil {
+		return nil, errors.Wrapf(err, "failed to get ClusterClass %s", clusterClassKey)
+	}
+
+	if clusterClass.Spec.Infrastructure.Ref != nil {
+		references["InfraClusterTemplate"] = *clusterClass.Spec.Infrastructure.Ref
+	}
+	if clusterClass.Spec.ControlPlane.Ref != nil {
+		references["ControlPlaneTemplate"] = *clusterClass.Spec.ControlPlane.Ref
+	}
+	if clusterClass.Spec.ControlPlane.MachineInfrastructure != nil && clusterClass.Spec.ControlPlane.MachineInfrastructure.Ref != nil {
+		references["ControlPlaneMachineTemplate"] = *clusterClass.Spec.ControlPlane.MachineInfrastructure.Ref
+	}
 
 	valueLookUp, err := initializeBuiltins(ctx, c, references, spec, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if err := initializeTopology(ctx, c, clusterClass, cluster, valueLookUp); err != nil {
+		return nil, err
+	}
+
+	return valueLookUp, nil
+}
+
+// initializeTopology adds the ClusterClass of a Cluster with a managed topology, the templates of its
+// MachineDeployment classes and the topology variables resolved with their ClusterClass defaults to valueLookUp.
+func initializeTopology(ctx context.Context, c ctrlClient.Client, clusterClass *clusterv1.ClusterClass, cluster *clusterv1.Cluster, valueLookUp map[string]interface{}) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	clusterClassObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(clusterClass)
+	if err != nil {
+		return errors.Wrapf(err, "failed to convert ClusterClass %s", clusterClass.Name)
+	}
+	clusterClassObj["apiVersion"] = clusterv1.GroupVersion.String()
+	clusterClassObj["kind"] = "ClusterClass"
+	valueLookUp["ClusterClass"] = clusterClassObj
+
+	workerMachineTemplates := make(map[string]interface{}, len(clusterClass.Spec.Workers.MachineDeployments))
+	for _, mdClass := range clusterClass.Spec.Workers.MachineDeployments {
+		templates := map[string]interface{}{}
+		for name, ref := range map[string]*corev1.ObjectReference{
+			"Bootstrap":      mdClass.Template.Bootstrap.Ref,
+			"Infrastructure": mdClass.Template.Infrastructure.Ref,
+		} {
+			if ref == nil {
+				continue
+			}
+			log.V(2).Info("Getting object for reference", "ref", ref)
+			obj, err := external.Get(ctx, c, ref, cluster.Namespace)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get %s template %s for MachineDeployment class %s", name, ref.Name, mdClass.Class)
+			}
+			templates[name] = obj.Object
+		}
+		workerMachineTemplates[mdClass.Class] = templates
+	}
+	valueLookUp["WorkerMachineTemplates"] = workerMachineTemplates
+
+	variables, err := resolveTopologyVariables(clusterClass, cluster)
+	if err != nil {
+		return err
+	}
+	valueLookUp["TopologyVariables"] = variables
+
+	return nil
+}
+
+// resolveTopologyVariables decodes the variables set in the topology of a Cluster and fills in the defaults from the
+// variable schemas of its ClusterClass, for variables that are unset as well as for unset properties of object values.
+func resolveTopologyVariables(clusterClass *clusterv1.ClusterClass, cluster *clusterv1.Cluster) (map[string]interface{}, error) {
+	variables := map[string]interface{}{}
+	for _, variable := range cluster.Spec.Topology.Variables {
+		var value interface{}
+		if err := json.Unmarshal(variable.Value.Raw, &value); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode value of topology variable %s", variable.Name)
+		}
+		variables[variable.Name] = value
+	}
+
+	for _, definition := range clusterClass.Spec.Variables {
+		value, err := defaultVariableValue(variables[definition.Name], definition.Schema.OpenAPIV3Schema)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to default topology variable %s", definition.Name)
+		}
+		if value != nil {
+			variables[definition.Name] = value
+		}
+	}
+
+	return variables, nil
+}
+
+// defaultVariableValue returns value with the defaults of schema applied, recursing into object properties and array
+// items. A nil value is replaced by the default of schema, if any.
+func defaultVariableValue(value interface{}, schema clusterv1.JSONSchemaProps) (interface{}, error) {
+	if value == nil {
+		if schema.Default == nil {
+			return nil, nil
+		}
+		if err := json.Unmarshal(schema.Default.Raw, &value); err != nil {
+			return nil, errors.Wrap(err, "failed to decode default value")
+		}
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for name, propertySchema := range schema.Properties {
+			propertyValue, err := defaultVariableValue(typed[name], propertySchema)
+			if err != nil {
+				return nil, errors.Wrapf(err, "property %s", name)
+			}
+			if propertyValue != nil {
+				typed[name] = propertyValue
+			}
+		}
+	case []interface{}:
+		if schema.Items != nil {
+			for i, item := range typed {
+				itemValue, err := defaultVariableValue(item, *schema.Items)
+				if err != nil {
+					return nil, errors.Wrapf(err, "item %d", i)
+				}
+				if itemValue != nil {
+					typed[i] = itemValue
+				}
+			}
+		}
+	}
+
+	return value, nil
+}
+
+// ParseValues renders the Go templating in the ValuesTemplate of a HelmChartProxy for a Cluster and deep-merges the result
+// over the structured Values of the HelmChartProxy.
+func ParseValues(ctx context.Context, spec addonsv1alpha2.HelmChartProxySpec, cluster *clusterv1.Cluster, valueLookUp map[string]interface{}) (string, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	log.V(2).Info("Rendering templating in values:", "values", spec.ValuesTemplate)
+	expandedTemplate, err := renderTemplate(spec.ChartName+"-"+cluster.GetName(), spec.ValuesTemplate, cluster, valueLookUp)
 	if err != nil {
 		return "", err
 	}
+	log.V(2).Info("Expanded values to", "result", expandedTemplate)
+
+	if spec.Values == nil {
+		return expandedTemplate, nil
+	}
+
+	baseValues, err := chartutil.ReadValues(spec.Values.Raw)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse values")
+	}
+	templateValues, err := chartutil.ReadValues([]byte(expandedTemplate))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse rendered values")
+	}
+	merged, err := yaml.Marshal(chartutil.CoalesceTables(templateValues, baseValues))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal merged values")
+	}
+	log.V(2).Info("Merged values to", "result", string(merged))
+
+	return string(merged), nil
+}
+
+// ValuesToJSON converts YAML values to the structured values of a HelmReleaseProxy. Empty values are converted to nil.
+func ValuesToJSON(values string) (*apiextensionsv1.JSON, error) {
+	raw, err := yaml.YAMLToJSON([]byte(values))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert values to JSON")
+	}
+	if string(raw) == "null" {
+		return nil, nil
+	}
+
+	return &apiextensionsv1.JSON{Raw: raw}, nil
+}
+
+// ValuesEqual returns true if two structured values are semantically equal, regardless of their formatting.
+func ValuesEqual(a, b *apiextensionsv1.JSON) bool {
+	decode := func(values *apiextensionsv1.JSON) interface{} {
+		if values == nil {
+			return nil
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(values.Raw, &decoded); err != nil {
+			return string(values.Raw)
+		}
+
+		return decoded
+	}
+
+	return reflect.DeepEqual(decode(a), decode(b))
+}
+
+// ParsePostRenderers renders the Go templating in the patches of the PostRenderers of a HelmChartProxy for a Cluster.
+func ParsePostRenderers(ctx context.Context, spec addonsv1alpha2.HelmChartProxySpec, cluster *clusterv1.Cluster, valueLookUp map[string]interface{}) (*addonsv1alpha2.PostRenderers, error) {
+	log := ctrl.LoggerFrom(ctx)
 
-	tmpl, err := template.New(spec.ChartName + "-" + cluster.GetName()).
+	if spec.PostRenderers == nil {
+		return nil, nil
+	}
+
+	postRenderers := spec.PostRenderers.DeepCopy()
+	for i, patch := range postRenderers.PatchesStrategicMerge {
+		log.V(2).Info("Rendering templating in strategic merge patch:", "patch", patch)
+		expandedPatch, err := renderTemplate(fmt.Sprintf("%s-%s-patchesStrategicMerge-%d", spec.ChartName, cluster.GetName(), i), patch, cluster, valueLookUp)
+		if err != nil {
+			return nil, err
+		}
+		postRenderers.PatchesStrategicMerge[i] = expandedPatch
+	}
+	for i, patch := range postRenderers.PatchesJSON6902 {
+		log.V(2).Info("Rendering templating in JSON6902 patch:", "patch", patch.Patch)
+		expandedPatch, err := renderTemplate(fmt.Sprintf("%s-%s-patchesJson6902-%d", spec.ChartName, cluster.GetName(), i), patch.Patch, cluster, valueLookUp)
+		if err != nil {
+			return nil, err
+		}
+		postRenderers.PatchesJSON6902[i].Patch = expandedPatch
+	}
+
+	return postRenderers, nil
+}
+
+// ApplyValueOverrides deep-merges the values from the ValueOverridesAnnotationPrefix annotation of a Cluster for a
+// HelmChartProxy over the rendered values. It returns the merged values and the sources of the overrides that were applied.
+// A null override removes the key from the values. The values are returned unchanged if the Cluster has no overrides.
+func ApplyValueOverrides(ctx context.Context, helmChartProxyName string, cluster *clusterv1.Cluster, values string) (string, []string, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	annotation := addonsv1alpha2.ValueOverridesAnnotationPrefix + helmChartProxyName
+	overrides, ok := cluster.GetAnnotations()[annotation]
+	if !ok {
+		return values, nil, nil
+	}
+
+	overrideValues, err := chartutil.ReadValues([]byte(overrides))
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "failed to parse value overrides from annotation %s", annotation)
+	}
+	baseValues, err := chartutil.ReadValues([]byte(values))
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to parse rendered values")
+	}
+
+	merged, err := yaml.Marshal(chartutil.CoalesceTables(overrideValues, baseValues))
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to marshal values with overrides")
+	}
+	log.V(2).Info("Applied value overrides", "annotation", annotation, "result", string(merged))
+
+	return string(merged), []string{annotation}, nil
+}
+
+func renderTemplate(name string, text string, cluster *clusterv1.Cluster, valueLookUp map[string]interface{}) (string, error) {
+	tmpl, err := template.New(name).
 		Funcs(sprig.TxtFuncMap()).
-		Parse(spec.ValuesTemplate)
+		Parse(text)
 	if err != nil {
 		return "", err
 	}
 	var buffer bytes.Buffer
 
 	if err := tmpl.Execute(&buffer, valueLookUp); err != nil {
-		return "", errors.Wrapf(err, "error executing template string '%s' on cluster '%s'", spec.ValuesTemplate, cluster.GetName())
+		return "", errors.Wrapf(err, "error executing template string '%s' on cluster '%s'", text, cluster.GetName())
 	}
-	expandedTemplate := buffer.String()
-	log.V(2).Info("Expanded values to", "result", expandedTemplate)
 
-	return expandedTemplate, nil
+	return buffer.String(), nil
 }
 
 func ValueMapToArray(valueMap map[string]string) []string {
@@ -0,0 +1,259 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
+)
+
+func TestResolveTopologyVariables(t *testing.T) {
+	variable := func(name string, schema clusterv1.JSONSchemaProps) clusterv1.ClusterClassVariable {
+		return clusterv1.ClusterClassVariable{Name: name, Schema: clusterv1.VariableSchema{OpenAPIV3Schema: schema}}
+	}
+	value := func(name string, raw string) clusterv1.ClusterVariable {
+		return clusterv1.ClusterVariable{Name: name, Value: apiextensionsv1.JSON{Raw: []byte(raw)}}
+	}
+	defaultValue := func(raw string) *apiextensionsv1.JSON {
+		return &apiextensionsv1.JSON{Raw: []byte(raw)}
+	}
+
+	tests := []struct {
+		name        string
+		definitions []clusterv1.ClusterClassVariable
+		values      []clusterv1.ClusterVariable
+		want        map[string]interface{}
+		wantErr     bool
+	}{
+		{
+			name: "default value of an unset variable",
+			definitions: []clusterv1.ClusterClassVariable{
+				variable("region", clusterv1.JSONSchemaProps{Type: "string", Default: defaultValue(`"us-east-1"`)}),
+			},
+			want: map[string]interface{}{"region": "us-east-1"},
+		},
+		{
+			name: "unset variable without a default",
+			definitions: []clusterv1.ClusterClassVariable{
+				variable("region", clusterv1.JSONSchemaProps{Type: "string"}),
+			},
+			want: map[string]interface{}{},
+		},
+		{
+			name: "cluster value overrides the default",
+			definitions: []clusterv1.ClusterClassVariable{
+				variable("region", clusterv1.JSONSchemaProps{Type: "string", Default: defaultValue(`"us-east-1"`)}),
+			},
+			values: []clusterv1.ClusterVariable{value("region", `"eu-west-1"`)},
+			want:   map[string]interface{}{"region": "eu-west-1"},
+		},
+		{
+			name: "object default",
+			definitions: []clusterv1.ClusterClassVariable{
+				variable("proxy", clusterv1.JSONSchemaProps{Type: "object", Default: defaultValue(`{"http":"proxy.example.com","port":3128}`)}),
+			},
+			want: map[string]interface{}{"proxy": map[string]interface{}{"http": "proxy.example.com", "port": float64(3128)}},
+		},
+		{
+			name: "nested property defaults fill in unset properties of a cluster value",
+			definitions: []clusterv1.ClusterClassVariable{
+				variable("proxy", clusterv1.JSONSchemaProps{
+					Type: "object",
+					Properties: map[string]clusterv1.JSONSchemaProps{
+						"http": {Type: "string", Default: defaultValue(`"proxy.example.com"`)},
+						"port": {Type: "integer", Default: defaultValue(`3128`)},
+						"tls": {
+							Type: "object",
+							Properties: map[string]clusterv1.JSONSchemaProps{
+								"enabled": {Type: "boolean", Default: defaultValue(`true`)},
+							},
+						},
+					},
+				}),
+			},
+			values: []clusterv1.ClusterVariable{value("proxy", `{"port":8080,"tls":{}}`)},
+			want: map[string]interface{}{"proxy": map[string]interface{}{
+				"http": "proxy.example.com",
+				"port": float64(8080),
+				"tls":  map[string]interface{}{"enabled": true},
+			}},
+		},
+		{
+			name: "defaults of array items",
+			definitions: []clusterv1.ClusterClassVariable{
+				variable("pools", clusterv1.JSONSchemaProps{
+					Type: "array",
+					Items: &clusterv1.JSONSchemaProps{
+						Type: "object",
+						Properties: map[string]clusterv1.JSONSchemaProps{
+							"replicas": {Type: "integer", Default: defaultValue(`1`)},
+						},
+					},
+				}),
+			},
+			values: []clusterv1.ClusterVariable{value("pools", `[{"name":"a"},{"name":"b","replicas":3}]`)},
+			want: map[string]interface{}{"pools": []interface{}{
+				map[string]interface{}{"name": "a", "replicas": float64(1)},
+				map[string]interface{}{"name": "b", "replicas": float64(3)},
+			}},
+		},
+		{
+			name:   "cluster variable not defined by the ClusterClass",
+			values: []clusterv1.ClusterVariable{value("extra", `"value"`)},
+			want:   map[string]interface{}{"extra": "value"},
+		},
+		{
+			name:    "invalid cluster value",
+			values:  []clusterv1.ClusterVariable{value("region", `not json`)},
+			wantErr: true,
+		},
+		{
+			name: "invalid default",
+			definitions: []clusterv1.ClusterClassVariable{
+				variable("region", clusterv1.JSONSchemaProps{Type: "string", Default: defaultValue(`not json`)}),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clusterClass := &clusterv1.ClusterClass{Spec: clusterv1.ClusterClassSpec{Variables: tt.definitions}}
+			cluster := &clusterv1.Cluster{Spec: clusterv1.ClusterSpec{Topology: &clusterv1.Topology{Class: "test-class", Variables: tt.values}}}
+
+			got, err := resolveTopologyVariables(clusterClass, cluster)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestInitializeTemplateContextMissingClusterClass(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec:       clusterv1.ClusterSpec{Topology: &clusterv1.Topology{Class: "missing-class"}},
+	}
+
+	_, err := InitializeTemplateContext(context.Background(), c, addonsv1alpha2.HelmChartProxySpec{}, cluster)
+	g.Expect(err).To(MatchError(ContainSubstring("failed to get ClusterClass default/missing-class")))
+}
+
+func TestApplyValueOverrides(t *testing.T) {
+	const helmChartProxyName = "nginx-ingress"
+	annotation := addonsv1alpha2.ValueOverridesAnnotationPrefix + helmChartProxyName
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		values      string
+		want        string
+		wantApplied []string
+		wantErr     bool
+	}{
+		{
+			name:   "no overrides",
+			values: "replicaCount: 1\n",
+			want:   "replicaCount: 1\n",
+		},
+		{
+			name:        "overrides of another HelmChartProxy",
+			annotations: map[string]string{addonsv1alpha2.ValueOverridesAnnotationPrefix + "cert-manager": "replicaCount: 3"},
+			values:      "replicaCount: 1\n",
+			want:        "replicaCount: 1\n",
+		},
+		{
+			name:        "override takes precedence over the rendered values",
+			annotations: map[string]string{annotation: "replicaCount: 3"},
+			values:      "replicaCount: 1\nimage: nginx\n",
+			want:        "image: nginx\nreplicaCount: 3\n",
+			wantApplied: []string{annotation},
+		},
+		{
+			name:        "nested overrides are merged",
+			annotations: map[string]string{annotation: "controller:\n  service:\n    type: NodePort\n"},
+			values:      "controller:\n  replicas: 2\n  service:\n    type: LoadBalancer\n    port: 80\n",
+			want:        "controller:\n  replicas: 2\n  service:\n    port: 80\n    type: NodePort\n",
+			wantApplied: []string{annotation},
+		},
+		{
+			name:        "null override removes the key",
+			annotations: map[string]string{annotation: "image: null"},
+			values:      "replicaCount: 1\nimage: nginx\n",
+			want:        "replicaCount: 1\n",
+			wantApplied: []string{annotation},
+		},
+		{
+			name:        "empty overrides",
+			annotations: map[string]string{annotation: ""},
+			values:      "replicaCount: 1\n",
+			want:        "replicaCount: 1\n",
+			wantApplied: []string{annotation},
+		},
+		{
+			name:        "invalid override YAML",
+			annotations: map[string]string{annotation: "replicaCount: [3"},
+			values:      "replicaCount: 1\n",
+			wantErr:     true,
+		},
+		{
+			name:        "invalid rendered values",
+			annotations: map[string]string{annotation: "replicaCount: 3"},
+			values:      "replicaCount: [1",
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			cluster := &clusterv1.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default", Annotations: tt.annotations},
+			}
+
+			got, applied, err := ApplyValueOverrides(context.Background(), helmChartProxyName, cluster, tt.values)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+			g.Expect(applied).To(Equal(tt.wantApplied))
+		})
+	}
+}
@@ -19,13 +19,17 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/klog/v2"
 	"k8s.io/klog/v2/klogr"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -33,8 +37,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 
 	addonsv1alpha1 "cluster-api-addon-provider-helm/api/v1alpha1"
+	addonsv1alpha2 "cluster-api-addon-provider-helm/api/v1alpha2"
 	hcpController "cluster-api-addon-provider-helm/controllers/helmchartproxy"
 	hrpController "cluster-api-addon-provider-helm/controllers/helmreleaseproxy"
+	"cluster-api-addon-provider-helm/internal"
 
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	kcpv1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1beta1"
@@ -50,6 +56,8 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(addonsv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(addonsv1alpha2.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -59,6 +67,17 @@ func main() {
 	var probeAddr string
 	var helmChartProxyConcurrency int
 	var helmReleaseProxyConcurrency int
+	var helmChartProxyClusterConcurrency int
+	var registryMirrorsFlag string
+	var registryMirrorsConfigMapFlag string
+	var helmStorageDriver string
+	var helmSQLConnectionSecretFlag string
+	var allowCRDDeletion bool
+	var defaultServiceAccountName string
+	var requireImpersonation bool
+	var impersonationAllowlistFlag string
+	var allowInsecureSkipTLSVerify bool
+	var migrateStorageVersion bool
 
 	klog.InitFlags(nil)
 
@@ -69,11 +88,63 @@ func main() {
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.IntVar(&helmChartProxyConcurrency, "helm-chart-proxy-concurrency", 10, "The number of HelmChartProxies to process concurrently.")
 	flag.IntVar(&helmReleaseProxyConcurrency, "helm-release-proxy-concurrency", 10, "The number of HelmReleaseProxies to process concurrently.")
+	flag.IntVar(&helmChartProxyClusterConcurrency, "helm-chart-proxy-cluster-concurrency", 10, "The number of selected Clusters to render values and write HelmReleaseProxies for concurrently within a single HelmChartProxy reconcile.")
+	flag.StringVar(&registryMirrorsFlag, "registry-mirrors", "", "A comma-separated list of registry=mirror pairs, e.g. docker.io=registry.internal/dockerhub. Container images from each registry in the manifests and hooks rendered for every HelmChartProxy are rewritten to pull from its mirror. Changing the mirrors upgrades every release once.")
+	flag.StringVar(&registryMirrorsConfigMapFlag, "registry-mirrors-configmap", "", "The namespace/name of a ConfigMap whose data maps registries to mirrors. Its mirrors take precedence over --registry-mirrors.")
+	flag.StringVar(&helmStorageDriver, "helm-storage-driver", string(addonsv1alpha2.HelmStorageDriverSecret), "The default Helm storage driver for new releases of HelmChartProxies that don't specify one: secret, configmap or sql.")
+	flag.StringVar(&helmSQLConnectionSecretFlag, "helm-sql-connection-secret", "", "The namespace/name of a Secret with the PostgreSQL connection string in its connectionString key, used when --helm-storage-driver is sql.")
+	flag.BoolVar(&allowCRDDeletion, "allow-crd-deletion", false, "Allow HelmChartProxies and HelmReleaseProxies with crds.deleteOnUninstall to delete the CRDs of their chart, and all of their custom resources, from workload clusters when the release is uninstalled.")
+	flag.StringVar(&defaultServiceAccountName, "default-service-account-name", "", "The ServiceAccount in the release namespace on each workload cluster that Helm impersonates for HelmChartProxies and HelmReleaseProxies that don't specify serviceAccountName or impersonate.")
+	flag.BoolVar(&requireImpersonation, "require-impersonation", false, "Refuse to manage Helm releases with the credentials from the Cluster kubeconfig. HelmChartProxies and HelmReleaseProxies must specify serviceAccountName or impersonate unless --default-service-account-name is set, which is also impersonated instead of identities that are not on the --impersonation-allowlist.")
+	flag.StringVar(&impersonationAllowlistFlag, "impersonation-allowlist", "", "A comma-separated list of namespace=identity pairs of the users and groups on workload clusters that HelmChartProxies and HelmReleaseProxies in each namespace may impersonate, e.g. monitoring=system:serviceaccount:monitoring:helm,*=group:helm-operators. Groups are prefixed with group: and the namespace * allows the identity in every namespace. Identities that are not listed are refused.")
+	flag.BoolVar(&allowInsecureSkipTLSVerify, "allow-insecure-skip-tls-verify", false, "Allow Clusters with the addons.cluster.x-k8s.io/insecure-skip-tls-verify annotation to disable the verification of their API server certificate for Helm operations. Otherwise the annotation is ignored.")
+	flag.BoolVar(&migrateStorageVersion, "migrate-storage-version", true, "Rewrite existing HelmChartProxies, HelmReleaseProxies and ChartSourcePolicies in the storage version on startup and drop older versions from the stored versions of their CRDs.")
 	flag.Set("v", "2")
 	flag.Parse()
 
 	ctrl.SetLogger(klogr.NewWithOptions(klogr.WithFormat(klogr.FormatKlog)))
+
+	registryMirrors, err := internal.ParseRegistryMirrors(registryMirrorsFlag)
+	if err != nil {
+		setupLog.Error(err, "unable to parse registry mirrors")
+		os.Exit(1)
+	}
+	registryMirrorsConfigMap, err := parseNamespacedName(registryMirrorsConfigMapFlag)
+	if err != nil {
+		setupLog.Error(err, "unable to parse registry mirrors ConfigMap")
+		os.Exit(1)
+	}
+
+	defaultStorage := addonsv1alpha2.HelmStorage{Driver: addonsv1alpha2.HelmStorageDriver(helmStorageDriver)}
+	switch defaultStorage.Driver {
+	case addonsv1alpha2.HelmStorageDriverSecret, addonsv1alpha2.HelmStorageDriverConfigMap:
+	case addonsv1alpha2.HelmStorageDriverSQL:
+		if helmSQLConnectionSecretFlag == "" {
+			setupLog.Error(errors.New("--helm-sql-connection-secret is required"), "unable to configure sql storage driver")
+			os.Exit(1)
+		}
+	default:
+		setupLog.Error(errors.Errorf("unknown Helm storage driver %q", helmStorageDriver), "unable to configure Helm storage driver")
+		os.Exit(1)
+	}
+	helmSQLConnectionSecret, err := parseNamespacedName(helmSQLConnectionSecretFlag)
+	if err != nil {
+		setupLog.Error(err, "unable to parse SQL connection Secret")
+		os.Exit(1)
+	}
+	if helmSQLConnectionSecret.Name != "" {
+		defaultStorage.SQLConnectionSecretRef = &addonsv1alpha2.SecretKeyReference{Name: helmSQLConnectionSecret.Name, Key: "connectionString"}
+	}
+	impersonationAllowlist, err := addonsv1alpha2.ParseImpersonationAllowlist(impersonationAllowlistFlag)
+	if err != nil {
+		setupLog.Error(err, "unable to parse impersonation allowlist")
+		os.Exit(1)
+	}
+	addonsv1alpha2.SetImpersonationAllowlist(impersonationAllowlist)
+
 	syncPeriod := time.Second * 60 * 5
+	// The Event recorders of the manager rate-limit Events per object. The controllers also only record transitions, so
+	// the periodic resync doesn't repeat them.
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -96,8 +167,13 @@ func main() {
 	ctx := ctrl.SetupSignalHandler()
 
 	if err = (&hcpController.HelmChartProxyReconciler{
-		Client: mgr.GetClient(),
-		Scheme: scheme,
+		Client:                   mgr.GetClient(),
+		Scheme:                   scheme,
+		Recorder:                 mgr.GetEventRecorderFor("helmchartproxy-controller"),
+		ClusterConcurrency:       helmChartProxyClusterConcurrency,
+		RegistryMirrors:          registryMirrors,
+		RegistryMirrorsConfigMap: registryMirrorsConfigMap,
+		APIReader:                mgr.GetAPIReader(),
 	}).SetupWithManager(ctx, mgr, controller.Options{MaxConcurrentReconciles: helmChartProxyConcurrency}); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "HelmChartProxy")
 		os.Exit(1)
@@ -106,11 +182,23 @@ func main() {
 		setupLog.Error(err, "unable to create webhook", "webhook", "HelmChartProxy")
 		os.Exit(1)
 	}
+	if err = (&addonsv1alpha2.HelmChartProxy{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "HelmChartProxy")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err = (&hrpController.HelmReleaseProxyReconciler{
-		Client: mgr.GetClient(),
-		Scheme: scheme,
+		Client:                     mgr.GetClient(),
+		Scheme:                     scheme,
+		Recorder:                   mgr.GetEventRecorderFor("helmreleaseproxy-controller"),
+		DefaultStorage:             defaultStorage,
+		DefaultStorageNamespace:    helmSQLConnectionSecret.Namespace,
+		AllowCRDDeletion:           allowCRDDeletion,
+		DefaultServiceAccountName:  defaultServiceAccountName,
+		RequireImpersonation:       requireImpersonation,
+		ImpersonationAllowlist:     impersonationAllowlist,
+		AllowInsecureSkipTLSVerify: allowInsecureSkipTLSVerify,
 	}).SetupWithManager(ctx, mgr, controller.Options{MaxConcurrentReconciles: helmReleaseProxyConcurrency}); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "HelmReleaseProxy")
 		os.Exit(1)
@@ -119,8 +207,35 @@ func main() {
 		setupLog.Error(err, "unable to create webhook", "webhook", "HelmReleaseProxy")
 		os.Exit(1)
 	}
+	if err = (&addonsv1alpha2.HelmReleaseProxy{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "HelmReleaseProxy")
+		os.Exit(1)
+	}
+	if err = (&addonsv1alpha1.ChartSourcePolicy{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ChartSourcePolicy")
+		os.Exit(1)
+	}
+	if err = (&addonsv1alpha2.ChartSourcePolicy{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ChartSourcePolicy")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
+	if migrateStorageVersion {
+		if err := mgr.Add(&internal.StorageVersionMigrator{
+			Client:    mgr.GetClient(),
+			APIReader: mgr.GetAPIReader(),
+			CRDNames: []string{
+				"helmchartproxies.addons.cluster.x-k8s.io",
+				"helmreleaseproxies.addons.cluster.x-k8s.io",
+				"chartsourcepolicies.addons.cluster.x-k8s.io",
+			},
+		}); err != nil {
+			setupLog.Error(err, "unable to set up storage version migration")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -136,3 +251,17 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// parseNamespacedName parses a namespace/name flag value. An empty value returns an empty NamespacedName.
+func parseNamespacedName(value string) (types.NamespacedName, error) {
+	if value == "" {
+		return types.NamespacedName{}, nil
+	}
+
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, errors.Errorf("invalid value %q, expected namespace/name", value)
+	}
+
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}